@@ -0,0 +1,121 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+)
+
+// IofogApplicationsResource is the plural name of the applications resource.
+const IofogApplicationsResource = "iofogapplications"
+
+// Client is a client of the iofog.org/v1alpha1 API group.
+type Client struct {
+	client rest.Interface
+}
+
+// NewForConfig creates a client of the iofog.org/v1alpha1 API group.
+func NewForConfig(c *rest.Config) (*Client, error) {
+	config := *c
+	config.GroupVersion = &SchemeGroupVersion
+	config.APIPath = "/apis"
+	config.ContentType = runtime.ContentTypeJSON
+	config.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: Codecs}
+	if config.UserAgent == "" {
+		config.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+
+	client, err := rest.RESTClientFor(&config)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{client: client}, nil
+}
+
+// IofogApplications returns the client of the applications of a namespace, of every namespace when empty.
+func (c *Client) IofogApplications(namespace string) *IofogApplications {
+	return &IofogApplications{client: c.client, namespace: namespace}
+}
+
+// IofogApplications is a client of the applications of a namespace.
+type IofogApplications struct {
+	client    rest.Interface
+	namespace string
+}
+
+// Get returns an application.
+func (c *IofogApplications) Get(name string, options metav1.GetOptions) (*IofogApplication, error) {
+	result := &IofogApplication{}
+	err := c.client.Get().
+		Namespace(c.namespace).
+		Resource(IofogApplicationsResource).
+		Name(name).
+		VersionedParams(&options, ParameterCodec).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// List returns the applications matching the options.
+func (c *IofogApplications) List(options metav1.ListOptions) (*IofogApplicationList, error) {
+	result := &IofogApplicationList{}
+	err := c.client.Get().
+		Namespace(c.namespace).
+		Resource(IofogApplicationsResource).
+		VersionedParams(&options, ParameterCodec).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// Watch watches the applications matching the options.
+func (c *IofogApplications) Watch(options metav1.ListOptions) (watch.Interface, error) {
+	options.Watch = true
+	return c.client.Get().
+		Namespace(c.namespace).
+		Resource(IofogApplicationsResource).
+		VersionedParams(&options, ParameterCodec).
+		Watch()
+}
+
+// Update updates an application, its status is ignored.
+func (c *IofogApplications) Update(application *IofogApplication) (*IofogApplication, error) {
+	result := &IofogApplication{}
+	err := c.client.Put().
+		Namespace(c.namespace).
+		Resource(IofogApplicationsResource).
+		Name(application.Name).
+		Body(application).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// UpdateStatus updates the status of an application.
+func (c *IofogApplications) UpdateStatus(application *IofogApplication) (*IofogApplication, error) {
+	result := &IofogApplication{}
+	err := c.client.Put().
+		Namespace(c.namespace).
+		Resource(IofogApplicationsResource).
+		Name(application.Name).
+		SubResource("status").
+		Body(application).
+		Do().
+		Into(result)
+	return result, err
+}
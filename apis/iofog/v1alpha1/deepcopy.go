@@ -0,0 +1,127 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package v1alpha1
+
+import (
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/apps"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto copies the application into out.
+func (in *IofogApplication) DeepCopyInto(out *IofogApplication) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy copies the application.
+func (in *IofogApplication) DeepCopy() *IofogApplication {
+	if in == nil {
+		return nil
+	}
+	out := new(IofogApplication)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject copies the application.
+func (in *IofogApplication) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto copies the spec into out.
+func (in *IofogApplicationSpec) DeepCopyInto(out *IofogApplicationSpec) {
+	*out = *in
+	if in.Microservices != nil {
+		out.Microservices = make([]Microservice, len(in.Microservices))
+		for i := range in.Microservices {
+			in.Microservices[i].DeepCopyInto(&out.Microservices[i])
+		}
+	}
+	if in.Routes != nil {
+		out.Routes = make([]apps.Route, len(in.Routes))
+		copy(out.Routes, in.Routes)
+	}
+}
+
+// DeepCopyInto copies the microservice into out.
+func (in *Microservice) DeepCopyInto(out *Microservice) {
+	*out = *in
+	in.Microservice.DeepCopyInto(&out.Microservice)
+	if in.AgentSelector != nil {
+		out.AgentSelector = in.AgentSelector.DeepCopy()
+	}
+}
+
+// DeepCopyInto copies the status into out.
+func (in *IofogApplicationStatus) DeepCopyInto(out *IofogApplicationStatus) {
+	*out = *in
+	if in.Microservices != nil {
+		out.Microservices = make([]MicroserviceStatus, len(in.Microservices))
+		copy(out.Microservices, in.Microservices)
+	}
+	if in.Conditions != nil {
+		out.Conditions = make([]ApplicationCondition, len(in.Conditions))
+		for i := range in.Conditions {
+			out.Conditions[i] = in.Conditions[i]
+			in.Conditions[i].LastTransitionTime.DeepCopyInto(&out.Conditions[i].LastTransitionTime)
+		}
+	}
+}
+
+// DeepCopy copies the status.
+func (in *IofogApplicationStatus) DeepCopy() *IofogApplicationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IofogApplicationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the list into out.
+func (in *IofogApplicationList) DeepCopyInto(out *IofogApplicationList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]IofogApplication, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+// DeepCopy copies the list.
+func (in *IofogApplicationList) DeepCopy() *IofogApplicationList {
+	if in == nil {
+		return nil
+	}
+	out := new(IofogApplicationList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject copies the list.
+func (in *IofogApplicationList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package v1alpha1
+
+import (
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/apps"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IofogApplication is an ioFog application: microservices deployed on the agents, and the routes between them.
+type IofogApplication struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IofogApplicationSpec   `json:"spec"`
+	Status IofogApplicationStatus `json:"status,omitempty"`
+}
+
+// IofogApplicationSpec is the desired state of an application, it mirrors apps.Application.
+type IofogApplicationSpec struct {
+	// Microservices are deployed on the agent they name, or on an agent selected by their agent selector.
+	Microservices []Microservice `json:"microservices"`
+	// Routes carry the messages between the microservices, by name.
+	Routes []apps.Route `json:"routes,omitempty"`
+}
+
+// Microservice is a microservice of an application.
+type Microservice struct {
+	apps.Microservice `json:",inline"`
+
+	// AgentSelector selects the agent running the microservice by the labels of its node, when no agent is named.
+	// The first ready node matching the selector, by name, is chosen.
+	AgentSelector *metav1.LabelSelector `json:"agentSelector,omitempty"`
+}
+
+// IofogApplicationStatus is the observed state of an application.
+type IofogApplicationStatus struct {
+	// ObservedGeneration is the generation of the spec last deployed.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// FlowID is the ID of the flow of the application in the ioFog Controller.
+	FlowID        int                    `json:"flowId,omitempty"`
+	Microservices []MicroserviceStatus   `json:"microservices,omitempty"`
+	Conditions    []ApplicationCondition `json:"conditions,omitempty"`
+}
+
+// MicroserviceStatus is the observed state of a microservice of an application.
+type MicroserviceStatus struct {
+	Name  string `json:"name"`
+	UUID  string `json:"uuid,omitempty"`
+	Agent string `json:"agent,omitempty"`
+	// State is the state of the microservice reported by its agent, such as RUNNING.
+	State string `json:"state,omitempty"`
+}
+
+// ApplicationConditionType is the type of a condition of an application.
+type ApplicationConditionType string
+
+const (
+	// ApplicationDeployed is True once the spec of the application is deployed to the ioFog Controller.
+	ApplicationDeployed ApplicationConditionType = "Deployed"
+	// ApplicationReady is True while every microservice of the application runs.
+	ApplicationReady ApplicationConditionType = "Ready"
+)
+
+// ApplicationCondition is a condition of an application.
+type ApplicationCondition struct {
+	Type               ApplicationConditionType `json:"type"`
+	Status             corev1.ConditionStatus   `json:"status"`
+	LastTransitionTime metav1.Time              `json:"lastTransitionTime,omitempty"`
+	Reason             string                   `json:"reason,omitempty"`
+	Message            string                   `json:"message,omitempty"`
+}
+
+// IofogApplicationList is a list of applications.
+type IofogApplicationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []IofogApplication `json:"items"`
+}
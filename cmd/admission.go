@@ -0,0 +1,58 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers/iofog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// AdmissionServerOptions configures the server of the validating webhook of the pods.
+type AdmissionServerOptions struct {
+	Address  string
+	CertPath string
+	KeyPath  string
+}
+
+// validateIofogPod validates the pods meant for the ioFog agents: pods with ioFog annotations, or with a toleration naming
+// the taint of the nodes. Other pods, including those tolerating every taint, are left to the other kubelets.
+// Updates are only validated when they change the microservices of the pod, so that the metadata of a pod admitted
+// before, such as its labels or finalizers, can still be changed.
+func validateIofogPod(ctx context.Context, pod, old *corev1.Pod) field.ErrorList {
+	if !iofog.HasIofogAnnotations(pod) && !toleratesTaint(pod, taint) {
+		return nil
+	}
+	if old != nil && !iofog.MicroservicesChanged(old, pod) {
+		return nil
+	}
+	return iofog.ValidatePod(ctx, pod, catalogCache.Items)
+}
+
+// toleratesTaint returns whether a pod has a toleration naming the key of a taint and tolerating it. Wildcard
+// tolerations, such as those of daemon sets, do not count.
+func toleratesTaint(pod *corev1.Pod, taint *corev1.Taint) bool {
+	if taint == nil {
+		return false
+	}
+	for idx := range pod.Spec.Tolerations {
+		toleration := &pod.Spec.Tolerations[idx]
+		if toleration.Key == taint.Key && toleration.ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
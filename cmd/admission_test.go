@@ -0,0 +1,57 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestToleratesTaint(t *testing.T) {
+	taint := &corev1.Taint{Key: DefaultTaintKey, Value: DefaultTaintValue, Effect: DefaultTaintEffect}
+	testCases := []struct {
+		name       string
+		toleration corev1.Toleration
+		expected   bool
+	}{
+		{
+			name:       "named",
+			toleration: corev1.Toleration{Key: DefaultTaintKey, Operator: corev1.TolerationOpEqual, Value: DefaultTaintValue, Effect: DefaultTaintEffect},
+			expected:   true,
+		},
+		{
+			name:       "named key",
+			toleration: corev1.Toleration{Key: DefaultTaintKey, Operator: corev1.TolerationOpExists},
+			expected:   true,
+		},
+		{
+			name:       "wildcard",
+			toleration: corev1.Toleration{Operator: corev1.TolerationOpExists},
+		},
+		{
+			name:       "other key",
+			toleration: corev1.Toleration{Key: "node.kubernetes.io/unreachable", Operator: corev1.TolerationOpExists},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := &corev1.Pod{Spec: corev1.PodSpec{Tolerations: []corev1.Toleration{tc.toleration}}}
+			if tolerates := toleratesTaint(pod, taint); tolerates != tc.expected {
+				t.Errorf("expected %v, got %v", tc.expected, tolerates)
+			}
+		})
+	}
+}
@@ -0,0 +1,418 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/apps"
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/apis/iofog/v1alpha1"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// applicationFinalizer keeps the applications until their flow is deleted from the ioFog Controller.
+	applicationFinalizer = "iofog.org/application"
+	// applicationResyncPeriod is how often the status of the applications is refreshed.
+	applicationResyncPeriod = 30 * time.Second
+	applicationWorkers      = 2
+)
+
+// ApplicationController deploys the IofogApplications to the ioFog Controller and reports their status.
+// The applications are deployed as flows named after their namespace and name.
+type ApplicationController struct {
+	applications *v1alpha1.Client
+	nodes        kubernetes.Interface
+	informer     cache.SharedIndexInformer
+	queue        workqueue.RateLimitingInterface
+	// deploy deploys an application to the ioFog Controller.
+	deploy func(application apps.Application) error
+	// agentName returns the name of the agent of a node, false when the node is not the node of an agent.
+	agentName func(nodeName string) (string, bool)
+}
+
+// runApplicationController reconciles the IofogApplications until the context is done.
+// Nothing is reconciled when the IofogApplication custom resource definition is not installed.
+func runApplicationController(ctx context.Context) error {
+	config, err := newClientConfig(kubeConfig)
+	if err != nil {
+		return err
+	}
+	applications, err := v1alpha1.NewForConfig(config)
+	if err != nil {
+		return errors.Wrap(err, "error creating the applications client")
+	}
+	nodes, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return errors.Wrap(err, "error creating kubernetes client")
+	}
+
+	if _, err := applications.IofogApplications(kubeNamespace).List(metav1.ListOptions{Limit: 1}); k8serrors.IsNotFound(err) {
+		log.G(ctx).Warn("The IofogApplication custom resource definition is not installed, applications are not reconciled")
+		return nil
+	}
+
+	c := NewApplicationController(applications, nodes, kubeNamespace)
+	c.Run(ctx, applicationWorkers)
+	return nil
+}
+
+// NewApplicationController creates a controller of the applications of a namespace, of every namespace when empty.
+func NewApplicationController(applications *v1alpha1.Client, nodes kubernetes.Interface, namespace string) *ApplicationController {
+	c := &ApplicationController{
+		applications: applications,
+		nodes:        nodes,
+		queue:        workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "applications"),
+		deploy: func(application apps.Application) error {
+			return apps.DeployApplication(controller, application)
+		},
+		agentName: supervisedAgentName,
+	}
+
+	c.informer = cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return applications.IofogApplications(namespace).List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return applications.IofogApplications(namespace).Watch(options)
+		},
+	}, &v1alpha1.IofogApplication{}, applicationResyncPeriod, cache.Indexers{})
+
+	enqueue := func(obj interface{}) {
+		if key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err != nil {
+			log.L.Error(err)
+		} else {
+			c.queue.Add(key)
+		}
+	}
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    enqueue,
+		UpdateFunc: func(_, obj interface{}) { enqueue(obj) },
+		DeleteFunc: enqueue,
+	})
+	return c
+}
+
+// Run reconciles the applications with the given number of workers until the context is done.
+func (c *ApplicationController) Run(ctx context.Context, workers int) {
+	defer c.queue.ShutDown()
+
+	go c.informer.Run(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), c.informer.HasSynced) {
+		return
+	}
+
+	log.G(ctx).Info("Reconciling ioFog applications")
+	for i := 0; i < workers; i++ {
+		go wait.Until(func() {
+			for c.processNextItem(ctx) {
+			}
+		}, time.Second, ctx.Done())
+	}
+	<-ctx.Done()
+}
+
+func (c *ApplicationController) processNextItem(ctx context.Context) bool {
+	obj, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(obj)
+
+	key := obj.(string)
+	if err := c.sync(ctx, key); err != nil {
+		log.G(ctx).WithError(err).WithField("application", key).Warn("Error reconciling application, retrying")
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+// sync deploys an application when its spec changed, deletes its flow once it is deleted, and refreshes its status.
+func (c *ApplicationController) sync(ctx context.Context, key string) error {
+	obj, exists, err := c.informer.GetStore().GetByKey(key)
+	if err != nil || !exists {
+		return err
+	}
+	application := obj.(*v1alpha1.IofogApplication).DeepCopy()
+	applications := c.applications.IofogApplications(application.Namespace)
+	flowName := applicationFlowName(application)
+
+	if application.DeletionTimestamp != nil {
+		if !hasFinalizer(application, applicationFinalizer) {
+			return nil
+		}
+		if err := deleteFlow(flowName); err != nil {
+			return err
+		}
+		application.Finalizers = removeFinalizer(application.Finalizers, applicationFinalizer)
+		_, err := applications.Update(application)
+		if err == nil {
+			log.G(ctx).WithField("application", key).Info("Deleted application")
+		}
+		return err
+	}
+
+	if !hasFinalizer(application, applicationFinalizer) {
+		application.Finalizers = append(application.Finalizers, applicationFinalizer)
+		if application, err = applications.Update(application); err != nil {
+			return err
+		}
+	}
+
+	status := application.Status.DeepCopy()
+	var deployErr error
+	if status.ObservedGeneration != application.Generation || !applicationConditionTrue(status.Conditions, v1alpha1.ApplicationDeployed) {
+		deployErr = c.deployApplication(application)
+		if deployErr != nil {
+			setApplicationCondition(status, v1alpha1.ApplicationDeployed, corev1.ConditionFalse, "DeployFailed", deployErr.Error())
+		} else {
+			status.ObservedGeneration = application.Generation
+			setApplicationCondition(status, v1alpha1.ApplicationDeployed, corev1.ConditionTrue, "Deployed", "")
+			log.G(ctx).WithField("application", key).WithField("generation", application.Generation).Info("Deployed application")
+		}
+	}
+
+	if err := refreshApplicationStatus(status, flowName); err != nil {
+		log.G(ctx).WithError(err).WithField("application", key).Warn("Error refreshing the status of the application")
+	}
+
+	if !equalJSON(&application.Status, status) {
+		application.Status = *status
+		if _, err := applications.UpdateStatus(application); err != nil {
+			return err
+		}
+	}
+	return deployErr
+}
+
+// deployApplication deploys the microservices of an application on their agents, and the routes between them.
+func (c *ApplicationController) deployApplication(application *v1alpha1.IofogApplication) error {
+	microservices := make([]apps.Microservice, 0, len(application.Spec.Microservices))
+	for _, microservice := range application.Spec.Microservices {
+		if microservice.Agent.Name == "" {
+			agent, err := c.selectAgent(microservice.AgentSelector)
+			if err != nil {
+				return errors.Wrapf(err, "error selecting the agent of microservice %s", microservice.Name)
+			}
+			microservice.Agent.Name = agent
+		}
+		microservices = append(microservices, microservice.Microservice)
+	}
+
+	return c.deploy(apps.Application{
+		Name:          applicationFlowName(application),
+		Microservices: microservices,
+		Routes:        application.Spec.Routes,
+	})
+}
+
+// selectAgent returns the agent of the first ready node, by name, matching the selector.
+func (c *ApplicationController) selectAgent(selector *metav1.LabelSelector) (string, error) {
+	if selector == nil {
+		return "", errors.New("no agent named and no agent selector")
+	}
+	labelSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return "", err
+	}
+	nodes, err := c.nodes.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: labelSelector.String()})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Slice(nodes.Items, func(i, j int) bool {
+		return nodes.Items[i].Name < nodes.Items[j].Name
+	})
+	for _, node := range nodes.Items {
+		agent, ok := c.agentName(node.Name)
+		if ok && nodeReady(&node) {
+			return agent, nil
+		}
+	}
+	return "", errors.Errorf("no ready agent matches %s", labelSelector.String())
+}
+
+// supervisedAgentName returns the name of the agent of a node run by this kubelet.
+func supervisedAgentName(name string) (string, bool) {
+	for _, nodeId := range nodeSupervisor.NodeIDs() {
+		if nodeName(nodeId) != name {
+			continue
+		}
+		snapshot, err := agentCache.Get(nodeId)
+		if err != nil {
+			return "", false
+		}
+		return snapshot.Agent.Name, true
+	}
+	return "", false
+}
+
+// refreshApplicationStatus reports the flow of an application and the state of its microservices.
+func refreshApplicationStatus(status *v1alpha1.IofogApplicationStatus, flowName string) error {
+	flow, err := controllerClient.GetFlowByName(flowName)
+	if err != nil {
+		return err
+	}
+	list, err := controllerClient.GetMicroservicesPerFlow(flow.ID)
+	if err != nil {
+		return err
+	}
+
+	status.FlowID = flow.ID
+	status.Microservices = applicationMicroservices(list.Microservices, func(uuid string) string {
+		if snapshot, err := agentCache.Get(uuid); err == nil {
+			return snapshot.Agent.Name
+		}
+		return uuid
+	})
+
+	notRunning := []string{}
+	for _, microservice := range status.Microservices {
+		if microservice.State != "RUNNING" {
+			notRunning = append(notRunning, microservice.Name)
+		}
+	}
+	if len(notRunning) == 0 {
+		setApplicationCondition(status, v1alpha1.ApplicationReady, corev1.ConditionTrue, "MicroservicesRunning", "")
+	} else {
+		setApplicationCondition(status, v1alpha1.ApplicationReady, corev1.ConditionFalse, "MicroservicesNotRunning",
+			"microservices not running: ["+strings.Join(notRunning, ", ")+"]")
+	}
+	return nil
+}
+
+// applicationMicroservices reports the state of the microservices of a flow, sorted by name.
+func applicationMicroservices(microservices []client.MicroserviceInfo, agentName func(uuid string) string) []v1alpha1.MicroserviceStatus {
+	statuses := make([]v1alpha1.MicroserviceStatus, 0, len(microservices))
+	for _, microservice := range microservices {
+		statuses = append(statuses, v1alpha1.MicroserviceStatus{
+			Name:  microservice.Name,
+			UUID:  microservice.UUID,
+			Agent: agentName(microservice.AgentUUID),
+			State: microservice.Status.Status,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// deleteFlow deletes a flow from the ioFog Controller, if it exists.
+func deleteFlow(name string) error {
+	flow, err := controllerClient.GetFlowByName(name)
+	if err != nil {
+		if _, ok := err.(*client.NotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+	return controllerClient.DeleteFlow(flow.ID)
+}
+
+// applicationFlowName is the name of the flow of an application, unique across namespaces. The separator is not
+// valid in Kubernetes names, so that it cannot collide with another application or with the flow of a pod.
+func applicationFlowName(application *v1alpha1.IofogApplication) string {
+	return application.Namespace + "/" + application.Name
+}
+
+// setApplicationCondition sets a condition, keeping its transition time when its status did not change.
+func setApplicationCondition(status *v1alpha1.IofogApplicationStatus, conditionType v1alpha1.ApplicationConditionType, conditionStatus corev1.ConditionStatus, reason, message string) {
+	condition := v1alpha1.ApplicationCondition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+	for idx, existing := range status.Conditions {
+		if existing.Type != conditionType {
+			continue
+		}
+		if existing.Status == conditionStatus {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		status.Conditions[idx] = condition
+		return
+	}
+	status.Conditions = append(status.Conditions, condition)
+}
+
+func applicationConditionTrue(conditions []v1alpha1.ApplicationCondition, conditionType v1alpha1.ApplicationConditionType) bool {
+	for _, condition := range conditions {
+		if condition.Type == conditionType {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func hasFinalizer(application *v1alpha1.IofogApplication, finalizer string) bool {
+	for _, f := range application.Finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func removeFinalizer(finalizers []string, finalizer string) []string {
+	kept := make([]string, 0, len(finalizers))
+	for _, f := range finalizers {
+		if f != finalizer {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// equalJSON compares values through their JSON form.
+func equalJSON(a, b interface{}) bool {
+	aJSON, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bJSON, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aJSON, bJSON)
+}
@@ -0,0 +1,79 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/apis/iofog/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetApplicationCondition(t *testing.T) {
+	transition := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	status := &v1alpha1.IofogApplicationStatus{
+		Conditions: []v1alpha1.ApplicationCondition{
+			{Type: v1alpha1.ApplicationDeployed, Status: corev1.ConditionTrue, LastTransitionTime: transition, Reason: "Deployed"},
+			{Type: v1alpha1.ApplicationReady, Status: corev1.ConditionTrue, LastTransitionTime: transition},
+		},
+	}
+
+	// The transition time is kept while the status does not change.
+	setApplicationCondition(status, v1alpha1.ApplicationDeployed, corev1.ConditionTrue, "Deployed", "")
+	if !status.Conditions[0].LastTransitionTime.Equal(&transition) {
+		t.Errorf("expected the transition time to be kept, got %v", status.Conditions[0].LastTransitionTime)
+	}
+	if !applicationConditionTrue(status.Conditions, v1alpha1.ApplicationDeployed) {
+		t.Error("expected the application to be deployed")
+	}
+
+	setApplicationCondition(status, v1alpha1.ApplicationReady, corev1.ConditionFalse, "MicroservicesNotRunning", "")
+	if status.Conditions[1].LastTransitionTime.Equal(&transition) {
+		t.Error("expected the transition time to change with the status")
+	}
+	if applicationConditionTrue(status.Conditions, v1alpha1.ApplicationReady) {
+		t.Error("expected the application not to be ready")
+	}
+	if len(status.Conditions) != 2 {
+		t.Errorf("expected the conditions to be replaced, got %d conditions", len(status.Conditions))
+	}
+}
+
+func TestApplicationMicroservices(t *testing.T) {
+	microservices := []client.MicroserviceInfo{
+		{Name: "sensor", UUID: "m2", AgentUUID: "a2", Status: client.MicroserviceStatus{Status: "PULLING"}},
+		{Name: "heart-rate", UUID: "m1", AgentUUID: "a1", Status: client.MicroserviceStatus{Status: "RUNNING"}},
+	}
+	agents := map[string]string{"a1": "agent-1", "a2": "agent-2"}
+
+	statuses := applicationMicroservices(microservices, func(uuid string) string { return agents[uuid] })
+	expected := []v1alpha1.MicroserviceStatus{
+		{Name: "heart-rate", UUID: "m1", Agent: "agent-1", State: "RUNNING"},
+		{Name: "sensor", UUID: "m2", Agent: "agent-2", State: "PULLING"},
+	}
+	if !equalJSON(statuses, expected) {
+		t.Errorf("expected %v, got %v", expected, statuses)
+	}
+}
+
+func TestApplicationFlowName(t *testing.T) {
+	first := &v1alpha1.IofogApplication{ObjectMeta: metav1.ObjectMeta{Namespace: "a-b", Name: "c"}}
+	second := &v1alpha1.IofogApplication{ObjectMeta: metav1.ObjectMeta{Namespace: "a", Name: "b-c"}}
+	if applicationFlowName(first) == applicationFlowName(second) {
+		t.Errorf("expected distinct flow names, both are %s", applicationFlowName(first))
+	}
+}
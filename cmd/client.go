@@ -23,6 +23,15 @@ import (
 )
 
 func newClient(configPath string) (*kubernetes.Clientset, error) {
+	config, err := newClientConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+// newClientConfig builds the configuration of the Kubernetes clients from the kubeconfig file, or from the cluster.
+func newClientConfig(configPath string) (*rest.Config, error) {
 	var config *rest.Config
 
 	// Check if the kubeConfig file exists.
@@ -44,5 +53,5 @@ func newClient(configPath string) (*kubernetes.Clientset, error) {
 		config.Host = masterURI
 	}
 
-	return kubernetes.NewForConfig(config)
+	return config, nil
 }
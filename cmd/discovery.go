@@ -0,0 +1,340 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	defaultAgentResyncPeriod = 10 * time.Second
+	defaultAgentResyncJitter = 0.1
+	// defaultAgentStartTimeout bounds how long a start callback waits for the node of the agent to run.
+	defaultAgentStartTimeout = 2 * time.Minute
+)
+
+// AgentEventType is the kind of change observed on an agent.
+type AgentEventType string
+
+const (
+	AgentAdded   AgentEventType = "Added"
+	AgentUpdated AgentEventType = "Updated"
+	AgentRemoved AgentEventType = "Removed"
+)
+
+// AgentEvent is a change of an agent of the ioFog Controller.
+type AgentEvent struct {
+	Type  AgentEventType
+	Agent client.AgentInfo
+}
+
+// AgentSource feeds the reconciler with what it learns about the agents until the context is done.
+type AgentSource interface {
+	Run(ctx context.Context, reconciler *AgentReconciler)
+}
+
+// AgentReconciler keeps the last known state of every agent and turns what the sources report into events.
+// Events are delivered one at a time, in the order they were observed, by Run.
+type AgentReconciler struct {
+	mutex   sync.Mutex
+	agents  map[string]client.AgentInfo
+	stopped map[string]bool
+	queue   []AgentEvent
+	wake    chan struct{}
+}
+
+// NewAgentReconciler creates a reconciler which knows no agent.
+func NewAgentReconciler() *AgentReconciler {
+	return &AgentReconciler{
+		agents:  make(map[string]client.AgentInfo),
+		stopped: make(map[string]bool),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Run delivers the events to handle until the context is done.
+func (r *AgentReconciler) Run(ctx context.Context, handle func(AgentEvent)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.wake:
+		}
+
+		for {
+			r.mutex.Lock()
+			if len(r.queue) == 0 {
+				r.mutex.Unlock()
+				break
+			}
+			event := r.queue[0]
+			r.queue = r.queue[1:]
+			r.mutex.Unlock()
+
+			if ctx.Err() != nil {
+				return
+			}
+			handle(event)
+		}
+	}
+}
+
+// Resync reconciles the complete list of agents: agents missing from the list are removed, and the stopped agents
+// are ignored until they start again.
+func (r *AgentReconciler) Resync(agents []client.AgentInfo) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	listed := make(map[string]bool, len(agents))
+	for _, agent := range agents {
+		listed[agent.UUID] = true
+		if !r.stopped[agent.UUID] {
+			r.upsert(agent)
+		}
+	}
+	for uuid := range r.stopped {
+		if !listed[uuid] {
+			delete(r.stopped, uuid)
+		}
+	}
+
+	removed := make([]string, 0)
+	for uuid := range r.agents {
+		if !listed[uuid] {
+			removed = append(removed, uuid)
+		}
+	}
+	sort.Strings(removed)
+	for _, uuid := range removed {
+		r.remove(uuid)
+	}
+}
+
+// Upsert reconciles a single agent, starting it again if it was stopped.
+func (r *AgentReconciler) Upsert(agent client.AgentInfo) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.stopped, agent.UUID)
+	r.upsert(agent)
+}
+
+// Remove forgets an agent.
+func (r *AgentReconciler) Remove(uuid string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.remove(uuid)
+}
+
+// Stop forgets an agent whose node is stopped by the caller, without an event, and drops its pending events.
+// The resyncs ignore the agent until it is upserted again.
+func (r *AgentReconciler) Stop(uuid string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.stopped[uuid] = true
+	delete(r.agents, uuid)
+	queue := r.queue[:0]
+	for _, event := range r.queue {
+		if event.Agent.UUID != uuid {
+			queue = append(queue, event)
+		}
+	}
+	r.queue = queue
+}
+
+// Agent returns the last known state of an agent.
+func (r *AgentReconciler) Agent(uuid string) (client.AgentInfo, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	agent, ok := r.agents[uuid]
+	return agent, ok
+}
+
+func (r *AgentReconciler) upsert(agent client.AgentInfo) {
+	known, ok := r.agents[agent.UUID]
+	r.agents[agent.UUID] = agent
+	switch {
+	case !ok:
+		r.emit(AgentEvent{Type: AgentAdded, Agent: agent})
+	case agentChanged(known, agent):
+		r.emit(AgentEvent{Type: AgentUpdated, Agent: agent})
+	}
+}
+
+func (r *AgentReconciler) remove(uuid string) {
+	agent, ok := r.agents[uuid]
+	if !ok {
+		return
+	}
+	delete(r.agents, uuid)
+	r.emit(AgentEvent{Type: AgentRemoved, Agent: agent})
+}
+
+func (r *AgentReconciler) emit(event AgentEvent) {
+	r.queue = append(r.queue, event)
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// agentChanged reports whether an agent changed, ignoring the usage and activity figures reported with every status.
+func agentChanged(known, agent client.AgentInfo) bool {
+	return !reflect.DeepEqual(agentSpec(known), agentSpec(agent))
+}
+
+func agentSpec(agent client.AgentInfo) client.AgentInfo {
+	agent.UpdatedTimeRFC3339 = ""
+	agent.LastActive = 0
+	agent.UptimeMs = 0
+	agent.MemoryUsage = 0
+	agent.DiskUsage = 0
+	agent.CPUUsage = 0
+	agent.MemoryViolation = ""
+	agent.DiskViolation = ""
+	agent.CPUViolation = ""
+	agent.MicroserviceStatus = ""
+	agent.RepositoryCount = 0
+	agent.RepositoryStatus = ""
+	agent.LastStatusTimeMsUTC = 0
+	agent.ProcessedMessaged = 0
+	agent.MicroserviceMessageCount = 0
+	agent.MessageSpeed = 0
+	agent.LastCommandTimeMsUTC = 0
+	return agent
+}
+
+// PollingAgentSource lists every agent periodically, correcting whatever the other sources missed.
+type PollingAgentSource struct {
+	List func() ([]client.AgentInfo, error)
+	// Period is how often the agents are listed.
+	Period time.Duration
+	// Jitter spreads the listings by up to this fraction of the period.
+	Jitter float64
+}
+
+// Run lists the agents right away, then every period.
+func (s *PollingAgentSource) Run(ctx context.Context, reconciler *AgentReconciler) {
+	wait.JitterUntil(func() {
+		agents, err := s.List()
+		if err != nil {
+			log.G(ctx).WithError(err).Error("Error listing ioFog agents")
+			return
+		}
+		reconciler.Resync(agents)
+	}, s.Period, s.Jitter, true, ctx.Done())
+}
+
+// CallbackAgentSource reports the agents the ioFog Controller calls back about.
+// Callbacks are refused while no reconciler runs the source, such as on a standby replica.
+type CallbackAgentSource struct {
+	Lookup func(uuid string) (*client.AgentInfo, error)
+	// WaitRunning waits until the node of an agent runs.
+	WaitRunning func(ctx context.Context, uuid string) error
+	// Stop stops the node of an agent, deleting its Kubernetes node if requested.
+	Stop func(uuid string, deleteNode bool) error
+	// StartTimeout bounds how long a start waits for the node to run, defaultAgentStartTimeout when zero.
+	StartTimeout time.Duration
+
+	mutex      sync.Mutex
+	reconciler *AgentReconciler
+}
+
+// Run accepts the callbacks until the context is done.
+func (s *CallbackAgentSource) Run(ctx context.Context, reconciler *AgentReconciler) {
+	s.setReconciler(reconciler)
+	defer s.setReconciler(nil)
+
+	<-ctx.Done()
+}
+
+// AgentStarted looks the agent up, reconciles it and waits for its node to run.
+func (s *CallbackAgentSource) AgentStarted(uuid string) error {
+	reconciler, err := s.current(uuid)
+	if err != nil {
+		return err
+	}
+
+	agent, err := s.Lookup(uuid)
+	if err != nil {
+		return errors.Wrapf(err, "error looking up agent %s", uuid)
+	}
+	reconciler.Upsert(*agent)
+
+	timeout := s.StartTimeout
+	if timeout == 0 {
+		timeout = defaultAgentStartTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.WaitRunning(ctx, uuid)
+}
+
+// AgentStopped stops the node of the agent, which stays stopped until it is started again.
+func (s *CallbackAgentSource) AgentStopped(uuid string, deleteNode bool) error {
+	reconciler, err := s.current(uuid)
+	if err != nil {
+		return err
+	}
+
+	reconciler.Stop(uuid)
+	return s.Stop(uuid, deleteNode)
+}
+
+func (s *CallbackAgentSource) current(uuid string) (*AgentReconciler, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.reconciler == nil {
+		return nil, strongerrors.Unavailable(errors.Errorf("not leading, agent %s is managed by the leader", uuid))
+	}
+	return s.reconciler, nil
+}
+
+func (s *CallbackAgentSource) setReconciler(reconciler *AgentReconciler) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.reconciler = reconciler
+}
+
+// runAgentDiscovery runs the sources into a new reconciler and handles its events until the context is done.
+func runAgentDiscovery(ctx context.Context, handle func(AgentEvent), sources ...AgentSource) {
+	reconciler := NewAgentReconciler()
+
+	var wg sync.WaitGroup
+	for _, source := range sources {
+		wg.Add(1)
+		go func(source AgentSource) {
+			defer wg.Done()
+			source.Run(ctx, reconciler)
+		}(source)
+	}
+
+	reconciler.Run(ctx, handle)
+	wg.Wait()
+}
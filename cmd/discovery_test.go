@@ -0,0 +1,167 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+)
+
+func TestAgentReconciler(t *testing.T) {
+	reconciler := NewAgentReconciler()
+
+	reconciler.Resync([]client.AgentInfo{{UUID: "a", Name: "first"}, {UUID: "b", Name: "second"}})
+	// Usage figures change with every status and are not updates.
+	reconciler.Resync([]client.AgentInfo{{UUID: "a", Name: "first", CPUUsage: 12}, {UUID: "b", Name: "second"}})
+	reconciler.Upsert(client.AgentInfo{UUID: "a", Name: "renamed"})
+	reconciler.Upsert(client.AgentInfo{UUID: "b", Name: "second", MemoryLimit: 512})
+	reconciler.Remove("b")
+	reconciler.Remove("unknown")
+	// A missed callback is corrected by the next resync.
+	reconciler.Resync([]client.AgentInfo{{UUID: "c", Name: "third"}})
+
+	expected := []AgentEvent{
+		{Type: AgentAdded, Agent: client.AgentInfo{UUID: "a", Name: "first"}},
+		{Type: AgentAdded, Agent: client.AgentInfo{UUID: "b", Name: "second"}},
+		{Type: AgentUpdated, Agent: client.AgentInfo{UUID: "a", Name: "renamed"}},
+		{Type: AgentUpdated, Agent: client.AgentInfo{UUID: "b", Name: "second", MemoryLimit: 512}},
+		{Type: AgentRemoved, Agent: client.AgentInfo{UUID: "b", Name: "second", MemoryLimit: 512}},
+		{Type: AgentAdded, Agent: client.AgentInfo{UUID: "c", Name: "third"}},
+		{Type: AgentRemoved, Agent: client.AgentInfo{UUID: "a", Name: "renamed"}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var events []AgentEvent
+	reconciler.Run(ctx, func(event AgentEvent) {
+		events = append(events, event)
+		if len(events) == len(expected) {
+			cancel()
+		}
+	})
+
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %v", len(expected), len(events), events)
+	}
+	for i := range expected {
+		if events[i].Type != expected[i].Type || events[i].Agent.UUID != expected[i].Agent.UUID || agentChanged(events[i].Agent, expected[i].Agent) {
+			t.Errorf("event %d: expected %v, got %v", i, expected[i], events[i])
+		}
+	}
+	if agent, ok := reconciler.Agent("c"); !ok || agent.Name != "third" {
+		t.Errorf("expected agent c to be known, got %v", agent)
+	}
+}
+
+func TestAgentReconcilerStop(t *testing.T) {
+	reconciler := NewAgentReconciler()
+	agent := client.AgentInfo{UUID: "a", Name: "first"}
+
+	reconciler.Upsert(agent)
+	reconciler.Stop("a")
+	reconciler.Resync([]client.AgentInfo{agent})
+	if _, ok := reconciler.Agent("a"); ok {
+		t.Fatal("expected a resync to leave the stopped agent stopped")
+	}
+	reconciler.Upsert(agent)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan AgentEvent, 2)
+	go reconciler.Run(ctx, func(event AgentEvent) { events <- event })
+
+	// The event queued before stopping is dropped, the agent is added again once upserted.
+	select {
+	case event := <-events:
+		if event.Type != AgentAdded || event.Agent.UUID != "a" {
+			t.Errorf("expected the agent to be added again, got %v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the agent to be added again")
+	}
+	select {
+	case event := <-events:
+		t.Errorf("unexpected event %v", event)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestCallbackAgentSource(t *testing.T) {
+	running := make(chan string, 1)
+	var stopped []string
+	source := &CallbackAgentSource{
+		Lookup: func(uuid string) (*client.AgentInfo, error) {
+			return &client.AgentInfo{UUID: uuid, Name: "agent"}, nil
+		},
+		WaitRunning: func(ctx context.Context, uuid string) error {
+			select {
+			case <-running:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+		Stop: func(uuid string, deleteNode bool) error {
+			stopped = append(stopped, fmt.Sprintf("%s:%t", uuid, deleteNode))
+			return nil
+		},
+		StartTimeout: 5 * time.Second,
+	}
+
+	if err := source.AgentStarted("a"); !strongerrors.IsUnavailable(err) {
+		t.Fatalf("expected callbacks to be unavailable before running, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runAgentDiscovery(ctx, func(event AgentEvent) {
+			if event.Type == AgentAdded {
+				running <- event.Agent.UUID
+			}
+		}, source)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for err := source.AgentStarted("a"); strongerrors.IsUnavailable(err); err = source.AgentStarted("a") {
+		if time.Now().After(deadline) {
+			t.Fatalf("error starting agent: %v", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// The agent is known now, starting it again waits for a node which is not reported running.
+	source.StartTimeout = 10 * time.Millisecond
+	if err := source.AgentStarted("a"); err == nil {
+		t.Fatal("expected the start to fail when the node does not run")
+	}
+	if err := source.AgentStopped("a", true); err != nil {
+		t.Fatal(err)
+	}
+	if len(stopped) != 1 || stopped[0] != "a:true" {
+		t.Errorf("expected the node of a to be stopped and deleted, got %v", stopped)
+	}
+
+	cancel()
+	<-done
+	if err := source.AgentStopped("a", false); !strongerrors.IsUnavailable(err) {
+		t.Errorf("expected callbacks to be unavailable after stopping, got %v", err)
+	}
+}
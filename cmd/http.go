@@ -15,11 +15,15 @@ package cmd
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/vkubelet"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/vkubelet/api"
 	"github.com/pkg/errors"
 	"net"
 	"net/http"
+	"os"
 )
 
 func serveHTTP(ctx context.Context, s *http.Server, l net.Listener, name string) {
@@ -33,17 +37,149 @@ func serveHTTP(ctx context.Context, s *http.Server, l net.Listener, name string)
 	l.Close()
 }
 
-func setupControllerServer(ctx context.Context, startFunc func(nodeId string), stopFun func(nodeId string, deleteNode bool)) (*http.Server, error) {
-	l, err := net.Listen("tcp", "localhost:1234")
-	if err != nil {
-		return nil, errors.Wrap(err, "could not setup listener for ioFog controller http server")
+// ControllerServerOptions configures the server receiving the callbacks of the ioFog Controller.
+type ControllerServerOptions struct {
+	Address  string
+	CertPath string
+	KeyPath  string
+	Token    string
+	HMACKey  string
+}
+
+func setupControllerServer(ctx context.Context, opts ControllerServerOptions, callbacks api.FogControllerCallbacks) (*http.Server, error) {
+	var l net.Listener
+	if opts.CertPath == "" || opts.KeyPath == "" {
+		listener, err := net.Listen("tcp", opts.Address)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not setup listener for ioFog controller http server")
+		}
+		l = listener
+	} else {
+		tlsCfg, err := loadTLSConfig(opts.CertPath, opts.KeyPath)
+		if err != nil {
+			return nil, err
+		}
+		listener, err := tls.Listen("tcp", opts.Address, tlsCfg)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not setup listener for ioFog controller http server")
+		}
+		l = listener
+	}
+
+	authenticator := &api.CallbackAuthenticator{
+		Token:   opts.Token,
+		HMACKey: []byte(opts.HMACKey),
+	}
+	if !authenticator.Enabled() {
+		log.G(ctx).Warn("Neither IOFOG_CALLBACK_TOKEN nor IOFOG_CALLBACK_HMAC_KEY is set, ioFog controller callbacks are not authenticated")
 	}
 
 	mux := http.NewServeMux()
-	vkubelet.AttachFogControllerRoutes(mux, startFunc, stopFun)
+	vkubelet.AttachFogControllerRoutes(mux, vkubelet.FogControllerConfig{
+		Callbacks:     callbacks,
+		Authenticator: authenticator,
+		Operations:    api.NewOperationTracker(),
+	})
 	s := &http.Server{
 		Handler: mux,
 	}
 	go serveHTTP(ctx, s, l, "iofog controller")
 	return s, nil
 }
+
+func loadTLSConfig(certPath, keyPath string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading tls certs")
+	}
+
+	return &tls.Config{
+		Certificates:             []tls.Certificate{cert},
+		MinVersion:               tls.VersionTLS12,
+		PreferServerCipherSuites: true,
+	}, nil
+}
+
+// setupKubeletServer serves the kubelet API of every node on the daemon port.
+// Requests are routed to the node they target by the router.
+func setupKubeletServer(ctx context.Context, router *vkubelet.ProviderRouter, port int32) (*http.Server, error) {
+	l, err := kubeletListener(ctx, port)
+	if err != nil {
+		return nil, err
+	}
+	s := &http.Server{
+		Handler: kubeletHandler(router),
+	}
+	go serveHTTP(ctx, s, l, "kubelet")
+	return s, nil
+}
+
+// setupNodeKubeletServer serves the kubelet API on the port advertised by a node, where the requests without a pod,
+// such as /stats/summary, are meant for that node.
+func setupNodeKubeletServer(ctx context.Context, router *vkubelet.ProviderRouter, nodeName string, port int32) (*http.Server, error) {
+	l, err := kubeletListener(ctx, port)
+	if err != nil {
+		return nil, err
+	}
+	s := &http.Server{
+		Handler: vkubelet.NodeHandler(nodeName, kubeletHandler(router)),
+	}
+	go serveHTTP(ctx, s, l, "kubelet "+nodeName)
+	return s, nil
+}
+
+func kubeletHandler(router *vkubelet.ProviderRouter) http.Handler {
+	mux := http.NewServeMux()
+	vkubelet.AttachPodRoutes(router, mux)
+	vkubelet.AttachMetricsRoutes(router, mux)
+	return mux
+}
+
+// kubeletListener listens on a port of the kubelet API, over TLS when APISERVER_CERT_LOCATION and
+// APISERVER_KEY_LOCATION are set.
+func kubeletListener(ctx context.Context, port int32) (net.Listener, error) {
+	addr := fmt.Sprintf(":%d", port)
+	certPath := os.Getenv("APISERVER_CERT_LOCATION")
+	keyPath := os.Getenv("APISERVER_KEY_LOCATION")
+
+	if certPath == "" || keyPath == "" {
+		log.G(ctx).Warn("TLS certificates not provided, serving the kubelet API over plain HTTP")
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, errors.Wrap(err, "error setting up listener for kubelet http server")
+		}
+		return l, nil
+	}
+	tlsCfg, err := loadTLSConfig(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	l, err := tls.Listen("tcp", addr, tlsCfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error setting up listener for kubelet http server")
+	}
+	return l, nil
+}
+
+// setupAdmissionServer serves the validating webhook of the pods over TLS, as the Kubernetes API server requires.
+func setupAdmissionServer(ctx context.Context, opts AdmissionServerOptions, validate api.PodValidator) (*http.Server, error) {
+	if opts.CertPath == "" || opts.KeyPath == "" {
+		return nil, errors.New("the validating webhook requires a TLS certificate and key")
+	}
+	tlsCfg, err := loadTLSConfig(opts.CertPath, opts.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+	l, err := tls.Listen("tcp", opts.Address, tlsCfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "error setting up listener for admission http server")
+	}
+
+	mux := http.NewServeMux()
+	vkubelet.AttachAdmissionRoutes(mux, validate)
+	s := &http.Server{
+		Handler: mux,
+	}
+	go serveHTTP(ctx, s, l, "admission")
+	return s, nil
+}
@@ -0,0 +1,235 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	coordinationv1beta1 "k8s.io/api/coordination/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coordinationclient "k8s.io/client-go/kubernetes/typed/coordination/v1beta1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	defaultLeaseName          = "iofog-kubelet"
+	defaultLeaseNamespace     = "default"
+	defaultLeaseDuration      = 15 * time.Second
+	defaultLeaseRenewDeadline = 10 * time.Second
+	defaultLeaseRetryPeriod   = 2 * time.Second
+)
+
+// LeaderElectionOptions configures the election of the replica which registers the nodes.
+type LeaderElectionOptions struct {
+	Enabled       bool
+	LeaseName     string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+var (
+	leaderElection = LeaderElectionOptions{}
+
+	leadingLock sync.RWMutex
+	leading     bool
+)
+
+// isLeading reports whether this replica currently manages the nodes.
+func isLeading() bool {
+	leadingLock.RLock()
+	defer leadingLock.RUnlock()
+	return leading
+}
+
+func setLeading(value bool) {
+	leadingLock.Lock()
+	defer leadingLock.Unlock()
+	leading = value
+}
+
+// runAsLeader runs lead every time this replica is elected, until the context is done.
+// The context passed to lead is cancelled when the leadership is lost, after which stop is called.
+func runAsLeader(ctx context.Context, opts LeaderElectionOptions, lead func(ctx context.Context), stop func()) error {
+	if !opts.Enabled {
+		setLeading(true)
+		lead(ctx)
+		return nil
+	}
+
+	k8sClient, err := newClient(kubeConfig)
+	if err != nil {
+		return err
+	}
+
+	identity, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	identity = fmt.Sprintf("%s_%d", identity, time.Now().UnixNano())
+
+	namespace := kubeNamespace
+	if namespace == corev1.NamespaceAll {
+		namespace = defaultLeaseNamespace
+	}
+
+	lock := &leaseLock{
+		leaseMeta: metav1.ObjectMeta{Namespace: namespace, Name: opts.LeaseName},
+		client:    k8sClient.CoordinationV1beta1(),
+		identity:  identity,
+	}
+
+	logger := log.G(ctx).WithField("lease", namespace+"/"+opts.LeaseName).WithField("identity", identity)
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: opts.LeaseDuration,
+		RenewDeadline: opts.RenewDeadline,
+		RetryPeriod:   opts.RetryPeriod,
+		Name:          opts.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				logger.Info("Started leading, starting the nodes")
+				setLeading(true)
+				lead(ctx)
+			},
+			OnStoppedLeading: func() {
+				if !isLeading() {
+					return
+				}
+				logger.Warn("Stopped leading, stopping the nodes")
+				setLeading(false)
+				stop()
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					logger.WithField("leader", leader).Info("Waiting for the leader to step down")
+				}
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Campaign again after losing the leadership so that this replica can take over later.
+	for ctx.Err() == nil {
+		elector.Run(ctx)
+	}
+	return nil
+}
+
+// leaseLock implements a leader election lock on a coordination.k8s.io Lease.
+type leaseLock struct {
+	leaseMeta metav1.ObjectMeta
+	client    coordinationclient.LeasesGetter
+	identity  string
+	lease     *coordinationv1beta1.Lease
+}
+
+// Get returns the election record stored in the Lease.
+func (l *leaseLock) Get() (*resourcelock.LeaderElectionRecord, error) {
+	lease, err := l.client.Leases(l.leaseMeta.Namespace).Get(l.leaseMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	l.lease = lease
+	return leaseSpecToRecord(&lease.Spec), nil
+}
+
+// Create creates the Lease holding the election record.
+func (l *leaseLock) Create(ler resourcelock.LeaderElectionRecord) error {
+	lease, err := l.client.Leases(l.leaseMeta.Namespace).Create(&coordinationv1beta1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      l.leaseMeta.Name,
+			Namespace: l.leaseMeta.Namespace,
+		},
+		Spec: recordToLeaseSpec(&ler),
+	})
+	if err != nil {
+		return err
+	}
+	l.lease = lease
+	return nil
+}
+
+// Update writes the election record to the Lease read by the last Get.
+func (l *leaseLock) Update(ler resourcelock.LeaderElectionRecord) error {
+	if l.lease == nil {
+		return errors.New("lease not initialized, call get or create first")
+	}
+	updated := l.lease.DeepCopy()
+	updated.Spec = recordToLeaseSpec(&ler)
+
+	lease, err := l.client.Leases(l.leaseMeta.Namespace).Update(updated)
+	if err != nil {
+		return err
+	}
+	l.lease = lease
+	return nil
+}
+
+// RecordEvent logs the leader election events, Leases have no event recorder.
+func (l *leaseLock) RecordEvent(s string) {
+	log.L.WithField("lease", l.Describe()).Debugf("%s %s", l.identity, s)
+}
+
+// Describe returns the namespace and name of the Lease.
+func (l *leaseLock) Describe() string {
+	return fmt.Sprintf("%v/%v", l.leaseMeta.Namespace, l.leaseMeta.Name)
+}
+
+// Identity returns the identity of this replica.
+func (l *leaseLock) Identity() string {
+	return l.identity
+}
+
+func leaseSpecToRecord(spec *coordinationv1beta1.LeaseSpec) *resourcelock.LeaderElectionRecord {
+	record := &resourcelock.LeaderElectionRecord{}
+	if spec.HolderIdentity != nil {
+		record.HolderIdentity = *spec.HolderIdentity
+	}
+	if spec.LeaseDurationSeconds != nil {
+		record.LeaseDurationSeconds = int(*spec.LeaseDurationSeconds)
+	}
+	if spec.LeaseTransitions != nil {
+		record.LeaderTransitions = int(*spec.LeaseTransitions)
+	}
+	if spec.AcquireTime != nil {
+		record.AcquireTime = metav1.Time{Time: spec.AcquireTime.Time}
+	}
+	if spec.RenewTime != nil {
+		record.RenewTime = metav1.Time{Time: spec.RenewTime.Time}
+	}
+	return record
+}
+
+func recordToLeaseSpec(ler *resourcelock.LeaderElectionRecord) coordinationv1beta1.LeaseSpec {
+	leaseDurationSeconds := int32(ler.LeaseDurationSeconds)
+	leaseTransitions := int32(ler.LeaderTransitions)
+	return coordinationv1beta1.LeaseSpec{
+		HolderIdentity:       &ler.HolderIdentity,
+		LeaseDurationSeconds: &leaseDurationSeconds,
+		AcquireTime:          &metav1.MicroTime{Time: ler.AcquireTime.Time},
+		RenewTime:            &metav1.MicroTime{Time: ler.RenewTime.Time},
+		LeaseTransitions:     &leaseTransitions,
+	}
+}
@@ -0,0 +1,42 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+func TestLeaseRecordConversion(t *testing.T) {
+	now := time.Now().Truncate(time.Microsecond)
+	record := resourcelock.LeaderElectionRecord{
+		HolderIdentity:       "replica",
+		LeaseDurationSeconds: 15,
+		AcquireTime:          metav1.NewTime(now.Add(-time.Minute)),
+		RenewTime:            metav1.NewTime(now),
+		LeaderTransitions:    3,
+	}
+
+	spec := recordToLeaseSpec(&record)
+	converted := leaseSpecToRecord(&spec)
+	if converted.HolderIdentity != "replica" || converted.LeaseDurationSeconds != 15 || converted.LeaderTransitions != 3 {
+		t.Fatalf("unexpected record: %+v", converted)
+	}
+	if !converted.AcquireTime.Equal(&record.AcquireTime) || !converted.RenewTime.Equal(&record.RenewTime) {
+		t.Fatalf("unexpected record times: %+v", converted)
+	}
+}
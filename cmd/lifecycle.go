@@ -0,0 +1,122 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+)
+
+const (
+	defaultAgentRemovalGracePeriod = 5 * time.Minute
+	defaultNodeDrainTimeout        = 5 * time.Minute
+)
+
+// NodeRemover deletes the nodes of the removed agents once their grace period is over, leaving the agents a chance to
+// come back. The pods of a node are evicted before it is deleted, as far as their disruption budgets allow.
+type NodeRemover struct {
+	// GracePeriod is how long the node of a removed agent is kept.
+	GracePeriod time.Duration
+	// DrainTimeout bounds how long the evictions refused by disruption budgets are retried.
+	DrainTimeout time.Duration
+	Drain        func(ctx context.Context, nodeId string) error
+	Remove       func(nodeId string) error
+
+	mutex   sync.Mutex
+	pending map[string]*pendingRemoval
+}
+
+type pendingRemoval struct {
+	cancel context.CancelFunc
+}
+
+// Schedule removes the node of an agent once the grace period is over, unless cancelled before.
+func (r *NodeRemover) Schedule(ctx context.Context, nodeId string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.pending[nodeId]; ok {
+		return false
+	}
+	if r.pending == nil {
+		r.pending = make(map[string]*pendingRemoval)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	removal := &pendingRemoval{cancel: cancel}
+	r.pending[nodeId] = removal
+	go r.remove(ctx, nodeId, removal)
+	return true
+}
+
+// Cancel keeps the node of an agent which came back.
+func (r *NodeRemover) Cancel(nodeId string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	removal, ok := r.pending[nodeId]
+	if ok {
+		removal.cancel()
+		delete(r.pending, nodeId)
+	}
+	return ok
+}
+
+// Pending reports whether the node of an agent is waiting to be removed.
+func (r *NodeRemover) Pending(nodeId string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	_, ok := r.pending[nodeId]
+	return ok
+}
+
+func (r *NodeRemover) remove(ctx context.Context, nodeId string, removal *pendingRemoval) {
+	defer r.done(nodeId, removal)
+
+	logger := log.G(ctx).WithField("nodeId", nodeId)
+	logger.WithField("gracePeriod", r.GracePeriod).Info("Agent removed, deleting its node after the grace period")
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(r.GracePeriod):
+	}
+
+	drainContext, cancel := context.WithTimeout(ctx, r.DrainTimeout)
+	err := r.Drain(drainContext, nodeId)
+	cancel()
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil && !strongerrors.IsNotFound(err) {
+		logger.WithError(err).Warn("Deleting the node before all its pods could be evicted")
+	}
+
+	if err := r.Remove(nodeId); err != nil && !strongerrors.IsNotFound(err) {
+		logger.WithError(err).Warn("Error deleting node")
+	}
+}
+
+func (r *NodeRemover) done(nodeId string, removal *pendingRemoval) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	removal.cancel()
+	if r.pending[nodeId] == removal {
+		delete(r.pending, nodeId)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNodeRemover(t *testing.T) {
+	removed := make(chan string, 2)
+	drained := make(chan string, 2)
+	remover := &NodeRemover{
+		GracePeriod:  50 * time.Millisecond,
+		DrainTimeout: time.Second,
+		Drain: func(ctx context.Context, nodeId string) error {
+			drained <- nodeId
+			return nil
+		},
+		Remove: func(nodeId string) error {
+			removed <- nodeId
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// An agent coming back within the grace period keeps its node.
+	if !remover.Schedule(ctx, "back") || remover.Schedule(ctx, "back") {
+		t.Fatal("expected the removal to be scheduled once")
+	}
+	if !remover.Cancel("back") {
+		t.Fatal("expected the removal to be cancelled")
+	}
+
+	remover.Schedule(ctx, "gone")
+	select {
+	case nodeId := <-removed:
+		if nodeId != "gone" {
+			t.Fatalf("expected the node of the removed agent to be deleted, got %s", nodeId)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the node to be deleted")
+	}
+	if nodeId := <-drained; nodeId != "gone" {
+		t.Fatalf("expected the node to be drained first, got %s", nodeId)
+	}
+
+	select {
+	case nodeId := <-removed:
+		t.Fatalf("expected the node of the agent which came back to be kept, %s was deleted", nodeId)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if remover.Pending("gone") {
+		t.Error("expected the removal to be done")
+	}
+}
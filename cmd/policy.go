@@ -0,0 +1,164 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers/iofog"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// nodePolicyConfigMapKey is the key of the ConfigMap holding the node policy.
+	nodePolicyConfigMapKey = "policy.yaml"
+	// nodePolicyFilePeriod is how often the node policy file is read for changes.
+	nodePolicyFilePeriod = 10 * time.Second
+)
+
+var (
+	nodePolicyFile      string
+	nodePolicyConfigMap string
+	nodePolicies        = &nodePolicyHolder{}
+)
+
+// nodePolicyHolder keeps the current node policy, the previous policy is kept when a new one is invalid.
+type nodePolicyHolder struct {
+	mutex   sync.RWMutex
+	policy  *iofog.NodePolicy
+	data    []byte
+	changed func()
+}
+
+// Get returns the current node policy, nil when there is none.
+func (h *nodePolicyHolder) Get() *iofog.NodePolicy {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.policy
+}
+
+// set parses and installs a policy, calling changed when it differs from the current one.
+func (h *nodePolicyHolder) set(ctx context.Context, data []byte, source string) {
+	logger := log.G(ctx).WithField("source", source)
+
+	h.mutex.Lock()
+	if h.data != nil && bytes.Equal(h.data, data) {
+		h.mutex.Unlock()
+		return
+	}
+
+	policy, err := iofog.ParseNodePolicy(data)
+	if err != nil {
+		h.mutex.Unlock()
+		logger.WithError(err).Error("Invalid node policy, keeping the previous one")
+		return
+	}
+	h.policy = policy
+	h.data = data
+	h.mutex.Unlock()
+
+	logger.WithField("rules", len(policy.Rules)).Info("Applying node policy")
+	if h.changed != nil {
+		h.changed()
+	}
+}
+
+// watchFile reads the policy from a file periodically until the context is done.
+// A missing file is an empty policy.
+func (h *nodePolicyHolder) watchFile(ctx context.Context, path string) {
+	wait.Until(func() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			log.G(ctx).WithError(err).WithField("source", path).Error("Error reading node policy")
+			return
+		}
+		if data == nil {
+			data = []byte{}
+		}
+		h.set(ctx, data, path)
+	}, nodePolicyFilePeriod, ctx.Done())
+}
+
+// watchConfigMap reads the policy from a ConfigMap, as it changes, until the context is done.
+// A missing ConfigMap is an empty policy.
+func (h *nodePolicyHolder) watchConfigMap(ctx context.Context, configMaps corev1client.ConfigMapInterface, name string) {
+	selector := fields.OneTermEqualSelector("metadata.name", name).String()
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = selector
+			return configMaps.List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = selector
+			return configMaps.Watch(options)
+		},
+	}
+
+	observe := func(obj interface{}) {
+		if configMap, ok := obj.(*corev1.ConfigMap); ok {
+			h.set(ctx, []byte(configMap.Data[nodePolicyConfigMapKey]), "configmap/"+name)
+		}
+	}
+	_, informer := cache.NewInformer(listWatch, &corev1.ConfigMap{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: observe,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			observe(newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			h.set(ctx, []byte{}, "configmap/"+name)
+		},
+	})
+	informer.Run(ctx.Done())
+}
+
+// runNodePolicy keeps the node policy in sync with its file or ConfigMap until the context is done.
+func runNodePolicy(ctx context.Context) error {
+	nodePolicies.changed = refreshAllNodes
+
+	switch {
+	case nodePolicyFile != "":
+		go nodePolicies.watchFile(ctx, nodePolicyFile)
+	case nodePolicyConfigMap != "":
+		k8sClient, err := newClient(kubeConfig)
+		if err != nil {
+			return err
+		}
+		namespace := kubeNamespace
+		if namespace == corev1.NamespaceAll {
+			namespace = corev1.NamespaceDefault
+		}
+		go nodePolicies.watchConfigMap(ctx, k8sClient.CoreV1().ConfigMaps(namespace), nodePolicyConfigMap)
+	}
+	return nil
+}
+
+// refreshAllNodes updates every node, such as after the node policy changed.
+func refreshAllNodes() {
+	for _, nodeId := range nodeSupervisor.NodeIDs() {
+		nodeSupervisor.Refresh(nodeId)
+	}
+}
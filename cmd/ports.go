@@ -0,0 +1,84 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const defaultNodePorts = "10251-10750"
+
+// PortPool hands out the kubelet ports of the nodes from a range, so that every node is addressable on the shared
+// pod IP and the requests without a pod, such as /stats/summary, reach the node they are meant for.
+type PortPool struct {
+	mutex sync.Mutex
+	first int32
+	last  int32
+	nodes map[int32]string
+}
+
+// ParsePortPool parses a range of ports such as 10251-10750.
+func ParsePortPool(ports string) (*PortPool, error) {
+	bounds := strings.SplitN(ports, "-", 2)
+	if len(bounds) != 2 {
+		return nil, errors.Errorf("invalid port range %q, expected first-last", ports)
+	}
+	first, err := strconv.ParseUint(strings.TrimSpace(bounds[0]), 10, 16)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid first port of range %q", ports)
+	}
+	last, err := strconv.ParseUint(strings.TrimSpace(bounds[1]), 10, 16)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid last port of range %q", ports)
+	}
+	if first == 0 || first > last {
+		return nil, errors.Errorf("invalid port range %q", ports)
+	}
+	return &PortPool{first: int32(first), last: int32(last), nodes: make(map[int32]string)}, nil
+}
+
+// Acquire returns the port of a node, the lowest free one unless the node already holds one.
+func (p *PortPool) Acquire(nodeId string) (int32, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for port, holder := range p.nodes {
+		if holder == nodeId {
+			return port, nil
+		}
+	}
+	for port := p.first; port <= p.last; port++ {
+		if _, ok := p.nodes[port]; !ok {
+			p.nodes[port] = nodeId
+			return port, nil
+		}
+	}
+	return 0, errors.Errorf("no kubelet port left in %d-%d for node %s", p.first, p.last, nodeId)
+}
+
+// Release frees the port of a node.
+func (p *PortPool) Release(nodeId string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for port, holder := range p.nodes {
+		if holder == nodeId {
+			delete(p.nodes, port)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import "testing"
+
+func TestPortPool(t *testing.T) {
+	for _, ports := range []string{"10251", "10300-10251", "0-10", "a-b"} {
+		if _, err := ParsePortPool(ports); err == nil {
+			t.Errorf("expected %q to be invalid", ports)
+		}
+	}
+
+	pool, err := ParsePortPool("10251-10252")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquire := func(nodeId string, expected int32) {
+		t.Helper()
+		port, err := pool.Acquire(nodeId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if port != expected {
+			t.Fatalf("expected port %d for %s, got %d", expected, nodeId, port)
+		}
+	}
+
+	acquire("first", 10251)
+	acquire("second", 10252)
+	acquire("first", 10251)
+	if _, err := pool.Acquire("third"); err == nil {
+		t.Fatal("expected the range to be exhausted")
+	}
+
+	// A released port is handed out again.
+	pool.Release("first")
+	acquire("third", 10251)
+}
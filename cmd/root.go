@@ -18,20 +18,22 @@ import (
 	"fmt"
 	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/apps"
 	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers/iofog"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/providers/register"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/vkubelet"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/vkubelet/api"
 	"k8s.io/apimachinery/pkg/fields"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/cpuguy83/strongerrors"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
 	logruslogger "github.com/eclipse-iofog/iofog-kubelet/v2/log/logrus"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/manager"
@@ -42,28 +44,24 @@ import (
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"go.opencensus.io/stats/view"
 	octrace "go.opencensus.io/trace"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeinformers "k8s.io/client-go/informers"
 )
 
-type IOFogKubelet struct {
-	KubeletInstance   *vkubelet.Server
-	NodeContextCancel context.CancelFunc
-	NodeContext       context.Context
-}
-
 const (
 	defaultDaemonPort = "10250"
 	// kubeSharedInformerFactoryDefaultResync is the default resync period used by the shared informer factories for Kubernetes resources.
 	// It is set to the same value used by the Kubelet, and can be overridden via the "--full-resync-period" flag.
 	// https://github.com/kubernetes/kubernetes/blob/v1.12.2/pkg/kubelet/apis/config/v1beta1/defaults.go#L51
 	kubeSharedInformerFactoryDefaultResync = 1 * time.Minute
+	// logsSourceDocker reads the logs of the microservices from the Docker daemon of their agent.
+	logsSourceDocker = "docker"
 )
 
 var (
-	deleteNodeLock                  sync.Mutex
 	controllerToken                 string
 	controllerUrl                   string
 	controller                      apps.IofogController
@@ -77,9 +75,27 @@ var (
 	taint                           *corev1.Taint
 	kubeSharedInformerFactoryResync time.Duration
 	podSyncWorkers                  int
-	ioFogKubelets                   map[string]*IOFogKubelet
+	nodeSupervisor                  = NewNodeSupervisor(runKubelet)
+	nodeRemover                     = &NodeRemover{Drain: nodeSupervisor.Drain, Remove: func(nodeId string) error { return shutdownKubelet(nodeId, true) }}
+	kubeletRouter                   = vkubelet.NewProviderRouter()
 	configMapName                   string
-	iofogNodes                      []client.AgentInfo
+	controllerServerOptions         ControllerServerOptions
+	admissionServerOptions          AdmissionServerOptions
+	agentResyncPeriod               time.Duration
+	nodeStatusReportFrequency       time.Duration
+	nodeLeaseDuration               time.Duration
+	podEvictionTimeout              time.Duration
+	applicationController           bool
+	agentResyncJitter               float64
+	agentMaxAge                     time.Duration
+	agentCache                      *iofog.AgentCache
+	catalogCache                    *iofog.CatalogCache
+	catalogMaxAge                   time.Duration
+	logsSource                      string
+	nodePortRange                   string
+	nodePorts                       *PortPool
+	logsDockerPort                  int
+	agentCallbacks                  = &CallbackAgentSource{Lookup: getIOFogNode, WaitRunning: nodeSupervisor.WaitRunning, Stop: stopAgentNode}
 	userTraceExporters              []string
 	userTraceConfig                 = TracingExporterOptions{Tags: make(map[string]string)}
 	traceSampler                    string
@@ -97,60 +113,145 @@ This allows users to schedule kubernetes workloads on nodes that aren't running
 	Run: func(cmd *cobra.Command, args []string) {
 		defer rootContextCancel()
 
-		controllerServer, err := setupControllerServer(rootContext, startKubelet, shutdownKubelet)
-		if err != nil {
-			log.L.WithError(err).Fatal("Error initializing controller server")
-		}
-
-		ioFogKubelets = make(map[string]*IOFogKubelet)
+		agentCache = iofog.NewAgentCache(agentMaxAge)
+		catalogCache = iofog.NewCatalogCache(listCatalog, catalogMaxAge)
 
 		controller = apps.IofogController{
 			Token:    controllerToken,
 			Endpoint: controllerUrl,
 		}
 
+		// The callbacks look agents up with the client, it exists before the callback server starts.
+		var err error
 		controllerClient, err = client.NewWithToken(client.Options{ Endpoint: controllerUrl }, controllerToken)
 		if err != nil {
 			log.L.WithError(err).Fatal("Error initializing controller client", err)
 		}
 
-		iofogNodes = getIOFogNodes()
-		for _, iofog := range iofogNodes {
-			go startKubelet(iofog.UUID)
+		controllerServerOptions.Token = os.Getenv("IOFOG_CALLBACK_TOKEN")
+		controllerServerOptions.HMACKey = os.Getenv("IOFOG_CALLBACK_HMAC_KEY")
+		controllerServer, err := setupControllerServer(rootContext, controllerServerOptions, api.FogControllerCallbacks{
+			Start:       agentCallbacks.AgentStarted,
+			Stop:        agentCallbacks.AgentStopped,
+			Status:      func() interface{} { return nodeSupervisor.Status() },
+			AgentExists: agentExists,
+			NodeRunning: nodeSupervisor.Has,
+		})
+		if err != nil {
+			log.L.WithError(err).Fatal("Error initializing controller server")
+		}
+
+		kubeletServer, err := setupKubeletServer(rootContext, kubeletRouter, getDaemonPort())
+		if err != nil {
+			log.L.WithError(err).Fatal("Error initializing kubelet server")
+		}
+
+		var admissionServer *http.Server
+		if admissionServerOptions.Address != "" {
+			admissionServer, err = setupAdmissionServer(rootContext, admissionServerOptions, validateIofogPod)
+			if err != nil {
+				log.L.WithError(err).Fatal("Error initializing admission server")
+			}
+		}
+
+		if nodePolicyFile != "" && nodePolicyConfigMap != "" {
+			log.L.Fatal("Only one of --node-policy-file and --node-policy-config-map can be set")
+		}
+		if err := runNodePolicy(rootContext); err != nil {
+			log.L.WithError(err).Fatal("Error loading node policy")
 		}
-		ioFogSyncLoop(rootContext)
 
 		sig := make(chan os.Signal, 1)
 		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
 		go func() {
 			<-sig
 			controllerServer.Close()
-			shutdownAll()
+			kubeletServer.Close()
+			if admissionServer != nil {
+				admissionServer.Close()
+			}
 			rootContextCancel()
 		}()
-		select {}
+
+		// Only the elected replica registers the nodes and deploys their pods.
+		if err := runAsLeader(rootContext, leaderElection, runNodes, shutdownAll); err != nil {
+			log.L.WithError(err).Fatal("Error running leader election")
+		}
+		shutdownAll()
 	},
 }
 
-func startKubelet(nodeId string) {
-	_, ok := ioFogKubelets[nodeId]
-	if ok {
-		log.L.Warn("Node has already started ", nodeId)
-		return
+// runNodes starts a kubelet for every ioFog agent and keeps them in sync with the agents until the context is done.
+// The agents are discovered from the callbacks of the ioFog Controller, and periodically listed to correct missed callbacks.
+func runNodes(ctx context.Context) {
+	if applicationController {
+		go func() {
+			if err := runApplicationController(ctx); err != nil {
+				log.G(ctx).WithError(err).Error("Error running the application controller")
+			}
+		}()
+	}
+
+	polling := &PollingAgentSource{
+		List:   listIOFogNodes,
+		Period: agentResyncPeriod,
+		Jitter: agentResyncJitter,
+	}
+	runAgentDiscovery(ctx, func(event AgentEvent) {
+		handleAgentEvent(ctx, event)
+	}, polling, agentCallbacks)
+}
+
+// handleAgentEvent starts, refreshes or stops the node of an agent.
+func handleAgentEvent(ctx context.Context, event AgentEvent) {
+	logger := log.G(ctx).WithField("nodeId", event.Agent.UUID).WithField("agent", event.Agent.Name)
+	switch event.Type {
+	case AgentAdded:
+		if nodeRemover.Cancel(event.Agent.UUID) {
+			logger.Info("Agent came back, keeping its node")
+			nodeSupervisor.Refresh(event.Agent.UUID)
+			return
+		}
+		logger.Info("Agent added, starting node")
+		if err := startKubelet(event.Agent.UUID); err != nil {
+			logger.WithError(err).Warn("Error starting node")
+		}
+	case AgentUpdated:
+		logger.Debug("Agent updated, refreshing node")
+		nodeSupervisor.Refresh(event.Agent.UUID)
+	case AgentRemoved:
+		// The node turns Unknown and unreachable until it is deleted, its pods are evicted before.
+		if nodeSupervisor.Has(event.Agent.UUID) {
+			nodeRemover.Schedule(ctx, event.Agent.UUID)
+			nodeSupervisor.Refresh(event.Agent.UUID)
+		}
 	}
+}
 
-	kubelet := new(IOFogKubelet)
-	ioFogKubelets[nodeId] = kubelet
+// startKubelet starts supervising the kubelet of a node.
+func startKubelet(nodeId string) error {
+	if !isLeading() {
+		return strongerrors.Unavailable(errors.Errorf("not leading, node %s is managed by the leader", nodeId))
+	}
 
-	nodeContext, nodeContextCancel := context.WithCancel(rootContext)
-	kubelet.NodeContextCancel = nodeContextCancel
-	kubelet.NodeContext = nodeContext
+	if !nodeSupervisor.Start(rootContext, nodeId) {
+		log.L.Debug("Node has already started ", nodeId)
+	}
+	return nil
+}
 
+// runKubelet runs the kubelet of a node until the context is done.
+// Errors are returned to the supervisor, which restarts the node.
+func runKubelet(nodeContext context.Context, nodeId string, started func(NodeDeleter)) error {
 	nodeName := nodeName(nodeId)
 
+	// The informers, the store and the loops of the kubelet stop when it returns, a restart starts new ones.
+	attemptContext, cancel := context.WithCancel(nodeContext)
+	defer cancel()
+
 	k8sClient, err := newClient(kubeConfig)
 	if err != nil {
-		log.L.WithError(err).Fatal("Error creating kubernetes client")
+		return errors.Wrap(err, "error creating kubernetes client")
 	}
 
 	// Create a shared informer factory for Kubernetes pods in the current namespace (if specified) and scheduled to the current node.
@@ -169,44 +270,64 @@ func startKubelet(nodeId string) {
 	// Create a new instance of the resource manager that uses the listers above for pods, secrets and config maps.
 	rm, err := manager.NewResourceManager(podInformer.Lister(), secretInformer.Lister(), configMapInformer.Lister())
 	if err != nil {
-		log.L.WithError(err).Fatal("Error initializing resource manager")
+		return errors.Wrap(err, "error initializing resource manager")
 	}
 
 	// Start the shared informer factory for pods.
-	go podInformerFactory.Start(nodeContext.Done())
+	go podInformerFactory.Start(attemptContext.Done())
 	// Start the shared informer factory for secrets and configmaps.
-	go scmInformerFactory.Start(nodeContext.Done())
+	go scmInformerFactory.Start(attemptContext.Done())
 
-	daemonPortEnv := getEnv("KUBELET_PORT", defaultDaemonPort)
-	daemonPort, err := strconv.Atoi(daemonPortEnv)
+	configMap := k8sClient.CoreV1().ConfigMaps(kubeNamespace)
+	store, err := api.NewKeyValueStore(configMap, configMapName)
 	if err != nil {
-		log.L.WithError(err).WithField("value", daemonPortEnv).Fatal("Invalid value from KUBELET_PORT in environment")
+		return errors.Wrap(err, "error initializing ConfigMap")
 	}
+	// Keep the store in sync with the entries written by the other nodes.
+	go store.Run(attemptContext)
 
-	configMap := k8sClient.CoreV1().ConfigMaps(kubeNamespace)
-	store, err := api.NewKeyValueStore(configMap, configMapName)
+	// Every node advertises a kubelet port of its own on the shared pod IP.
+	nodePort, err := nodePorts.Acquire(nodeId)
+	if err != nil {
+		return err
+	}
+	nodeServer, err := setupNodeKubeletServer(attemptContext, kubeletRouter, nodeName, nodePort)
 	if err != nil {
-		log.L.WithError(err).Fatal("Error initializing ConfigMap", err)
+		nodePorts.Release(nodeId)
+		return err
 	}
+	// The port is only handed out again once the server no longer listens on it.
+	defer func() {
+		cancel()
+		nodeServer.Close()
+		nodePorts.Release(nodeId)
+	}()
 
 	initConfig := register.InitConfig{
 		NodeName:         nodeName,
 		OperatingSystem:  operatingSystem,
 		ResourceManager:  rm,
-		DaemonPort:       int32(daemonPort),
+		DaemonPort:       nodePort,
 		InternalIP:       os.Getenv("VKUBELET_POD_IP"),
 		Controller:       controller,
 		ControllerClient: controllerClient,
 		NodeId:           nodeId,
 		Store:            store,
+		NodePolicy:       nodePolicies.Get,
+		Agents:           agentCache,
+		Catalog:          catalogCache,
+		Logs:             newLogSource(nodeId),
 	}
 
 	providerInstance, err := register.GetProvider(provider, initConfig)
 	if err != nil {
-		log.L.WithError(err).Fatal("Error initializing provider")
+		return errors.Wrap(err, "error initializing provider")
 	}
 
-	kubelet.KubeletInstance = vkubelet.New(vkubelet.Config{
+	kubeletRouter.Add(nodeName, providerInstance)
+	defer kubeletRouter.Remove(nodeName)
+
+	kubelet := vkubelet.New(vkubelet.Config{
 		Client:          k8sClient,
 		Namespace:       kubeNamespace,
 		NodeName:        initConfig.NodeName,
@@ -215,35 +336,50 @@ func startKubelet(nodeId string) {
 		ResourceManager: rm,
 		PodSyncWorkers:  podSyncWorkers,
 		PodInformer:     podInformer,
+
+		NodeStatusReportFrequency: nodeStatusReportFrequency,
+		NodeLeaseDuration:         nodeLeaseDuration,
+		PodEvictionTimeout:        podEvictionTimeout,
 	})
 
-	if err := kubelet.KubeletInstance.Run(nodeContext); err != nil && errors.Cause(err) != context.Canceled {
-		log.G(nodeContext).Fatal(err)
+	started(kubelet)
+
+	if err := kubelet.Run(attemptContext); err != nil && errors.Cause(err) != context.Canceled {
+		return err
 	}
+	return nil
 }
 
-func shutdownKubelet(nodeId string, deleteNode bool) {
-	kubelet, ok := ioFogKubelets[nodeId]
-	if !ok {
-		log.L.Warn("ioFog Kubelet is not running for node ", nodeId)
-		return
-	}
+// shutdownKubelet stops the kubelet of a node, deleting its Kubernetes node if requested.
+func shutdownKubelet(nodeId string, deleteNode bool) error {
+	return nodeSupervisor.Stop(nodeId, deleteNode)
+}
 
-	deleteNodeLock.Lock()
-	if kubelet != nil && kubelet.KubeletInstance != nil {
-		if deleteNode {
-			_ = kubelet.KubeletInstance.DeleteNode(kubelet.NodeContext)
+// stopAgentNode stops the node of an agent stopped by the ioFog Controller, cancelling its pending removal.
+func stopAgentNode(nodeId string, deleteNode bool) error {
+	nodeRemover.Cancel(nodeId)
+	return shutdownKubelet(nodeId, deleteNode)
+}
+
+// agentExists asks the ioFog Controller whether an agent exists.
+func agentExists(nodeId string) (bool, error) {
+	if _, err := getIOFogNode(nodeId); err != nil {
+		switch err := err.(type) {
+		case *client.NotFoundError:
+			return false, nil
+		case *client.HTTPError:
+			if err.Code == http.StatusNotFound {
+				return false, nil
+			}
 		}
-		kubelet.NodeContextCancel()
-		delete(ioFogKubelets, nodeId)
+		return false, err
 	}
-	deleteNodeLock.Unlock()
+	return true, nil
 }
 
+// shutdownAll stops every kubelet, leaving their Kubernetes nodes in place.
 func shutdownAll() {
-	for nodeId := range ioFogKubelets {
-		shutdownKubelet(nodeId, false)
-	}
+	nodeSupervisor.StopAll()
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -254,6 +390,26 @@ func Execute() {
 	}
 }
 
+func getDaemonPort() int32 {
+	daemonPortEnv := getEnv("KUBELET_PORT", defaultDaemonPort)
+	daemonPort, err := strconv.Atoi(daemonPortEnv)
+	if err != nil {
+		log.L.WithError(err).WithField("value", daemonPortEnv).Fatal("Invalid value from KUBELET_PORT in environment")
+	}
+	return int32(daemonPort)
+}
+
+// newLogSource returns the source of the logs of the microservices of a node selected with --logs-source, nil when
+// none is selected since the ioFog Controller has no API serving them.
+func newLogSource(nodeId string) iofog.LogSource {
+	switch logsSource {
+	case logsSourceDocker:
+		return iofog.NewDockerLogSource(agentCache, nodeId, logsDockerPort)
+	default:
+		return nil
+	}
+}
+
 func nodeName(nodeId string) string {
 	return "iofog-" + strings.ToLower(nodeId)
 }
@@ -318,6 +474,34 @@ func init() {
 	RootCmd.PersistentFlags().Var(mapVar(userTraceConfig.Tags), "trace-tag", "add tags to include with traces in key=value form")
 	RootCmd.PersistentFlags().StringVar(&traceSampler, "trace-sample-rate", "", "set probability of tracing samples")
 
+	RootCmd.PersistentFlags().StringVar(&controllerServerOptions.Address, "controller-callback-address", "localhost:1234", "address the ioFog Controller callbacks are served on")
+	RootCmd.PersistentFlags().StringVar(&controllerServerOptions.CertPath, "controller-callback-tls-cert", "", "TLS certificate of the ioFog Controller callback server, plain HTTP is served when empty")
+	RootCmd.PersistentFlags().StringVar(&controllerServerOptions.KeyPath, "controller-callback-tls-key", "", "TLS key of the ioFog Controller callback server")
+	RootCmd.PersistentFlags().StringVar(&admissionServerOptions.Address, "admission-address", "", "address the validating webhook of the ioFog pods is served on, it is not served when empty")
+	RootCmd.PersistentFlags().StringVar(&admissionServerOptions.CertPath, "admission-tls-cert", "", "TLS certificate of the validating webhook")
+	RootCmd.PersistentFlags().StringVar(&admissionServerOptions.KeyPath, "admission-tls-key", "", "TLS key of the validating webhook")
+
+	RootCmd.PersistentFlags().BoolVar(&leaderElection.Enabled, "leader-elect", true, "elect a leader among the replicas before registering the nodes")
+	RootCmd.PersistentFlags().StringVar(&leaderElection.LeaseName, "leader-elect-lease-name", defaultLeaseName, "name of the Lease used for the leader election, in --namespace or 'default'")
+	RootCmd.PersistentFlags().DurationVar(&leaderElection.LeaseDuration, "leader-elect-lease-duration", defaultLeaseDuration, "how long a standby replica waits before taking over from an unresponsive leader")
+	RootCmd.PersistentFlags().DurationVar(&leaderElection.RenewDeadline, "leader-elect-renew-deadline", defaultLeaseRenewDeadline, "how long the leader retries renewing its Lease before stepping down")
+	RootCmd.PersistentFlags().DurationVar(&leaderElection.RetryPeriod, "leader-elect-retry-period", defaultLeaseRetryPeriod, "how long replicas wait between attempts to acquire or renew the Lease")
+
+	RootCmd.PersistentFlags().StringVar(&nodePolicyFile, "node-policy-file", "", "file of the policy assigning taints, labels and annotations to the nodes of matching agents")
+	RootCmd.PersistentFlags().StringVar(&nodePolicyConfigMap, "node-policy-config-map", "", "ConfigMap, in --namespace or 'default', holding the node policy under the "+nodePolicyConfigMapKey+" key")
+	RootCmd.PersistentFlags().DurationVar(&nodeStatusReportFrequency, "node-status-report-frequency", vkubelet.DefaultNodeStatusReportFrequency, "how often the node status is reported when it does not change")
+	RootCmd.PersistentFlags().DurationVar(&nodeLeaseDuration, "node-lease-duration", vkubelet.DefaultNodeLeaseDuration, "how long the node Lease, renewed four times as often, is valid")
+	RootCmd.PersistentFlags().DurationVar(&podEvictionTimeout, "pod-eviction-timeout", vkubelet.DefaultPodEvictionTimeout, "how long a node can be NotReady or Unknown before its pods are evicted, a negative timeout disables evictions")
+	RootCmd.PersistentFlags().DurationVar(&nodeRemover.GracePeriod, "agent-removal-grace-period", defaultAgentRemovalGracePeriod, "how long the node of an agent removed from the ioFog Controller is kept before its pods are evicted and it is deleted")
+	RootCmd.PersistentFlags().DurationVar(&nodeRemover.DrainTimeout, "node-drain-timeout", defaultNodeDrainTimeout, "how long the evictions refused by pod disruption budgets are retried before the node of a removed agent is deleted")
+	RootCmd.PersistentFlags().BoolVar(&applicationController, "application-controller", true, "deploy the IofogApplication resources to the ioFog Controller")
+	RootCmd.PersistentFlags().DurationVar(&agentResyncPeriod, "agent-resync-period", defaultAgentResyncPeriod, "how often the ioFog agents are listed, to refresh the status of their nodes and correct missed controller callbacks")
+	RootCmd.PersistentFlags().DurationVar(&agentMaxAge, "agent-max-age", iofog.DefaultAgentMaxAge, "how old the last listing of an ioFog agent can get before the conditions of its node are Unknown")
+	RootCmd.PersistentFlags().DurationVar(&catalogMaxAge, "catalog-max-age", iofog.DefaultCatalogMaxAge, "how long the ioFog catalog, resolving the catalog:// images, is cached before it is listed again")
+	RootCmd.PersistentFlags().StringVar(&nodePortRange, "node-kubelet-ports", defaultNodePorts, "range of the kubelet ports advertised by the nodes, one per node, on which their /stats/summary is served")
+	RootCmd.PersistentFlags().StringVar(&logsSource, "logs-source", "", `where the logs of the microservices are read from: "docker" reads them from the Docker daemon of their agent, which must listen on plain TCP on --logs-docker-port. The ioFog Controller has no API serving them, so kubectl logs fails when empty`)
+	RootCmd.PersistentFlags().IntVar(&logsDockerPort, "logs-docker-port", iofog.DefaultDockerPort, "port the Docker daemons of the agents listen on, for --logs-source docker")
+	RootCmd.PersistentFlags().Float64Var(&agentResyncJitter, "agent-resync-jitter", defaultAgentResyncJitter, "fraction of --agent-resync-period by which the agent listings are spread")
 	RootCmd.PersistentFlags().DurationVar(&kubeSharedInformerFactoryResync, "full-resync-period", kubeSharedInformerFactoryDefaultResync, "how often to perform a full resync of pods between kubernetes and the provider")
 
 	// Cobra also supports local flags, which will only run
@@ -391,6 +575,16 @@ func initConfig() {
 		logger.WithError(err).Fatal("Error setting up desired kubernetes node taint")
 	}
 
+	if nodePorts, err = ParsePortPool(nodePortRange); err != nil {
+		logger.WithError(err).Fatal("Error parsing the kubelet ports of the nodes")
+	}
+
+	switch logsSource {
+	case "", logsSourceDocker:
+	default:
+		logger.WithField("logsSource", logsSource).Fatalf("Log source not supported. Valid options are: %s", logsSourceDocker)
+	}
+
 	if podSyncWorkers <= 0 {
 		logger.Fatal("The number of pod synchronization workers should not be negative")
 	}
@@ -413,6 +607,13 @@ func initConfig() {
 			log.L.WithError(err).WithField("exporter", e).Fatal("Cannot initialize exporter")
 		}
 		octrace.RegisterExporter(exporter)
+		// Exporters which also export metrics, such as ocagent, receive the kubelet views.
+		if exporter, ok := exporter.(view.Exporter); ok {
+			view.RegisterExporter(exporter)
+		}
+	}
+	if err := view.Register(vkubelet.Views...); err != nil {
+		log.L.WithError(err).Fatal("Cannot register metrics views")
 	}
 	if len(userTraceExporters) > 0 {
 		var s octrace.Sampler
@@ -443,50 +644,38 @@ func initConfig() {
 	}
 }
 
-func getIOFogNodes() []client.AgentInfo {
-	if agents, err := controllerClient.ListAgents(); err != nil {
-		log.G(rootContext).Fatal(err)
-		return []client.AgentInfo{}
-	} else {
-		return agents.Agents
+func getIOFogNodes() ([]client.AgentInfo, error) {
+	agents, err := controllerClient.ListAgents()
+	if err != nil {
+		return nil, err
 	}
+	return agents.Agents, nil
 }
 
-func ioFogSyncLoop(ctx context.Context) {
-	const sleepTime = 5 * time.Second
-
-	t := time.NewTimer(sleepTime)
-	defer t.Stop()
+// listIOFogNodes lists the agents and shares them with the providers of every node.
+func listIOFogNodes() ([]client.AgentInfo, error) {
+	agents, err := getIOFogNodes()
+	if err != nil {
+		return nil, err
+	}
+	agentCache.Update(agents)
+	return agents, nil
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-t.C:
-			t.Stop()
-
-			nodes := getIOFogNodes()
-			if nodes != nil {
-				uuids := make(map[string]bool)
-				for _, iofog := range nodes {
-					uuids[iofog.UUID] = true
-					_, ok := ioFogKubelets[iofog.UUID]
-					if ok {
-						continue
-					}
-					go startKubelet(iofog.UUID)
-				}
-
-				for uuid := range ioFogKubelets {
-					_, ok := uuids[uuid]
-					if !ok {
-						shutdownKubelet(uuid, true)
-					}
-				}
-			}
+// listCatalog lists the catalog items of the ioFog Controller.
+func listCatalog() ([]client.CatalogItemInfo, error) {
+	catalog, err := controllerClient.GetCatalog()
+	if err != nil {
+		return nil, err
+	}
+	return catalog.CatalogItems, nil
+}
 
-			// restart the timer
-			t.Reset(sleepTime)
-		}
+func getIOFogNode(nodeId string) (*client.AgentInfo, error) {
+	agent, err := controllerClient.GetAgentByID(nodeId)
+	if err != nil {
+		return nil, err
 	}
+	agentCache.Put(*agent)
+	return agent, nil
 }
@@ -0,0 +1,352 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	defaultRestartBackoff    = 1 * time.Second
+	defaultMaxRestartBackoff = 5 * time.Minute
+	// nodeStableDuration is how long a node has to run before its restart backoff is reset.
+	nodeStableDuration = 10 * time.Minute
+	// nodeStopTimeout bounds how long stopping a node waits for its kubelet to return.
+	nodeStopTimeout = 30 * time.Second
+	// nodeWaitInterval is how often WaitRunning checks whether a node runs.
+	nodeWaitInterval = 100 * time.Millisecond
+)
+
+// NodeState is the lifecycle state of a supervised node.
+type NodeState string
+
+const (
+	NodeStarting NodeState = "Starting"
+	NodeRunning  NodeState = "Running"
+	NodeBackoff  NodeState = "Backoff"
+	NodeStopping NodeState = "Stopping"
+	NodeStopped  NodeState = "Stopped"
+)
+
+// NodeStatus reports the state of a supervised node.
+type NodeStatus struct {
+	NodeID      string    `json:"nodeId"`
+	State       NodeState `json:"state"`
+	Restarts    int       `json:"restarts"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastStarted time.Time `json:"lastStarted,omitempty"`
+	NextRestart time.Time `json:"nextRestart,omitempty"`
+}
+
+// NodeDeleter deletes the Kubernetes node of a running kubelet.
+type NodeDeleter interface {
+	DeleteNode(ctx context.Context) error
+}
+
+// NodeRefresher refreshes the Kubernetes node of a running kubelet, such as after its agent changed.
+type NodeRefresher interface {
+	NotifyNodeChanged()
+}
+
+// NodeDrainer evicts the pods of the Kubernetes node of a running kubelet, such as before deleting the node.
+type NodeDrainer interface {
+	DrainNode(ctx context.Context) error
+}
+
+// NodeRunFunc runs the kubelet of a node until the context is done or it fails.
+// started is called once the kubelet is created so that its node can be deleted when the agent goes away.
+type NodeRunFunc func(ctx context.Context, nodeId string, started func(NodeDeleter)) error
+
+// NodeSupervisor owns the goroutine of every node, restarting failed nodes with an exponential backoff.
+type NodeSupervisor struct {
+	mutex      sync.Mutex
+	nodes      map[string]*supervisedNode
+	run        NodeRunFunc
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+type supervisedNode struct {
+	status  NodeStatus
+	ctx     context.Context
+	cancel  context.CancelFunc
+	deleter NodeDeleter
+	done    chan struct{}
+}
+
+// NewNodeSupervisor creates a supervisor running nodes with run.
+func NewNodeSupervisor(run NodeRunFunc) *NodeSupervisor {
+	return &NodeSupervisor{
+		nodes:      make(map[string]*supervisedNode),
+		run:        run,
+		backoff:    defaultRestartBackoff,
+		maxBackoff: defaultMaxRestartBackoff,
+	}
+}
+
+// Start starts supervising a node unless it is already supervised.
+func (s *NodeSupervisor) Start(ctx context.Context, nodeId string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.nodes[nodeId]; ok {
+		return false
+	}
+
+	nodeContext, cancel := context.WithCancel(ctx)
+	node := &supervisedNode{
+		status: NodeStatus{NodeID: nodeId, State: NodeStarting},
+		ctx:    nodeContext,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	s.nodes[nodeId] = node
+	go s.supervise(node)
+	return true
+}
+
+// Stop stops a node and waits for its kubelet to return, deleting its Kubernetes node first if requested.
+// It fails with a NotFound error when the node is not supervised, and when the node could not be deleted or its
+// kubelet did not return in time.
+func (s *NodeSupervisor) Stop(nodeId string, deleteNode bool) error {
+	s.mutex.Lock()
+	node, ok := s.nodes[nodeId]
+	if !ok {
+		s.mutex.Unlock()
+		return strongerrors.NotFound(errors.Errorf("ioFog Kubelet is not running for node %s", nodeId))
+	}
+	delete(s.nodes, nodeId)
+	node.status.State = NodeStopping
+	deleter := node.deleter
+	s.mutex.Unlock()
+
+	var deleteErr error
+	if deleteNode {
+		if deleter == nil {
+			deleteErr = errors.Errorf("ioFog Kubelet of node %s did not start, its node cannot be deleted", nodeId)
+		} else {
+			deleteErr = deleter.DeleteNode(node.ctx)
+		}
+	}
+	node.cancel()
+
+	select {
+	case <-node.done:
+	case <-time.After(nodeStopTimeout):
+		return errors.Errorf("timed out waiting for node %s to stop", nodeId)
+	}
+	return errors.Wrap(deleteErr, "error deleting node")
+}
+
+// WaitRunning waits until the kubelet of a node has started, failing with its last error when the context is done
+// first. The node does not need to be supervised yet.
+func (s *NodeSupervisor) WaitRunning(ctx context.Context, nodeId string) error {
+	lastError := ""
+	err := wait.PollImmediateUntil(nodeWaitInterval, func() (bool, error) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		node, ok := s.nodes[nodeId]
+		if !ok {
+			return false, nil
+		}
+		lastError = node.status.LastError
+		return node.status.State == NodeRunning && node.deleter != nil, nil
+	}, ctx.Done())
+	if err == nil {
+		return nil
+	}
+	if lastError != "" {
+		return errors.Errorf("node %s did not start: %s", nodeId, lastError)
+	}
+	return errors.Errorf("node %s did not start", nodeId)
+}
+
+// Refresh asks the kubelet of a node to refresh its Kubernetes node.
+func (s *NodeSupervisor) Refresh(nodeId string) bool {
+	s.mutex.Lock()
+	node, ok := s.nodes[nodeId]
+	var deleter NodeDeleter
+	if ok {
+		deleter = node.deleter
+	}
+	s.mutex.Unlock()
+
+	refresher, ok := deleter.(NodeRefresher)
+	if !ok {
+		return false
+	}
+	refresher.NotifyNodeChanged()
+	return true
+}
+
+// Drain evicts the pods of a node until they are all evicted or the context is done.
+func (s *NodeSupervisor) Drain(ctx context.Context, nodeId string) error {
+	s.mutex.Lock()
+	node, ok := s.nodes[nodeId]
+	var deleter NodeDeleter
+	if ok {
+		deleter = node.deleter
+	}
+	s.mutex.Unlock()
+
+	drainer, ok := deleter.(NodeDrainer)
+	if !ok {
+		return strongerrors.NotFound(errors.Errorf("ioFog Kubelet is not running for node %s", nodeId))
+	}
+	return drainer.DrainNode(ctx)
+}
+
+// StopAll stops every node without deleting their Kubernetes nodes.
+func (s *NodeSupervisor) StopAll() {
+	var wg sync.WaitGroup
+	for _, nodeId := range s.NodeIDs() {
+		wg.Add(1)
+		go func(nodeId string) {
+			defer wg.Done()
+			s.Stop(nodeId, false)
+		}(nodeId)
+	}
+	wg.Wait()
+}
+
+// Has reports whether a node is supervised.
+func (s *NodeSupervisor) Has(nodeId string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.nodes[nodeId]
+	return ok
+}
+
+// NodeIDs returns the IDs of the supervised nodes.
+func (s *NodeSupervisor) NodeIDs() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := make([]string, 0, len(s.nodes))
+	for nodeId := range s.nodes {
+		ids = append(ids, nodeId)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Status returns the state of every supervised node, sorted by node ID.
+func (s *NodeSupervisor) Status() []NodeStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	statuses := make([]NodeStatus, 0, len(s.nodes))
+	for _, node := range s.nodes {
+		statuses = append(statuses, node.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].NodeID < statuses[j].NodeID
+	})
+	return statuses
+}
+
+func (s *NodeSupervisor) supervise(node *supervisedNode) {
+	defer close(node.done)
+
+	logger := log.G(node.ctx).WithField("nodeId", node.status.NodeID)
+	backoff := s.backoff
+	for {
+		started := time.Now()
+		s.update(node, func(status *NodeStatus) {
+			status.State = NodeRunning
+			status.LastStarted = started
+			status.NextRestart = time.Time{}
+		})
+
+		err := s.runNode(node)
+		if node.ctx.Err() != nil {
+			s.update(node, func(status *NodeStatus) {
+				status.State = NodeStopped
+			})
+			logger.Info("Node stopped")
+			return
+		}
+
+		if time.Since(started) > nodeStableDuration {
+			backoff = s.backoff
+		}
+		s.update(node, func(status *NodeStatus) {
+			status.State = NodeBackoff
+			status.Restarts++
+			status.NextRestart = time.Now().Add(backoff)
+			if err != nil {
+				status.LastError = err.Error()
+			} else {
+				status.LastError = "kubelet returned unexpectedly"
+			}
+		})
+		logger.WithError(err).WithField("backoff", backoff).Error("Node failed, restarting it")
+
+		select {
+		case <-node.ctx.Done():
+			s.update(node, func(status *NodeStatus) {
+				status.State = NodeStopped
+			})
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+// runNode runs the kubelet of a node, turning panics into errors so that they are retried like any other failure.
+// Every attempt runs with its own context, cancelled when it returns, so that a failed attempt does not leave
+// its goroutines behind, nor its server to be refreshed, drained or deleted.
+func (s *NodeSupervisor) runNode(node *supervisedNode) (err error) {
+	attemptContext, cancel := context.WithCancel(node.ctx)
+	defer cancel()
+	defer func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		node.deleter = nil
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("kubelet panicked: %v", r)
+		}
+	}()
+
+	return s.run(attemptContext, node.status.NodeID, func(deleter NodeDeleter) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		node.deleter = deleter
+	})
+}
+
+func (s *NodeSupervisor) update(node *supervisedNode, update func(status *NodeStatus)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	update(&node.status)
+}
@@ -0,0 +1,127 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+)
+
+type fakeNodeDeleter struct {
+	deleted chan struct{}
+}
+
+func (d *fakeNodeDeleter) DeleteNode(ctx context.Context) error {
+	close(d.deleted)
+	return nil
+}
+
+func TestNodeSupervisor(t *testing.T) {
+	var mutex sync.Mutex
+	runs := 0
+	var attempts []context.Context
+	var staleDeleter NodeDeleter
+	deleter := &fakeNodeDeleter{deleted: make(chan struct{})}
+
+	var supervisor *NodeSupervisor
+	supervisor = NewNodeSupervisor(func(ctx context.Context, nodeId string, started func(NodeDeleter)) error {
+		mutex.Lock()
+		runs++
+		run := runs
+		attempts = append(attempts, ctx)
+		mutex.Unlock()
+
+		switch run {
+		case 1:
+			return errors.New("failed")
+		case 2:
+			started(&fakeNodeDeleter{deleted: make(chan struct{})})
+			panic("panicked")
+		}
+		supervisor.mutex.Lock()
+		staleDeleter = supervisor.nodes["node"].deleter
+		supervisor.mutex.Unlock()
+		started(deleter)
+		<-ctx.Done()
+		return nil
+	})
+	supervisor.backoff = time.Millisecond
+
+	if !supervisor.Start(context.Background(), "node") || supervisor.Start(context.Background(), "node") {
+		t.Fatal("expected the node to be started once")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := supervisor.Status()
+		if len(status) == 1 && status[0].State == NodeRunning && status[0].Restarts == 2 {
+			if status[0].LastError != "kubelet panicked: panicked" {
+				t.Fatalf("unexpected last error: %q", status[0].LastError)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("node was not restarted: %+v", status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Wait for the kubelet to report it started before stopping it.
+	waitCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := supervisor.WaitRunning(waitCtx, "node"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The failed attempts do not leave their goroutines running.
+	mutex.Lock()
+	for idx, ctx := range attempts[:2] {
+		if ctx.Err() == nil {
+			t.Fatalf("expected the context of attempt %d to be cancelled", idx+1)
+		}
+	}
+	if attempts[2].Err() != nil {
+		t.Fatal("expected the context of the running attempt not to be cancelled")
+	}
+	mutex.Unlock()
+	// The server of the failed attempt is forgotten once it exits.
+	supervisor.mutex.Lock()
+	if staleDeleter != nil {
+		t.Fatal("expected the deleter of the failed attempt to be reset")
+	}
+	supervisor.mutex.Unlock()
+
+	if err := supervisor.Stop("node", true); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-deleter.deleted:
+	default:
+		t.Fatal("expected the node to be deleted")
+	}
+	if supervisor.Has("node") || !strongerrors.IsNotFound(supervisor.Stop("node", false)) {
+		t.Fatal("expected the node to be removed")
+	}
+
+	waitCtx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := supervisor.WaitRunning(waitCtx, "node"); err == nil {
+		t.Fatal("expected a stopped node not to run")
+	}
+}
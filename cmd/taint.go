@@ -15,8 +15,11 @@ package cmd
 
 import (
 	"os"
+	"strings"
 
+	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 // Default taint values
@@ -34,10 +37,24 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getTaint returns the taint of every node, configured with the VK_TAINT_KEY, VK_TAINT_VALUE and VK_TAINT_EFFECT environment variables.
 func getTaint() (*corev1.Taint, error) {
+	key := getEnv("VK_TAINT_KEY", DefaultTaintKey)
+	value := getEnv("VK_TAINT_VALUE", DefaultTaintValue)
+	effect := corev1.TaintEffect(getEnv("VK_TAINT_EFFECT", string(DefaultTaintEffect)))
+
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return nil, errors.Errorf("invalid taint key %q: %s", key, strings.Join(errs, ", "))
+	}
+	switch effect {
+	case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+	default:
+		return nil, errors.Errorf("taint effect %q is not supported", effect)
+	}
+
 	return &corev1.Taint{
-		Key:    DefaultTaintKey,
-		Value:  DefaultTaintValue,
-		Effect: DefaultTaintEffect,
+		Key:    key,
+		Value:  value,
+		Effect: effect,
 	}, nil
 }
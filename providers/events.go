@@ -0,0 +1,34 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package providers
+
+import (
+	"context"
+
+	"k8s.io/client-go/tools/record"
+)
+
+type eventRecorderKey struct{}
+
+// WithEventRecorder returns a new context carrying the recorder of the events of the pod being synced, so that
+// providers can report the steps they take.
+func WithEventRecorder(ctx context.Context, recorder record.EventRecorder) context.Context {
+	return context.WithValue(ctx, eventRecorderKey{}, recorder)
+}
+
+// GetEventRecorder retrieves the event recorder from the context, nil when there is none.
+func GetEventRecorder(ctx context.Context) record.EventRecorder {
+	recorder, _ := ctx.Value(eventRecorderKey{}).(record.EventRecorder)
+	return recorder
+}
@@ -0,0 +1,88 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"github.com/pkg/errors"
+)
+
+// DefaultAgentMaxAge is how old the snapshot of an agent can get before its node status is Unknown.
+const DefaultAgentMaxAge = 1 * time.Minute
+
+// AgentCache is a snapshot of the agents of the ioFog Controller, shared by the providers of every node
+// so that the agents are listed once for all the nodes instead of fetched by every status call.
+type AgentCache struct {
+	mutex  sync.RWMutex
+	agents map[string]AgentSnapshot
+	maxAge time.Duration
+}
+
+// AgentSnapshot is the state of an agent at the time it was fetched from the ioFog Controller.
+type AgentSnapshot struct {
+	Agent   client.AgentInfo
+	Fetched time.Time
+}
+
+// NewAgentCache creates an empty cache whose snapshots are stale after maxAge.
+func NewAgentCache(maxAge time.Duration) *AgentCache {
+	if maxAge <= 0 {
+		maxAge = DefaultAgentMaxAge
+	}
+	return &AgentCache{
+		agents: make(map[string]AgentSnapshot),
+		maxAge: maxAge,
+	}
+}
+
+// Update replaces the snapshot with the complete list of agents.
+func (c *AgentCache) Update(agents []client.AgentInfo) {
+	now := time.Now()
+	snapshots := make(map[string]AgentSnapshot, len(agents))
+	for _, agent := range agents {
+		snapshots[agent.UUID] = AgentSnapshot{Agent: agent, Fetched: now}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.agents = snapshots
+}
+
+// Put records a single agent, such as one fetched after a callback of the ioFog Controller.
+func (c *AgentCache) Put(agent client.AgentInfo) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.agents[agent.UUID] = AgentSnapshot{Agent: agent, Fetched: time.Now()}
+}
+
+// Get returns the snapshot of an agent.
+func (c *AgentCache) Get(uuid string) (AgentSnapshot, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	snapshot, ok := c.agents[uuid]
+	if !ok {
+		return AgentSnapshot{}, strongerrors.NotFound(errors.Errorf("agent %s not found", uuid))
+	}
+	return snapshot, nil
+}
+
+// Stale reports whether a snapshot is too old to be trusted.
+func (c *AgentCache) Stale(snapshot AgentSnapshot) bool {
+	return time.Since(snapshot.Fetched) > c.maxAge
+}
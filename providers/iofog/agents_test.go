@@ -0,0 +1,70 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestAgentCacheNodeConditions(t *testing.T) {
+	cache := NewAgentCache(time.Minute)
+	provider := &BrokerProvider{nodeId: "agent", internalIP: "10.0.0.9", agents: cache}
+
+	if _, err := cache.Get("agent"); !strongerrors.IsNotFound(err) {
+		t.Fatalf("expected the agent not to be found, got %v", err)
+	}
+	assertReady(t, provider, v1.ConditionUnknown)
+
+	cache.Update([]client.AgentInfo{{UUID: "agent", DaemonStatus: "RUNNING", MemoryLimit: 1024, MemoryUsage: 1000, IPAddress: "10.0.0.1"}})
+	assertReady(t, provider, v1.ConditionTrue)
+	// The node advertises the kubelet, not the agent.
+	if addresses := provider.NodeAddresses(context.Background()); len(addresses) != 1 || addresses[0].Address != "10.0.0.9" {
+		t.Errorf("unexpected addresses %v", addresses)
+	}
+	for _, condition := range provider.NodeConditions(context.Background()) {
+		if condition.Type == v1.NodeMemoryPressure && condition.Status != v1.ConditionTrue {
+			t.Errorf("expected memory pressure, got %v", condition)
+		}
+	}
+
+	// A snapshot older than the maximum age is not trusted.
+	cache.agents["agent"] = AgentSnapshot{Agent: cache.agents["agent"].Agent, Fetched: time.Now().Add(-2 * time.Minute)}
+	assertReady(t, provider, v1.ConditionUnknown)
+
+	cache.Put(client.AgentInfo{UUID: "agent", DaemonStatus: "STOPPED"})
+	assertReady(t, provider, v1.ConditionFalse)
+
+	// A listing replaces the snapshot, agents no longer listed are gone.
+	cache.Update(nil)
+	assertReady(t, provider, v1.ConditionUnknown)
+}
+
+func assertReady(t *testing.T, provider *BrokerProvider, expected v1.ConditionStatus) {
+	t.Helper()
+	for _, condition := range provider.NodeConditions(context.Background()) {
+		if condition.Type == v1.NodeReady {
+			if condition.Status != expected {
+				t.Errorf("expected Ready to be %s, got %s: %s", expected, condition.Status, condition.Message)
+			}
+			return
+		}
+	}
+	t.Error("expected a Ready condition")
+}
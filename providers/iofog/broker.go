@@ -2,12 +2,13 @@ package iofog
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"github.com/cpuguy83/strongerrors"
 	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/apps"
 	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
-	"github.com/eclipse-iofog/iofog-kubelet/v2/vkubelet/api"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/vkubelet/api"
 	"io"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -25,26 +26,53 @@ type BrokerProvider struct {
 	client             *client.Client
 	nodeId             string
 	nodeName           string
+	internalIP         string
 	daemonEndpointPort int32
 	store              *api.KeyValueStore
+	logs               LogSource
+	exec               ExecBackend
+	stats              *statsCache
+	nodePolicy         func() *NodePolicy
+	agents             *AgentCache
+	catalog            *CatalogCache
 }
 
+// FlowPod is the state stored for every pod deployed as an ioFog flow.
 type FlowPod struct {
 	FlowInfo *client.FlowInfo
 	Pod      *v1.Pod
+	// Microservices maps the container names of the pod to their microservice UUID.
+	Microservices map[string]string
+	// Containers remembers the containers of the microservices by container name, to count their restarts.
+	Containers map[string]*ContainerHistory `json:",omitempty"`
 }
 
-// NewBrokerProvider creates a new BrokerProvider
-func NewBrokerProvider(daemonEndpointPort int32, nodeName, operatingSystem string, controller apps.IofogController, controllerClient *client.Client, nodeId string, store *api.KeyValueStore) (*BrokerProvider, error) {
+// NewBrokerProvider creates a new BrokerProvider.
+// Without a log source or an exec backend, the logs of the microservices or exec are not supported.
+func NewBrokerProvider(daemonEndpointPort int32, nodeName, internalIP, operatingSystem string, controller apps.IofogController, controllerClient *client.Client, nodeId string, store *api.KeyValueStore, nodePolicy func() *NodePolicy, agents *AgentCache, catalog *CatalogCache, logs LogSource, exec ExecBackend) (*BrokerProvider, error) {
+	if logs == nil {
+		logs = unsupportedLogSource{}
+	}
+	if exec == nil {
+		exec = unsupportedExecBackend{}
+	}
+
 	provider := BrokerProvider{
 		nodeName:           nodeName,
 		nodeId:             nodeId,
+		internalIP:         internalIP,
 		operatingSystem:    operatingSystem,
 		daemonEndpointPort: daemonEndpointPort,
 		controller:         controller,
 		client:             controllerClient,
 		store:              store,
+		logs:               logs,
+		exec:               exec,
+		nodePolicy:         nodePolicy,
+		agents:             agents,
+		catalog:            catalog,
 	}
+	provider.stats = newStatsCache(statsCacheTTL, provider.buildStatsSummary)
 
 	return &provider, nil
 }
@@ -54,9 +82,17 @@ func (p *BrokerProvider) CreatePod(ctx context.Context, pod *v1.Pod) error {
 	return p.createUpdatePod(pod)
 }
 
-// UpdatePod accepts a Pod definition and forwards the call to the iofog endpoint
+// UpdatePod updates the microservices of a deployed pod to its new spec, deploying the pod when it is not deployed yet.
 func (p *BrokerProvider) UpdatePod(ctx context.Context, pod *v1.Pod) error {
-	return p.createUpdatePod(pod)
+	flowPod, err := p.getFlowPod(pod.Name)
+	if err != nil {
+		return err
+	}
+	// Only a pod which was never deployed, or whose deployment failed, is created again.
+	if flowPod.FlowInfo == nil || flowPod.Pod == nil {
+		return p.createUpdatePod(pod)
+	}
+	return p.updatePod(ctx, flowPod, pod)
 }
 
 // DeletePod accepts a Pod definition and forwards the call to the iofog endpoint
@@ -64,13 +100,51 @@ func (p *BrokerProvider) DeletePod(ctx context.Context, pod *v1.Pod) error {
 	if flowPod, err := p.getFlowPod(pod.Name); err != nil {
 		return err
 	} else {
-		if err = p.client.DeleteFlow(flowPod.FlowInfo.ID); err != nil {
-			return err
+		// A pod whose deployment failed has no flow to delete.
+		if flowPod.FlowInfo != nil {
+			if err = p.client.DeleteFlow(flowPod.FlowInfo.ID); err != nil {
+				return err
+			}
 		}
 		return p.store.Remove(pod.Name)
 	}
 }
 
+// StopPod stops the flow of a pod, its microservices stop while the pod terminates.
+// A pod without flow, such as a pod whose deployment failed, is reported as not found.
+func (p *BrokerProvider) StopPod(ctx context.Context, pod *v1.Pod) error {
+	flowPod, err := p.getFlowPod(pod.Name)
+	if err != nil {
+		return err
+	}
+	if flowPod.FlowInfo == nil {
+		return strongerrors.NotFound(fmt.Errorf("flow of pod %s not found", pod.Name))
+	}
+	_, err = p.client.StopFlow(flowPod.FlowInfo.ID)
+	return err
+}
+
+// PodStopped reports whether every microservice of the flow of a pod stopped.
+func (p *BrokerProvider) PodStopped(ctx context.Context, pod *v1.Pod) (bool, error) {
+	flowPod, err := p.getFlowPod(pod.Name)
+	if err != nil {
+		return false, err
+	}
+	if flowPod.FlowInfo == nil {
+		return false, strongerrors.NotFound(fmt.Errorf("flow of pod %s not found", pod.Name))
+	}
+	microservices, err := p.client.GetMicroservicesPerFlow(flowPod.FlowInfo.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, microservice := range microservices.Microservices {
+		if !microserviceTerminated(microservice.Status.Status) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 // GetPod returns a pod by name that is being managed by the iofog server
 func (p *BrokerProvider) GetPod(ctx context.Context, namespace, name string) (*v1.Pod, error) {
 	if flowPod, err := p.getFlowPod(name); err != nil {
@@ -80,9 +154,18 @@ func (p *BrokerProvider) GetPod(ctx context.Context, namespace, name string) (*v
 	}
 }
 
-// GetContainerLogs returns the logs of a container running in a pod by name.
-func (p *BrokerProvider) GetContainerLogs(ctx context.Context, namespace, podName, containerName string, tail int) (string, error) {
-	return "", nil
+// GetContainerLogs streams the logs of the microservice running a container of a pod.
+func (p *BrokerProvider) GetContainerLogs(ctx context.Context, namespace, podName, containerName string, opts providers.ContainerLogOpts) (io.ReadCloser, error) {
+	microserviceUUID, err := p.getMicroserviceUUID(podName, containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	logs, err := p.logs.MicroserviceLogs(ctx, microserviceUUID, opts)
+	if err != nil {
+		return nil, err
+	}
+	return limitReadCloser(logs, opts.LimitBytes), nil
 }
 
 // Get full pod name as defined in the provider context
@@ -93,9 +176,19 @@ func (p *BrokerProvider) GetPodFullName(namespace string, pod string) string {
 
 // ExecInContainer executes a command in a container in the pod, copying data
 // between in/out/err and the container's stdin/stdout/stderr.
-// TODO: Implementation
-func (p *BrokerProvider) ExecInContainer(name string, uid types.UID, container string, cmd []string, in io.Reader, out, err io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize, timeout time.Duration) error {
-	return nil
+func (p *BrokerProvider) ExecInContainer(ctx context.Context, name string, uid types.UID, container string, cmd []string, in io.Reader, out, err io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize, timeout time.Duration) error {
+	microserviceUUID, lookupErr := p.getMicroserviceUUID(name, container)
+	if lookupErr != nil {
+		return lookupErr
+	}
+
+	return execInMicroservice(ctx, p.exec, microserviceUUID, cmd, ExecStreams{
+		Stdin:  in,
+		Stdout: out,
+		Stderr: err,
+		TTY:    tty,
+		Resize: resize,
+	}, timeout)
 }
 
 // GetPodStatus retrieves the status of a given pod by name.
@@ -104,68 +197,96 @@ func (p *BrokerProvider) GetPodStatus(ctx context.Context, namespace, name strin
 	if err != nil {
 		return nil, err
 	}
+	if flowPod.FlowInfo == nil {
+		return nil, strongerrors.NotFound(fmt.Errorf("flow of pod %s not found", name))
+	}
 
 	microservices, err := p.client.GetMicroservicesPerFlow(flowPod.FlowInfo.ID)
 	if err != nil {
 		return nil, err
 	}
 
-	containersStatus := []v1.ContainerStatus{}
-	podPhase := v1.PodRunning
-	podReady := v1.ConditionStatus("True")
-	var podStartTime metav1.Time
-	for _, microservice := range microservices.Microservices {
-		podStartTime = metav1.Time{Time: time.Unix(microservice.Status.StartTimne/1000, -1)}
-		var containerState v1.ContainerState
-		microserviceReady := true
-		if microservice.Status.Status != "RUNNING" {
-			podPhase = v1.PodPending
-			podReady = v1.ConditionStatus("False")
-			containerState = v1.ContainerState{
-				Waiting: &v1.ContainerStateWaiting{
-					Reason: microservice.Status.Status,
-				},
-			}
-			microserviceReady = false
-		} else {
-			containerState = v1.ContainerState{
-				Running: &v1.ContainerStateRunning{
-					StartedAt: podStartTime,
-				},
+	return p.flowPodStatus(ctx, name, flowPod, microservices.Microservices), nil
+}
+
+// flowPodNode is the part of a FlowPod naming the node of the pod.
+type flowPodNode struct {
+	Pod *struct {
+		Spec struct {
+			NodeName string
+		}
+	}
+}
+
+// GetPodStatuses returns the status of every pod of the node, listing the microservices once per flow.
+// Entries which cannot be read are skipped, the pods keep their current status until the next sync.
+func (p *BrokerProvider) GetPodStatuses(ctx context.Context) (map[types.NamespacedName]*v1.PodStatus, error) {
+	statuses := make(map[types.NamespacedName]*v1.PodStatus)
+	flows := make(map[int][]client.MicroserviceInfo)
+	for _, podName := range p.store.Keys() {
+		// The store is shared by every node, only the pods of this one are decoded in full.
+		var node flowPodNode
+		if err := p.store.Decode(podName, &node); err != nil {
+			log.G(ctx).WithError(err).WithField("pod", podName).Warn("Error reading the node of the pod")
+			continue
+		}
+		if node.Pod == nil || node.Pod.Spec.NodeName != p.nodeName {
+			continue
+		}
+
+		flowPod, err := p.getFlowPod(podName)
+		if err != nil {
+			log.G(ctx).WithError(err).WithField("pod", podName).Warn("Error reading the pod")
+			continue
+		}
+		if flowPod.Pod == nil || flowPod.FlowInfo == nil {
+			continue
+		}
+
+		microservices, ok := flows[flowPod.FlowInfo.ID]
+		if !ok {
+			list, err := p.client.GetMicroservicesPerFlow(flowPod.FlowInfo.ID)
+			if err != nil {
+				// The pods of the flow keep their current status until the next sync.
+				log.G(ctx).WithError(err).WithField("flow", flowPod.FlowInfo.ID).Warn("Error listing the microservices of the flow")
+				continue
 			}
+			microservices = list.Microservices
+			flows[flowPod.FlowInfo.ID] = microservices
 		}
-		containersStatus = append(containersStatus, v1.ContainerStatus{
-			Name:         microservice.Name,
-			ImageID:      microservice.UUID,
-			Ready:        microserviceReady,
-			RestartCount: 0,
-			State:        containerState,
-		})
-	}
-
-	podStatus := v1.PodStatus{
-		Phase:     podPhase,
-		StartTime: &podStartTime,
-		Conditions: []v1.PodCondition{
-			{
-				Type:   "PodInitialized",
-				Status: "True",
-			},
-			{
-				Type:   "PodReady",
-				Status: podReady,
-			},
-			{
-				Type:   "PodScheduled",
-				Status: "True",
-			},
-		},
+
+		key := types.NamespacedName{Namespace: flowPod.Pod.Namespace, Name: flowPod.Pod.Name}
+		statuses[key] = p.flowPodStatus(ctx, podName, flowPod, microservices)
+	}
+	return statuses, nil
+}
+
+// flowPodStatus computes the status of a pod from the microservices of its flow.
+func (p *BrokerProvider) flowPodStatus(ctx context.Context, name string, flowPod *FlowPod, microservices []client.MicroserviceInfo) *v1.PodStatus {
+	containerNames := make(map[string]string, len(flowPod.Microservices))
+	for containerName, uuid := range flowPod.Microservices {
+		containerNames[uuid] = containerName
+	}
+	if flowPod.Containers == nil {
+		flowPod.Containers = make(map[string]*ContainerHistory)
+	}
+	containersStatus, changed := microservicesToContainerStatuses(flowPod.Pod, containerNames, microservices, flowPod.Containers)
+	if changed {
+		// The history only changes when containers start, the restart counts survive the kubelet.
+		if err := p.store.Put(name, flowPod); err != nil {
+			log.G(ctx).WithError(err).Warn("Error recording the containers of the pod")
+		}
+	}
+
+	return &v1.PodStatus{
+		Phase:             podPhase(flowPod.Pod, containersStatus),
+		StartTime:         podStartTime(containersStatus),
+		Conditions:        podConditions(containersStatus, metav1.Now()),
 		ContainerStatuses: containersStatus,
 	}
-	return &podStatus, nil
 }
 
-// GetPods retrieves a list of all pods scheduled to run.
+// GetPods retrieves a list of all pods scheduled to run on this node.
 func (p *BrokerProvider) GetPods(ctx context.Context) ([]*v1.Pod, error) {
 	podNames := p.store.Keys()
 	pods := make([]*v1.Pod, 0, p.store.Size())
@@ -178,6 +299,10 @@ func (p *BrokerProvider) GetPods(ctx context.Context) ([]*v1.Pod, error) {
 		if err := p.store.Get(podName, flowPod); err != nil {
 			return nil, err
 		}
+		// The store is shared by every node, only report the pods scheduled to this one.
+		if flowPod.Pod == nil || flowPod.Pod.Spec.NodeName != p.nodeName {
+			continue
+		}
 		pods = append(pods, flowPod.Pod)
 	}
 	return pods, nil
@@ -185,11 +310,12 @@ func (p *BrokerProvider) GetPods(ctx context.Context) ([]*v1.Pod, error) {
 
 // Capacity returns a resource list containing the capacity limits
 func (p *BrokerProvider) Capacity(ctx context.Context) v1.ResourceList {
-	node, err := p.client.GetAgentByID(p.nodeId)
+	snapshot, err := p.agent()
 	if err != nil {
 		log.L.Error("Error getting node capacity: ", err)
 		return nil
 	}
+	node := &snapshot.Agent
 
 	return v1.ResourceList{
 		"cpu":    *resource.NewQuantity(node.CPULimit, resource.DecimalSI),
@@ -198,126 +324,40 @@ func (p *BrokerProvider) Capacity(ctx context.Context) v1.ResourceList {
 	}
 }
 
-// Allocatable returns a resource list containing the allocatable limits
+// Allocatable returns the resources allocatable to pods, which are the limits of the agent.
+// The live usage is reported by the stats summary, it would change the node status on every poll.
 func (p *BrokerProvider) Allocatable(ctx context.Context) v1.ResourceList {
-	node, err := p.client.GetAgentByID(p.nodeId)
-	if err != nil {
-		log.L.Error("Error getting node's allocatable resources: ", err)
-		return nil
-	}
-
-	return v1.ResourceList{
-		"cpu":    *resource.NewQuantity(node.CPULimit-int64(node.CPUUsage), resource.DecimalSI),
-		"memory": *resource.NewQuantity(node.MemoryLimit-int64(node.MemoryUsage), resource.DecimalSI),
-		"pods":   *resource.NewQuantity(100, resource.DecimalSI),
-	}
+	return p.Capacity(ctx)
 }
 
-// NodeConditions returns a list of conditions (Ready, OutOfDisk, etc), for updates to the node status
+// NodeConditions returns a list of conditions (Ready, OutOfDisk, etc), for updates to the node status.
+// The conditions are Unknown while the agent cannot be fetched or its snapshot is stale.
 func (p *BrokerProvider) NodeConditions(ctx context.Context) []v1.NodeCondition {
-	node, err := p.client.GetAgentByID(p.nodeId)
-
-	var nodeRunning v1.ConditionStatus = "False"
-	daemonStatus := "UNKNOWN"
-
-	var outOfDisk v1.ConditionStatus = "False"
-	var diskPressure v1.ConditionStatus = "False"
-	diskUsage := ""
-
-	var memoryPressure v1.ConditionStatus = "False"
-	memoryUsage := ""
-
-	var now = metav1.Time{Time: time.Now()}
-
-	if err == nil && node != nil {
-		now = metav1.Time{Time: time.Unix(node.LastStatusTimeMsUTC/1000, -1)}
-
-		daemonStatus = node.DaemonStatus
-		if node.DaemonStatus != "RUNNING" {
-			nodeRunning = "False"
-		}
-
-		diskUsage = "Usage: " + fmt.Sprintf("%f.0", node.DiskUsage) + ", Limit: " + string(node.DiskLimit)
-		if int64(node.DiskUsage) >= node.DiskLimit {
-			outOfDisk = "True"
-		}
-
-		if (node.DiskUsage / float64(node.DiskLimit)) >= 0.9 {
-			diskPressure = "True"
-		}
-
-		memoryUsage = "Usage: " + fmt.Sprintf("%f.0", node.MemoryUsage) + ", Limit: " + string(node.MemoryLimit)
-		if (node.MemoryUsage / float64(node.MemoryLimit)) >= 0.9 {
-			memoryPressure = "True"
-		}
+	snapshot, err := p.agent()
+	if err != nil {
+		log.L.Error("Error getting node conditions: ", err)
+		return unknownNodeConditions(metav1.Now(), "ioFog agent not found")
 	}
-
-	condition := []v1.NodeCondition{
-		{
-			Type:               "Ready",
-			Status:             nodeRunning,
-			LastHeartbeatTime:  now,
-			LastTransitionTime: now,
-			Reason:             "",
-			Message:            daemonStatus,
-		},
-		{
-			Type:               "OutOfDisk",
-			Status:             outOfDisk,
-			LastHeartbeatTime:  now,
-			LastTransitionTime: now,
-			Reason:             "",
-			Message:            diskUsage,
-		},
-		{
-			Type:               "MemoryPressure",
-			Status:             memoryPressure,
-			LastHeartbeatTime:  now,
-			LastTransitionTime: now,
-			Reason:             "",
-			Message:            memoryUsage,
-		},
-		{
-			Type:               "DiskPressure",
-			Status:             diskPressure,
-			LastHeartbeatTime:  now,
-			LastTransitionTime: now,
-			Reason:             "",
-			Message:            diskUsage,
-		},
-		{
-			Type:               "NetworkUnavailable",
-			Status:             "False",
-			LastHeartbeatTime:  now,
-			LastTransitionTime: now,
-			Reason:             "",
-			Message:            "",
-		},
+	if p.agents != nil && p.agents.Stale(snapshot) {
+		return unknownNodeConditions(metav1.NewTime(snapshot.Fetched), "ioFog agent status is stale since "+snapshot.Fetched.UTC().Format(time.RFC3339))
 	}
-
-	return condition
+	return agentNodeConditions(&snapshot.Agent)
 }
 
-// NodeAddresses returns a list of addresses for the node status
-// within Kubernetes.
+// NodeAddresses returns the address of the kubelet serving the node, so that the API server sends
+// the logs, exec and stats requests of the node to the kubelet rather than to the agent.
 func (p *BrokerProvider) NodeAddresses(ctx context.Context) []v1.NodeAddress {
-	node, err := p.client.GetAgentByID(p.nodeId)
-	if err != nil {
-		log.L.Error("Error getting node's IP': ", err)
+	if p.internalIP == "" {
+		log.L.Error("Error getting node's IP: the address of the kubelet is unknown")
 		return nil
 	}
 
-	nodeAddresses := []v1.NodeAddress{
-		{
-			Type:    "InternalIP",
-			Address: node.IPAddress,
-		},
+	return []v1.NodeAddress{
 		{
-			Type:    "ExternalIP",
-			Address: node.IPAddressExternal,
+			Type:    v1.NodeInternalIP,
+			Address: p.internalIP,
 		},
 	}
-	return nodeAddresses
 }
 
 // NodeDaemonEndpoints returns NodeDaemonEndpoints for the node status
@@ -355,26 +395,32 @@ func (p *BrokerProvider) createUpdatePod(pod *v1.Pod) error {
 }
 
 func (p *BrokerProvider) convertAnnotationToApplication(pod *v1.Pod) (*apps.Application, error) {
-	microservicesString := pod.Annotations["microservices"]
-	routesString := pod.Annotations["routes"]
+	microservices, err := podToMicroservices(pod)
+	if err != nil {
+		return nil, err
+	}
+	if len(microservices) == 0 {
+		return nil, fmt.Errorf("pod %s does not define any container or microservice", pod.Name)
+	}
 
-	microservices := []apps.Microservice{}
-	routes := []apps.Route{}
-	if err := json.Unmarshal([]byte(microservicesString), &microservices); err != nil {
+	if err := p.resolveCatalogImages(pod, microservices); err != nil {
 		return nil, err
 	}
-	if err := json.Unmarshal([]byte(routesString), &routes); err != nil {
+
+	routes, err := podToRoutes(pod)
+	if err != nil {
 		return nil, err
 	}
 
-	node, _ := p.client.GetAgentByID(p.nodeId)
-	i := 0
-	s := len(microservices)
-	for i < s {
+	snapshot, err := p.agent()
+	if err != nil {
+		return nil, err
+	}
+	node := &snapshot.Agent
+	for i := range microservices {
 		microservices[i].Agent = apps.MicroserviceAgent{
 			Name: node.Name,
 		}
-		i++
 	}
 
 	application := &apps.Application{
@@ -386,6 +432,46 @@ func (p *BrokerProvider) convertAnnotationToApplication(pod *v1.Pod) (*apps.Appl
 	return application, nil
 }
 
+// getMicroservice returns the microservice running a container of a pod.
+func (p *BrokerProvider) getMicroservice(podName, containerName string) (*client.MicroserviceInfo, error) {
+	flowPod, err := p.getFlowPod(podName)
+	if err != nil {
+		return nil, err
+	}
+	if flowPod.FlowInfo == nil {
+		return nil, strongerrors.NotFound(fmt.Errorf("pod %s not found", podName))
+	}
+
+	microservices, err := p.client.GetMicroservicesPerFlow(flowPod.FlowInfo.ID)
+	if err != nil {
+		return nil, err
+	}
+	for idx := range microservices.Microservices {
+		if microservices.Microservices[idx].Name == containerName {
+			return &microservices.Microservices[idx], nil
+		}
+	}
+	return nil, strongerrors.NotFound(fmt.Errorf("container %s not found in pod %s", containerName, podName))
+}
+
+// getMicroserviceUUID returns the UUID of the microservice running a container of a pod,
+// asking the controller when it was not recorded at deployment.
+func (p *BrokerProvider) getMicroserviceUUID(podName, containerName string) (string, error) {
+	flowPod, err := p.getFlowPod(podName)
+	if err != nil {
+		return "", err
+	}
+	if uuid, ok := flowPod.Microservices[containerName]; ok {
+		return uuid, nil
+	}
+
+	microservice, err := p.getMicroservice(podName, containerName)
+	if err != nil {
+		return "", err
+	}
+	return microservice.UUID, nil
+}
+
 func (p *BrokerProvider) getFlowPod(podName string) (*FlowPod, error) {
 	flowPod := &FlowPod{}
 	if err := p.store.Get(podName, flowPod); err != nil {
@@ -396,9 +482,22 @@ func (p *BrokerProvider) getFlowPod(podName string) (*FlowPod, error) {
 }
 
 func (p *BrokerProvider) storeFlowInfo(flowInfo *client.FlowInfo, pod *v1.Pod) error {
+	microservices, err := p.client.GetMicroservicesPerFlow(flowInfo.ID)
+	if err != nil {
+		return err
+	}
+
 	flowPod := FlowPod{
-		FlowInfo: flowInfo,
-		Pod:      pod,
+		FlowInfo:      flowInfo,
+		Pod:           pod,
+		Microservices: make(map[string]string, len(microservices.Microservices)),
+	}
+	for _, microservice := range microservices.Microservices {
+		flowPod.Microservices[microservice.Name] = microservice.UUID
+	}
+	// The restarts of the containers are still counted after the pod is updated.
+	if previous, err := p.getFlowPod(pod.Name); err == nil {
+		flowPod.Containers = previous.Containers
 	}
 	return p.store.Put(pod.Name, flowPod)
 }
@@ -0,0 +1,170 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/vkubelet/api"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// fakeConfigMaps is an in-memory ConfigMapInterface backing the stores of the tests.
+type fakeConfigMaps struct {
+	corev1.ConfigMapInterface
+	mutex      sync.Mutex
+	configMaps map[string]*v1.ConfigMap
+}
+
+var configMapResource = schema.GroupResource{Resource: "configmaps"}
+
+func (f *fakeConfigMaps) Create(configMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.configMaps[configMap.Name]; ok {
+		return nil, errors.NewAlreadyExists(configMapResource, configMap.Name)
+	}
+	f.configMaps[configMap.Name] = configMap.DeepCopy()
+	return configMap.DeepCopy(), nil
+}
+
+func (f *fakeConfigMaps) Update(configMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.configMaps[configMap.Name]; !ok {
+		return nil, errors.NewNotFound(configMapResource, configMap.Name)
+	}
+	f.configMaps[configMap.Name] = configMap.DeepCopy()
+	return configMap.DeepCopy(), nil
+}
+
+func (f *fakeConfigMaps) Get(name string, options metav1.GetOptions) (*v1.ConfigMap, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	configMap, ok := f.configMaps[name]
+	if !ok {
+		return nil, errors.NewNotFound(configMapResource, name)
+	}
+	return configMap.DeepCopy(), nil
+}
+
+// newTestProvider creates a provider of the node "iofog-node" storing its pods in memory.
+func newTestProvider(t *testing.T) *BrokerProvider {
+	t.Helper()
+	store, err := api.NewKeyValueStore(&fakeConfigMaps{configMaps: make(map[string]*v1.ConfigMap)}, "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &BrokerProvider{
+		nodeName: "iofog-node",
+		store:    store,
+		logs:     unsupportedLogSource{},
+		exec:     unsupportedExecBackend{},
+	}
+}
+
+// storeTestPod stores a pod deployed on the node of the test provider, its containers mapped to the given microservices.
+func storeTestPod(t *testing.T, provider *BrokerProvider, name string, microservices map[string]string) *FlowPod {
+	t.Helper()
+	flowPod := &FlowPod{
+		Pod: &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec:       v1.PodSpec{NodeName: provider.nodeName},
+		},
+		Microservices: microservices,
+	}
+	if err := provider.store.Put(name, flowPod); err != nil {
+		t.Fatal(err)
+	}
+	return flowPod
+}
+
+func TestGetPodStatusesSkipsUnreadableEntries(t *testing.T) {
+	provider := newTestProvider(t)
+	storeTestPod(t, provider, "pending", map[string]string{"relay": "uuid"})
+
+	// Neither a corrupted entry nor the pod of another node fail the batch, the latter is not decoded in full.
+	if err := provider.store.Put("corrupted", "not a pod"); err != nil {
+		t.Fatal(err)
+	}
+	other := map[string]interface{}{
+		"Pod":           map[string]interface{}{"spec": map[string]interface{}{"nodeName": "other-node"}},
+		"Microservices": "not a map",
+	}
+	if err := provider.store.Put("other", other); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := provider.GetPodStatuses(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The pending pod has no flow yet, it keeps its status.
+	if len(statuses) != 0 {
+		t.Fatalf("unexpected statuses: %v", statuses)
+	}
+}
+
+func TestStopPodWithoutFlow(t *testing.T) {
+	provider := newTestProvider(t)
+	flowPod := storeTestPod(t, provider, "failed", nil)
+
+	if err := provider.StopPod(context.Background(), flowPod.Pod); !strongerrors.IsNotFound(err) {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+	if _, err := provider.PodStopped(context.Background(), flowPod.Pod); !strongerrors.IsNotFound(err) {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+	for _, name := range []string{"failed", "unknown"} {
+		if _, err := provider.GetPodStatus(context.Background(), "default", name); !strongerrors.IsNotFound(err) {
+			t.Fatalf("expected not found error for %s, got: %v", name, err)
+		}
+	}
+	if err := provider.DeletePod(context.Background(), flowPod.Pod); err != nil {
+		t.Fatal(err)
+	}
+	if provider.store.Size() != 0 {
+		t.Fatalf("expected the pod to be removed from the store, got %v", provider.store.Keys())
+	}
+
+	// A flow which did not react to the stop yet is still running.
+	for _, status := range []string{microserviceQueued, ""} {
+		if microserviceTerminated(status) {
+			t.Errorf("expected %q not to be terminated", status)
+		}
+	}
+}
+
+func TestUpdatePodWithUnreadableEntry(t *testing.T) {
+	provider := newTestProvider(t)
+	if err := provider.store.Put("corrupted", "not a pod"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pod is not deployed again when its entry cannot be read.
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "corrupted"}}
+	if err := provider.UpdatePod(context.Background(), pod); err == nil {
+		t.Fatal("expected an error reading the pod")
+	}
+}
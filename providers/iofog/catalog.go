@@ -0,0 +1,176 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/apps"
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	// DefaultCatalogMaxAge is how long the catalog is cached before it is listed again.
+	DefaultCatalogMaxAge = 5 * time.Minute
+
+	// catalogImagePrefix marks the images naming an item of the catalog, such as catalog://heart-rate.
+	catalogImagePrefix = "catalog://"
+)
+
+// CatalogCache caches the catalog of the ioFog Controller, shared by the providers of every node
+// so that the catalog is listed once for all the pods instead of once per microservice.
+type CatalogCache struct {
+	mutex   sync.Mutex
+	list    CatalogFunc
+	maxAge  time.Duration
+	items   []client.CatalogItemInfo
+	fetched time.Time
+}
+
+// NewCatalogCache creates a cache listing the catalog with list, again once it is older than maxAge.
+func NewCatalogCache(list CatalogFunc, maxAge time.Duration) *CatalogCache {
+	if maxAge <= 0 {
+		maxAge = DefaultCatalogMaxAge
+	}
+	return &CatalogCache{
+		list:   list,
+		maxAge: maxAge,
+	}
+}
+
+// Items returns the items of the catalog, listing them when the cache is empty or stale.
+func (c *CatalogCache) Items() ([]client.CatalogItemInfo, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.items == nil || time.Since(c.fetched) > c.maxAge {
+		if err := c.refresh(); err != nil {
+			return nil, err
+		}
+	}
+	return c.items, nil
+}
+
+// ByName returns the catalog item with a name. The catalog is listed again before an item is reported missing,
+// since it may have been created after the last listing.
+func (c *CatalogCache) ByName(name string) (*client.CatalogItemInfo, error) {
+	items, err := c.Items()
+	if err != nil {
+		return nil, err
+	}
+	if item := catalogItemByName(items, name); item != nil {
+		return item, nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	if item := catalogItemByName(c.items, name); item != nil {
+		return item, nil
+	}
+	return nil, strongerrors.NotFound(errors.Errorf("catalog item %s not found", name))
+}
+
+func (c *CatalogCache) refresh() error {
+	items, err := c.list()
+	if err != nil {
+		return errors.Wrap(err, "error listing the catalog")
+	}
+	if items == nil {
+		items = []client.CatalogItemInfo{}
+	}
+	c.items = items
+	c.fetched = time.Now()
+	return nil
+}
+
+func catalogItemByName(items []client.CatalogItemInfo, name string) *client.CatalogItemInfo {
+	for idx := range items {
+		if items[idx].Name == name {
+			item := items[idx]
+			return &item
+		}
+	}
+	return nil
+}
+
+// catalogItemNames returns the catalog item referenced by the catalog:// image of every microservice, by microservice name.
+func catalogItemNames(microservices []apps.Microservice) map[string]string {
+	names := map[string]string{}
+	for _, microservice := range microservices {
+		if microservice.Images == nil {
+			continue
+		}
+		if name, ok := catalogImageName(microservice.Images.X86); ok {
+			names[microservice.Name] = name
+		} else if name, ok := catalogImageName(microservice.Images.ARM); ok {
+			names[microservice.Name] = name
+		}
+	}
+	return names
+}
+
+// catalogImageName returns the catalog item named by a catalog:// image.
+func catalogImageName(image string) (string, bool) {
+	if !strings.HasPrefix(image, catalogImagePrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(image, catalogImagePrefix), true
+}
+
+// resolveCatalogImages replaces the images of the microservices referencing a catalog item by the ID of the item.
+// The item must have an image for the fog type of the agent.
+func (p *BrokerProvider) resolveCatalogImages(pod *v1.Pod, microservices []apps.Microservice) error {
+	names := catalogItemNames(microservices)
+	if len(names) == 0 {
+		return nil
+	}
+	if p.catalog == nil {
+		return strongerrors.Unavailable(errors.Errorf("pod %s references catalog items, but no catalog is configured", pod.Name))
+	}
+
+	snapshot, err := p.agent()
+	if err != nil {
+		return err
+	}
+	fogType := architectureImages[defaultArchitecture]
+	if agentFogType, ok := fogTypes[snapshot.Agent.FogType]; ok {
+		fogType = agentFogType.name
+	}
+
+	for idx := range microservices {
+		microservice := &microservices[idx]
+		name, ok := names[microservice.Name]
+		if !ok {
+			continue
+		}
+		item, err := p.catalog.ByName(name)
+		if err != nil {
+			return errors.Wrapf(err, "error resolving the image of microservice %s", microservice.Name)
+		}
+		if !catalogItemHasImage(item, fogType) {
+			return strongerrors.InvalidArgument(errors.Errorf("catalog item %s of microservice %s has no %s image for agent %s",
+				name, microservice.Name, fogType, snapshot.Agent.Name))
+		}
+		microservice.Images = &apps.MicroserviceImages{CatalogID: item.ID}
+	}
+	return nil
+}
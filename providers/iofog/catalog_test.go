@@ -0,0 +1,81 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolveCatalogImages(t *testing.T) {
+	listings := 0
+	items := []client.CatalogItemInfo{
+		{ID: 7, Name: "heart-rate", Images: []client.CatalogImage{{ContainerImage: "heart-rate:arm", AgentTypeID: 2}}},
+	}
+	catalog := NewCatalogCache(func() ([]client.CatalogItemInfo, error) {
+		listings++
+		return items, nil
+	}, time.Minute)
+
+	agents := NewAgentCache(time.Minute)
+	agents.Update([]client.AgentInfo{{UUID: "agent", Name: "pi", FogType: 2}})
+	provider := &BrokerProvider{nodeId: "agent", agents: agents, catalog: catalog}
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "sensor",
+			Annotations: map[string]string{catalogAnnotation: `{"viewer":"viewer"}`},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{Name: "reader", Image: "catalog://heart-rate"},
+				{Name: "writer", Image: "writer:1.0"},
+				{Name: "viewer", Image: "viewer:1.0"},
+			},
+		},
+	}
+	microservices, err := podToMicroservices(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The viewer item is created after the catalog was first listed.
+	if err := provider.resolveCatalogImages(pod, microservices[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if images := microservices[0].Images; images.CatalogID != 7 || images.X86 != "" {
+		t.Errorf("expected the reader to run catalog item 7, got %+v", images)
+	}
+	if images := microservices[1].Images; images.CatalogID != 0 || images.X86 != "writer:1.0" {
+		t.Errorf("expected the image of the writer to be kept, got %+v", images)
+	}
+
+	items = append(items, client.CatalogItemInfo{ID: 8, Name: "viewer", Images: []client.CatalogImage{{ContainerImage: "viewer:x86", AgentTypeID: 1}}})
+	err = provider.resolveCatalogImages(pod, microservices[2:])
+	if !strongerrors.IsInvalidArgument(err) {
+		t.Errorf("expected the viewer item without arm image to be refused, got %v", err)
+	}
+	if listings != 2 {
+		t.Errorf("expected the catalog to be listed once, then again for the missing item, got %d listings", listings)
+	}
+
+	if _, err := catalog.ByName("printer"); !strongerrors.IsNotFound(err) {
+		t.Errorf("expected the printer item not to be found, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultDockerPort is the port the Docker daemons of the agents listen on for the Docker log source.
+	DefaultDockerPort = 2375
+	// dockerContainerPrefix prefixes the UUID of a microservice in the name of the container the ioFog Agent runs it in.
+	dockerContainerPrefix = "iofog_"
+	// dockerErrorLimit bounds how much of an error response of the Docker daemon is reported.
+	dockerErrorLimit = 4096
+)
+
+// DockerLogSource reads the logs of the microservices from the Docker Engine API of their agent, since the ioFog
+// Controller does not serve them. The Docker daemon of the agent must listen on plain TCP on the configured port.
+type DockerLogSource struct {
+	agents  *AgentCache
+	agentID string
+	port    int
+	client  *http.Client
+}
+
+// NewDockerLogSource creates a log source reading from the Docker daemon of an agent, found at its IP address.
+func NewDockerLogSource(agents *AgentCache, agentID string, port int) *DockerLogSource {
+	return &DockerLogSource{
+		agents:  agents,
+		agentID: agentID,
+		port:    port,
+		client:  &http.Client{},
+	}
+}
+
+// MicroserviceLogs streams the logs of the container of a microservice.
+func (d *DockerLogSource) MicroserviceLogs(ctx context.Context, microserviceUUID string, opts providers.ContainerLogOpts) (io.ReadCloser, error) {
+	endpoint, err := d.endpoint()
+	if err != nil {
+		return nil, err
+	}
+	container := endpoint + "/containers/" + url.PathEscape(dockerContainerPrefix+microserviceUUID)
+
+	// The logs of a container without TTY are multiplexed, they are only sent raw with a TTY.
+	inspect, err := d.get(ctx, container+"/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer inspect.Close()
+	info := struct {
+		Config struct {
+			Tty bool
+		}
+	}{}
+	if err := json.NewDecoder(inspect).Decode(&info); err != nil {
+		return nil, errors.Wrapf(err, "error decoding the container of microservice %s", microserviceUUID)
+	}
+
+	query := url.Values{"stdout": {"1"}, "stderr": {"1"}}
+	if opts.Follow {
+		query.Set("follow", "1")
+	}
+	if opts.Timestamps {
+		query.Set("timestamps", "1")
+	}
+	if opts.Tail > 0 {
+		query.Set("tail", strconv.Itoa(opts.Tail))
+	}
+	if since := logsSince(opts); !since.IsZero() {
+		query.Set("since", strconv.FormatInt(since.Unix(), 10))
+	}
+	logs, err := d.get(ctx, container+"/logs", query)
+	if err != nil {
+		return nil, err
+	}
+	if info.Config.Tty {
+		return logs, nil
+	}
+	return demuxDockerLogs(logs), nil
+}
+
+// endpoint returns the URL of the Docker daemon of the agent.
+func (d *DockerLogSource) endpoint() (string, error) {
+	snapshot, err := d.agents.Get(d.agentID)
+	if err != nil {
+		return "", err
+	}
+	address := snapshot.Agent.IPAddress
+	if address == "" {
+		address = snapshot.Agent.IPAddressExternal
+	}
+	if address == "" {
+		return "", strongerrors.Unavailable(errors.Errorf("agent %s has no IP address to read the logs from", d.agentID))
+	}
+	return "http://" + net.JoinHostPort(address, strconv.Itoa(d.port)), nil
+}
+
+func (d *DockerLogSource) get(ctx context.Context, endpoint string, query url.Values) (io.ReadCloser, error) {
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, strongerrors.Unavailable(errors.Wrapf(err, "error reaching the Docker daemon of agent %s", d.agentID))
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp.Body, nil
+	}
+
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, dockerErrorLimit))
+	err = errors.Errorf("Docker daemon of agent %s returned %s: %s", d.agentID, resp.Status, body)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, strongerrors.NotFound(err)
+	}
+	return nil, err
+}
+
+// logsSince returns the time from which logs are requested, zero for all of them.
+func logsSince(opts providers.ContainerLogOpts) time.Time {
+	if opts.SinceSeconds > 0 {
+		return time.Now().Add(-time.Duration(opts.SinceSeconds) * time.Second)
+	}
+	return opts.SinceTime
+}
+
+// demuxDockerLogs merges the stdout and stderr frames of the multiplexed logs of a container, each frame starting
+// with a header of 8 bytes whose last 4 are the big endian size of the frame.
+func demuxDockerLogs(stream io.ReadCloser) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		header := make([]byte, 8)
+		for {
+			if _, err := io.ReadFull(stream, header); err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				writer.CloseWithError(err)
+				return
+			}
+			if _, err := io.CopyN(writer, stream, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return &demuxedLogs{PipeReader: reader, stream: stream}
+}
+
+type demuxedLogs struct {
+	*io.PipeReader
+	stream io.Closer
+}
+
+// Close stops the demultiplexing, closing the stream it reads from.
+func (l *demuxedLogs) Close() error {
+	l.PipeReader.Close()
+	return l.stream.Close()
+}
@@ -0,0 +1,88 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
+)
+
+func TestDockerLogSource(t *testing.T) {
+	frame := func(stream byte, data string) []byte {
+		header := make([]byte, 8)
+		header[0] = stream
+		binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+		return append(header, data...)
+	}
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/containers/iofog_relay/json":
+			w.Write([]byte(`{"Config":{"Tty":false}}`))
+		case "/containers/iofog_relay/logs":
+			query = req.URL.Query()
+			w.Write(append(frame(1, "started\n"), frame(2, "warning\n")...))
+		default:
+			http.Error(w, `{"message":"No such container"}`, http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, portValue, err := net.SplitHostPort(serverURL.Host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(portValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agents := NewAgentCache(0)
+	agents.Put(client.AgentInfo{UUID: "agent", IPAddress: host})
+	source := NewDockerLogSource(agents, "agent", port)
+
+	logs, err := source.MicroserviceLogs(context.Background(), "relay", providers.ContainerLogOpts{Tail: 10, Timestamps: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(logs)
+	logs.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "started\nwarning\n" {
+		t.Errorf("unexpected logs %q", data)
+	}
+	if query.Get("tail") != "10" || query.Get("timestamps") != "1" || query.Get("follow") != "" {
+		t.Errorf("unexpected query %v", query)
+	}
+
+	if _, err := source.MicroserviceLogs(context.Background(), "missing", providers.ContainerLogOpts{}); !strongerrors.IsNotFound(err) {
+		t.Errorf("expected not found error, got: %v", err)
+	}
+}
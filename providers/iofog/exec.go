@@ -0,0 +1,72 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// ExecStreams holds the streams attached to a command running in a microservice.
+// Streams which were not requested by the client are nil.
+type ExecStreams struct {
+	Stdin  io.Reader
+	Stdout io.WriteCloser
+	Stderr io.WriteCloser
+	TTY    bool
+	Resize <-chan remotecommand.TerminalSize
+}
+
+// ExecBackend runs commands in ioFog microservices.
+type ExecBackend interface {
+	// Exec runs a command in a microservice and relays its streams until it exits or the context is done.
+	// A non zero exit code is reported with an error implementing k8s.io/client-go/util/exec.ExitError.
+	Exec(ctx context.Context, microserviceUUID string, cmd []string, streams ExecStreams) error
+}
+
+// unsupportedExecBackend is used when no exec backend is available for the ioFog Controller.
+type unsupportedExecBackend struct{}
+
+func (unsupportedExecBackend) Exec(ctx context.Context, microserviceUUID string, cmd []string, streams ExecStreams) error {
+	return strongerrors.NotImplemented(errors.New("exec is not supported by the ioFog Controller"))
+}
+
+// execInMicroservice relays a command to the backend until the context is done, honouring the timeout when set.
+func execInMicroservice(ctx context.Context, backend ExecBackend, microserviceUUID string, cmd []string, streams ExecStreams, timeout time.Duration) error {
+	if len(cmd) == 0 {
+		return strongerrors.InvalidArgument(errors.New("no command specified"))
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Drain resize events nobody listens to so that the sender never blocks.
+	if streams.Resize != nil && !streams.TTY {
+		go func(resize <-chan remotecommand.TerminalSize) {
+			for range resize {
+			}
+		}(streams.Resize)
+		streams.Resize = nil
+	}
+
+	return backend.Exec(ctx, microserviceUUID, cmd, streams)
+}
@@ -0,0 +1,131 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+)
+
+// fakeExecBackend echoes stdin to stdout and exits with the code given as first argument of "exit".
+type fakeExecBackend struct {
+	uuid    string
+	resizes []remotecommand.TerminalSize
+}
+
+func (b *fakeExecBackend) Exec(ctx context.Context, microserviceUUID string, cmd []string, streams ExecStreams) error {
+	b.uuid = microserviceUUID
+	if streams.Resize != nil {
+		for size := range streams.Resize {
+			b.resizes = append(b.resizes, size)
+		}
+	}
+	if cmd[0] == "sleep" {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if cmd[0] == "exit" {
+		return exec.CodeExitError{Err: io.EOF, Code: 3}
+	}
+	_, err := io.Copy(streams.Stdout, streams.Stdin)
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestExecInMicroservice(t *testing.T) {
+	backend := &fakeExecBackend{}
+	out := &bytes.Buffer{}
+	resize := make(chan remotecommand.TerminalSize, 1)
+	resize <- remotecommand.TerminalSize{Width: 80, Height: 24}
+	close(resize)
+
+	streams := ExecStreams{
+		Stdin:  strings.NewReader("hello"),
+		Stdout: nopWriteCloser{out},
+		TTY:    true,
+		Resize: resize,
+	}
+	if err := execInMicroservice(context.Background(), backend, "uuid", []string{"cat"}, streams, 0); err != nil {
+		t.Fatal(err)
+	}
+	if backend.uuid != "uuid" || out.String() != "hello" {
+		t.Fatalf("unexpected exec: uuid %q, output %q", backend.uuid, out.String())
+	}
+	if len(backend.resizes) != 1 || backend.resizes[0].Width != 80 {
+		t.Fatalf("unexpected resize events: %v", backend.resizes)
+	}
+
+	err := execInMicroservice(context.Background(), backend, "uuid", []string{"exit"}, ExecStreams{}, 0)
+	if exitErr, ok := err.(exec.ExitError); !ok || exitErr.ExitStatus() != 3 {
+		t.Fatalf("expected exit code 3, got: %v", err)
+	}
+
+	if err := execInMicroservice(context.Background(), backend, "uuid", []string{"sleep"}, ExecStreams{}, 10*time.Millisecond); err != context.DeadlineExceeded {
+		t.Fatalf("expected the timeout to be exceeded, got: %v", err)
+	}
+
+	if err := execInMicroservice(context.Background(), backend, "uuid", nil, ExecStreams{}, 0); !strongerrors.IsInvalidArgument(err) {
+		t.Fatalf("expected invalid argument error, got: %v", err)
+	}
+
+	if err := execInMicroservice(context.Background(), unsupportedExecBackend{}, "uuid", []string{"ls"}, ExecStreams{}, 0); !strongerrors.IsNotImplemented(err) {
+		t.Fatalf("expected not implemented error, got: %v", err)
+	}
+}
+
+func TestBrokerProviderExecInContainer(t *testing.T) {
+	provider := newTestProvider(t)
+	storeTestPod(t, provider, "sensor", map[string]string{"relay": "relay-uuid", "reader": "reader-uuid"})
+
+	if err := provider.ExecInContainer(context.Background(), "sensor", "", "relay", []string{"ls"}, nil, nil, nil, false, nil, 0); !strongerrors.IsNotImplemented(err) {
+		t.Fatalf("expected not implemented error, got: %v", err)
+	}
+
+	backend := &fakeExecBackend{}
+	provider.exec = backend
+	out := &bytes.Buffer{}
+	if err := provider.ExecInContainer(context.Background(), "sensor", "", "reader", []string{"cat"}, strings.NewReader("hello"), nopWriteCloser{out}, nil, false, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if backend.uuid != "reader-uuid" || out.String() != "hello" {
+		t.Fatalf("unexpected exec: uuid %q, output %q", backend.uuid, out.String())
+	}
+
+	// The command stops with the request.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := provider.ExecInContainer(ctx, "sensor", "", "relay", []string{"sleep"}, nil, nil, nil, false, nil, 0); err != context.Canceled {
+		t.Fatalf("expected the exec to be cancelled, got: %v", err)
+	}
+
+	if err := provider.ExecInContainer(context.Background(), "sensor", "", "unknown", []string{"ls"}, nil, nil, nil, false, nil, 0); !strongerrors.IsNotFound(err) {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+	if err := provider.ExecInContainer(context.Background(), "unknown", "", "relay", []string{"ls"}, nil, nil, nil, false, nil, 0); !strongerrors.IsNotFound(err) {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+}
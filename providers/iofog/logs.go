@@ -0,0 +1,51 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"context"
+	"io"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
+	"github.com/pkg/errors"
+)
+
+// LogSource retrieves the logs of ioFog microservices.
+type LogSource interface {
+	// MicroserviceLogs streams the logs of a microservice.
+	// Implementations handle the tail, follow, since and timestamps options, the byte limit is applied by the caller.
+	MicroserviceLogs(ctx context.Context, microserviceUUID string, opts providers.ContainerLogOpts) (io.ReadCloser, error)
+}
+
+// unsupportedLogSource is used when no log source is configured: the ioFog Controller has no API serving the logs of
+// the microservices, they are only read from another source such as the DockerLogSource.
+type unsupportedLogSource struct{}
+
+func (unsupportedLogSource) MicroserviceLogs(ctx context.Context, microserviceUUID string, opts providers.ContainerLogOpts) (io.ReadCloser, error) {
+	return nil, strongerrors.NotImplemented(errors.New("the ioFog Controller has no API serving the logs of microservices and no log source is configured"))
+}
+
+// limitReadCloser returns at most limit bytes of a stream, all of it when limit is zero.
+func limitReadCloser(rc io.ReadCloser, limit int64) io.ReadCloser {
+	if limit <= 0 {
+		return rc
+	}
+	return &limitedReadCloser{Reader: io.LimitReader(rc, limit), Closer: rc}
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
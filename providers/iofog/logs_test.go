@@ -0,0 +1,69 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
+)
+
+// fakeLogSource serves the same logs for every microservice and records the last request.
+type fakeLogSource struct {
+	uuid string
+	opts providers.ContainerLogOpts
+}
+
+func (s *fakeLogSource) MicroserviceLogs(ctx context.Context, microserviceUUID string, opts providers.ContainerLogOpts) (io.ReadCloser, error) {
+	s.uuid, s.opts = microserviceUUID, opts
+	return ioutil.NopCloser(strings.NewReader("first line\nsecond line\n")), nil
+}
+
+func TestGetContainerLogs(t *testing.T) {
+	provider := newTestProvider(t)
+	storeTestPod(t, provider, "sensor", map[string]string{"relay": "uuid"})
+
+	if _, err := provider.GetContainerLogs(context.Background(), "default", "sensor", "relay", providers.ContainerLogOpts{}); !strongerrors.IsNotImplemented(err) {
+		t.Fatalf("expected not implemented error, got: %v", err)
+	}
+
+	source := &fakeLogSource{}
+	provider.logs = source
+	opts := providers.ContainerLogOpts{Tail: 5, Follow: true, LimitBytes: 10}
+	logs, err := provider.GetContainerLogs(context.Background(), "default", "sensor", "relay", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logs.Close()
+
+	b, err := ioutil.ReadAll(logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "first line" {
+		t.Fatalf("unexpected logs: %q", string(b))
+	}
+	if source.uuid != "uuid" || source.opts.Tail != 5 || !source.opts.Follow {
+		t.Fatalf("unexpected request for %q with %+v", source.uuid, source.opts)
+	}
+
+	if _, err := provider.GetContainerLogs(context.Background(), "default", "sensor", "unknown", opts); !strongerrors.IsNotFound(err) {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/apps"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+)
+
+const (
+	// microservicesAnnotation holds an optional JSON list of apps.Microservice overriding the pod containers.
+	microservicesAnnotation = "microservices"
+	// routesAnnotation holds an optional JSON list of apps.Route between the pod microservices.
+	routesAnnotation = "routes"
+	// catalogAnnotation holds an optional JSON object mapping microservice names to the catalog items they run.
+	catalogAnnotation = "catalog"
+
+	defaultRegistry   = "remote"
+	volumeAccessRead  = "ro"
+	volumeAccessWrite = "rw"
+)
+
+// podToMicroservices builds the microservices of a pod from its containers.
+// Entries of the microservices annotation replace the container with the same name, other entries are appended.
+// Microservices listed in the catalog annotation get the catalog:// image of their catalog item.
+func podToMicroservices(pod *v1.Pod) ([]apps.Microservice, error) {
+	microservices := make([]apps.Microservice, 0, len(pod.Spec.Containers))
+	for idx := range pod.Spec.Containers {
+		microservice, err := containerToMicroservice(pod, &pod.Spec.Containers[idx])
+		if err != nil {
+			return nil, err
+		}
+		microservices = append(microservices, microservice)
+	}
+
+	overrides := []apps.Microservice{}
+	if err := unmarshalAnnotation(pod, microservicesAnnotation, &overrides); err != nil {
+		return nil, err
+	}
+
+	for _, override := range overrides {
+		replaced := false
+		for idx := range microservices {
+			if microservices[idx].Name == override.Name {
+				microservices[idx] = override
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			microservices = append(microservices, override)
+		}
+	}
+
+	catalogItems := map[string]string{}
+	if err := unmarshalAnnotation(pod, catalogAnnotation, &catalogItems); err != nil {
+		return nil, err
+	}
+	for idx := range microservices {
+		if name, ok := catalogItems[microservices[idx].Name]; ok {
+			microservices[idx].Images = &apps.MicroserviceImages{
+				X86: catalogImagePrefix + name,
+				ARM: catalogImagePrefix + name,
+			}
+		}
+	}
+
+	return microservices, nil
+}
+
+// podToRoutes returns the routes declared by the routes annotation of a pod, if any.
+func podToRoutes(pod *v1.Pod) ([]apps.Route, error) {
+	routes := []apps.Route{}
+	if err := unmarshalAnnotation(pod, routesAnnotation, &routes); err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
+
+// containerToMicroservice translates a Kubernetes container into an ioFog microservice.
+// The environment is expected to be already resolved into plain values.
+func containerToMicroservice(pod *v1.Pod, container *v1.Container) (apps.Microservice, error) {
+	ports, err := containerPorts(container)
+	if err != nil {
+		return apps.Microservice{}, err
+	}
+
+	env := make([]apps.MicroserviceEnvironment, 0, len(container.Env))
+	for _, envVar := range container.Env {
+		env = append(env, apps.MicroserviceEnvironment{
+			Key:   envVar.Name,
+			Value: envVar.Value,
+		})
+	}
+
+	volumes := containerVolumes(pod, container)
+
+	var commands []string
+	if len(container.Command) > 0 || len(container.Args) > 0 {
+		commands = make([]string, 0, len(container.Command)+len(container.Args))
+		commands = append(commands, container.Command...)
+		commands = append(commands, container.Args...)
+	}
+
+	rootHostAccess := false
+	if container.SecurityContext != nil && container.SecurityContext.Privileged != nil {
+		rootHostAccess = *container.SecurityContext.Privileged
+	}
+
+	return apps.Microservice{
+		Name: container.Name,
+		Images: &apps.MicroserviceImages{
+			X86:      container.Image,
+			ARM:      container.Image,
+			Registry: defaultRegistry,
+		},
+		Container: apps.MicroserviceContainer{
+			Commands:       commands,
+			Volumes:        &volumes,
+			Env:            &env,
+			Ports:          ports,
+			RootHostAccess: rootHostAccess,
+		},
+		Config: apps.NestedMap{},
+	}, nil
+}
+
+func containerPorts(container *v1.Container) ([]apps.MicroservicePortMapping, error) {
+	ports := make([]apps.MicroservicePortMapping, 0, len(container.Ports))
+	for _, port := range container.Ports {
+		if port.Protocol != "" && port.Protocol != v1.ProtocolTCP {
+			return nil, errors.Errorf("container %q: protocol %s of port %d is not supported", container.Name, port.Protocol, port.ContainerPort)
+		}
+
+		external := port.HostPort
+		if external == 0 {
+			external = port.ContainerPort
+		}
+		ports = append(ports, apps.MicroservicePortMapping{
+			Internal: int(port.ContainerPort),
+			External: int(external),
+		})
+	}
+	return ports, nil
+}
+
+// containerVolumes maps the volume mounts of a container backed by hostPath or emptyDir volumes.
+// emptyDir volumes become Docker named volumes scoped to the pod, other volume types are skipped.
+func containerVolumes(pod *v1.Pod, container *v1.Container) []apps.MicroserviceVolumeMapping {
+	volumes := make([]apps.MicroserviceVolumeMapping, 0, len(container.VolumeMounts))
+	for _, mount := range container.VolumeMounts {
+		source := ""
+		for _, volume := range pod.Spec.Volumes {
+			if volume.Name != mount.Name {
+				continue
+			}
+			switch {
+			case volume.HostPath != nil:
+				source = volume.HostPath.Path
+				if mount.SubPath != "" {
+					source = strings.TrimSuffix(source, "/") + "/" + mount.SubPath
+				}
+			case volume.EmptyDir != nil:
+				source = fmt.Sprintf("%s-%s", pod.Name, volume.Name)
+			}
+			break
+		}
+
+		if source == "" {
+			log.L.WithFields(log.Fields{
+				"pod":       pod.Name,
+				"container": container.Name,
+				"volume":    mount.Name,
+			}).Warn("Skipping volume mount which is not backed by a hostPath or emptyDir volume")
+			continue
+		}
+
+		accessMode := volumeAccessWrite
+		if mount.ReadOnly {
+			accessMode = volumeAccessRead
+		}
+		volumes = append(volumes, apps.MicroserviceVolumeMapping{
+			HostDestination:      source,
+			ContainerDestination: mount.MountPath,
+			AccessMode:           accessMode,
+		})
+	}
+	return volumes
+}
+
+func unmarshalAnnotation(pod *v1.Pod, annotation string, target interface{}) error {
+	value, ok := pod.Annotations[annotation]
+	if !ok || strings.TrimSpace(value) == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(value), target); err != nil {
+		return errors.Wrapf(err, "invalid %s annotation", annotation)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPodToMicroservices(t *testing.T) {
+	privileged := true
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "sensor",
+			Annotations: map[string]string{
+				microservicesAnnotation: `[{"name":"viewer","images":{"x86":"viewer:x86","arm":"viewer:arm"}}]`,
+			},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{
+					Name:    "reader",
+					Image:   "reader:1.0",
+					Command: []string{"/bin/reader"},
+					Args:    []string{"--verbose"},
+					Env:     []v1.EnvVar{{Name: "LEVEL", Value: "debug"}},
+					Ports: []v1.ContainerPort{
+						{ContainerPort: 80},
+						{ContainerPort: 443, HostPort: 8443},
+					},
+					VolumeMounts: []v1.VolumeMount{
+						{Name: "data", MountPath: "/data", ReadOnly: true},
+						{Name: "cache", MountPath: "/cache"},
+						{Name: "token", MountPath: "/var/run/secrets"},
+					},
+					SecurityContext: &v1.SecurityContext{Privileged: &privileged},
+				},
+			},
+			Volumes: []v1.Volume{
+				{Name: "data", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/var/data"}}},
+				{Name: "cache", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+				{Name: "token", VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: "token"}}},
+			},
+		},
+	}
+
+	microservices, err := podToMicroservices(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(microservices) != 2 {
+		t.Fatalf("expected 2 microservices, got %d", len(microservices))
+	}
+
+	reader := microservices[0]
+	if reader.Name != "reader" || reader.Images.X86 != "reader:1.0" || reader.Images.ARM != "reader:1.0" {
+		t.Fatalf("unexpected microservice: %+v", reader)
+	}
+	if len(reader.Container.Commands) != 2 || reader.Container.Commands[1] != "--verbose" {
+		t.Fatalf("unexpected commands: %v", reader.Container.Commands)
+	}
+	if env := *reader.Container.Env; len(env) != 1 || env[0].Key != "LEVEL" || env[0].Value != "debug" {
+		t.Fatalf("unexpected env: %v", env)
+	}
+	ports := reader.Container.Ports
+	if len(ports) != 2 || ports[0].External != 80 || ports[1].Internal != 443 || ports[1].External != 8443 {
+		t.Fatalf("unexpected ports: %v", ports)
+	}
+	volumes := *reader.Container.Volumes
+	if len(volumes) != 2 {
+		t.Fatalf("expected 2 volumes, got %v", volumes)
+	}
+	if volumes[0].HostDestination != "/var/data" || volumes[0].AccessMode != volumeAccessRead {
+		t.Fatalf("unexpected hostPath volume: %+v", volumes[0])
+	}
+	if volumes[1].HostDestination != "sensor-cache" || volumes[1].AccessMode != volumeAccessWrite {
+		t.Fatalf("unexpected emptyDir volume: %+v", volumes[1])
+	}
+	if !reader.Container.RootHostAccess {
+		t.Fatal("expected root host access for a privileged container")
+	}
+
+	if viewer := microservices[1]; viewer.Name != "viewer" || viewer.Images.ARM != "viewer:arm" {
+		t.Fatalf("unexpected annotation microservice: %+v", viewer)
+	}
+}
+
+func TestPodToMicroservicesOverride(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "sensor",
+			Annotations: map[string]string{
+				microservicesAnnotation: `[{"name":"reader","images":{"x86":"custom:x86"}}]`,
+			},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{Name: "reader", Image: "reader:1.0"}},
+		},
+	}
+
+	microservices, err := podToMicroservices(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(microservices) != 1 || microservices[0].Images.X86 != "custom:x86" {
+		t.Fatalf("expected the annotation to override the container, got %+v", microservices)
+	}
+}
+
+func TestPodToMicroservicesInvalid(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{routesAnnotation: `{`},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:  "reader",
+				Ports: []v1.ContainerPort{{ContainerPort: 53, Protocol: v1.ProtocolUDP}},
+			}},
+		},
+	}
+
+	if _, err := podToMicroservices(pod); err == nil {
+		t.Fatal("expected an error for an UDP port")
+	}
+	if _, err := podToRoutes(pod); err == nil {
+		t.Fatal("expected an error for a malformed routes annotation")
+	}
+}
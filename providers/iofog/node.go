@@ -0,0 +1,211 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	LabelArch           = "kubernetes.io/arch"
+	LabelArchBeta       = "beta.kubernetes.io/arch"
+	LabelRegion         = "topology.kubernetes.io/region"
+	LabelZone           = "topology.kubernetes.io/zone"
+	LabelRegionBeta     = "failure-domain.beta.kubernetes.io/region"
+	LabelZoneBeta       = "failure-domain.beta.kubernetes.io/zone"
+	LabelRouterMode     = "iofog.org/router-mode"
+	LabelAgentName      = "iofog.org/agent-name"
+	LabelAgentVersion   = "iofog.org/agent-version"
+	LabelFogType        = "iofog.org/fog-type"
+	AnnotationLocation  = "iofog.org/location"
+	AnnotationLatitude  = "iofog.org/latitude"
+	AnnotationLongitude = "iofog.org/longitude"
+
+	// defaultArchitecture is used while the ioFog Controller does not know the architecture of an agent.
+	defaultArchitecture = "amd64"
+)
+
+// fogTypes are the architectures of the fog types of the ioFog Controller.
+var fogTypes = map[int]struct {
+	name         string
+	architecture string
+}{
+	1: {name: "x86", architecture: "amd64"},
+	2: {name: "arm", architecture: "arm"},
+}
+
+// NodeMetadata describes the node after the agent: its architecture, topology, router mode, name and version,
+// along with the taints, labels and annotations of the node policy.
+func (p *BrokerProvider) NodeMetadata(ctx context.Context) (*providers.NodeMetadata, error) {
+	snapshot, err := p.agent()
+	if err != nil {
+		return nil, err
+	}
+	metadata := agentNodeMetadata(&snapshot.Agent)
+	if p.nodePolicy != nil {
+		p.nodePolicy().apply(&snapshot.Agent, metadata)
+	}
+	return metadata, nil
+}
+
+// agent returns the snapshot of the agent of the node, fetching it when there is no shared cache.
+func (p *BrokerProvider) agent() (AgentSnapshot, error) {
+	if p.agents != nil {
+		return p.agents.Get(p.nodeId)
+	}
+	agent, err := p.client.GetAgentByID(p.nodeId)
+	if err != nil {
+		return AgentSnapshot{}, err
+	}
+	return AgentSnapshot{Agent: *agent, Fetched: time.Now()}, nil
+}
+
+// agentNodeConditions maps the status of an agent to node conditions, heartbeating at the last status of the agent.
+func agentNodeConditions(agent *client.AgentInfo) []v1.NodeCondition {
+	heartbeat := metav1.Now()
+	if agent.LastStatusTimeMsUTC > 0 {
+		heartbeat = metav1.NewTime(time.Unix(0, agent.LastStatusTimeMsUTC*int64(time.Millisecond)))
+	}
+
+	ready, readyReason, readyMessage := v1.ConditionFalse, "AgentNotRunning", "ioFog agent daemon is "+agent.DaemonStatus
+	if agent.DaemonStatus == "RUNNING" {
+		ready, readyReason, readyMessage = v1.ConditionTrue, "AgentRunning", "ioFog agent daemon is running"
+	}
+
+	// The messages do not carry the live usage, so that the conditions only change with their status.
+	outOfDisk := nodeCondition(v1.NodeOutOfDisk, v1.ConditionFalse, heartbeat, "AgentHasSufficientDisk", "ioFog agent has sufficient disk space available")
+	diskPressure := nodeCondition(v1.NodeDiskPressure, v1.ConditionFalse, heartbeat, "AgentHasNoDiskPressure", "ioFog agent has no disk pressure")
+	memoryPressure := nodeCondition(v1.NodeMemoryPressure, v1.ConditionFalse, heartbeat, "AgentHasSufficientMemory", "ioFog agent has sufficient memory available")
+	if agent.DiskLimit > 0 {
+		if int64(agent.DiskUsage) >= agent.DiskLimit {
+			outOfDisk = nodeCondition(v1.NodeOutOfDisk, v1.ConditionTrue, heartbeat, "AgentOutOfDisk", "ioFog agent disk usage reached its limit")
+		}
+		if agent.DiskUsage/float64(agent.DiskLimit) >= 0.9 {
+			diskPressure = nodeCondition(v1.NodeDiskPressure, v1.ConditionTrue, heartbeat, "AgentHasDiskPressure", "ioFog agent disk usage is above 90% of its limit")
+		}
+	}
+	if agent.MemoryLimit > 0 && agent.MemoryUsage/float64(agent.MemoryLimit) >= 0.9 {
+		memoryPressure = nodeCondition(v1.NodeMemoryPressure, v1.ConditionTrue, heartbeat, "AgentHasInsufficientMemory", "ioFog agent memory usage is above 90% of its limit")
+	}
+
+	return []v1.NodeCondition{
+		nodeCondition(v1.NodeReady, ready, heartbeat, readyReason, readyMessage),
+		outOfDisk,
+		memoryPressure,
+		diskPressure,
+		nodeCondition(v1.NodeNetworkUnavailable, v1.ConditionFalse, heartbeat, "", ""),
+	}
+}
+
+// unknownNodeConditions reports every condition as Unknown, when the status of the agent is not known.
+func unknownNodeConditions(heartbeat metav1.Time, message string) []v1.NodeCondition {
+	const reason = "NodeStatusUnknown"
+	return []v1.NodeCondition{
+		nodeCondition(v1.NodeReady, v1.ConditionUnknown, heartbeat, reason, message),
+		nodeCondition(v1.NodeOutOfDisk, v1.ConditionUnknown, heartbeat, reason, message),
+		nodeCondition(v1.NodeMemoryPressure, v1.ConditionUnknown, heartbeat, reason, message),
+		nodeCondition(v1.NodeDiskPressure, v1.ConditionUnknown, heartbeat, reason, message),
+		nodeCondition(v1.NodeNetworkUnavailable, v1.ConditionUnknown, heartbeat, reason, message),
+	}
+}
+
+func nodeCondition(conditionType v1.NodeConditionType, status v1.ConditionStatus, heartbeat metav1.Time, reason, message string) v1.NodeCondition {
+	return v1.NodeCondition{
+		Type:               conditionType,
+		Status:             status,
+		LastHeartbeatTime:  heartbeat,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+}
+
+// agentNodeMetadata maps an agent to node metadata.
+// A location of the form region/zone sets both topology labels, any other location only sets the region.
+func agentNodeMetadata(agent *client.AgentInfo) *providers.NodeMetadata {
+	metadata := &providers.NodeMetadata{
+		Architecture: defaultArchitecture,
+		Labels:       make(map[string]string),
+		Annotations:  make(map[string]string),
+	}
+
+	if fogType, ok := fogTypes[agent.FogType]; ok {
+		metadata.Architecture = fogType.architecture
+		metadata.Labels[LabelFogType] = fogType.name
+	}
+	metadata.Labels[LabelArch] = metadata.Architecture
+	metadata.Labels[LabelArchBeta] = metadata.Architecture
+
+	if location := strings.TrimSpace(agent.Location); location != "" {
+		metadata.Annotations[AnnotationLocation] = location
+
+		parts := strings.SplitN(location, "/", 2)
+		if region := labelValue(parts[0]); region != "" {
+			metadata.Labels[LabelRegion] = region
+			metadata.Labels[LabelRegionBeta] = region
+		}
+		if len(parts) == 2 {
+			if zone := labelValue(parts[1]); zone != "" {
+				metadata.Labels[LabelZone] = zone
+				metadata.Labels[LabelZoneBeta] = zone
+			}
+		}
+	}
+
+	if agent.Latitude != 0 || agent.Longitude != 0 {
+		metadata.Annotations[AnnotationLatitude] = strconv.FormatFloat(agent.Latitude, 'f', -1, 64)
+		metadata.Annotations[AnnotationLongitude] = strconv.FormatFloat(agent.Longitude, 'f', -1, 64)
+	}
+
+	setLabel(metadata.Labels, LabelRouterMode, agent.RouterMode)
+	setLabel(metadata.Labels, LabelAgentName, agent.Name)
+	setLabel(metadata.Labels, LabelAgentVersion, agent.Version)
+
+	return metadata
+}
+
+func setLabel(labels map[string]string, key, value string) {
+	if value = labelValue(value); value != "" {
+		labels[key] = value
+	}
+}
+
+// labelValue turns free text into a valid label value, replacing the invalid characters with dashes.
+func labelValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '-'
+	}, strings.TrimSpace(value))
+
+	if len(value) > validation.LabelValueMaxLength {
+		value = value[:validation.LabelValueMaxLength]
+	}
+	value = strings.Trim(value, "-_.")
+	if len(validation.IsValidLabelValue(value)) > 0 {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,64 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"testing"
+
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+)
+
+func TestAgentNodeMetadata(t *testing.T) {
+	metadata := agentNodeMetadata(&client.AgentInfo{
+		Name:       "Raspberry Pi #3",
+		Location:   "eu-west/Paris 11e",
+		Latitude:   48.85,
+		Longitude:  2.35,
+		FogType:    2,
+		RouterMode: "edge",
+		Version:    "2.0.0",
+	})
+
+	if metadata.Architecture != "arm" {
+		t.Errorf("expected arm, got %s", metadata.Architecture)
+	}
+	expected := map[string]string{
+		LabelArch:         "arm",
+		LabelArchBeta:     "arm",
+		LabelFogType:      "arm",
+		LabelRegion:       "eu-west",
+		LabelRegionBeta:   "eu-west",
+		LabelZone:         "Paris-11e",
+		LabelZoneBeta:     "Paris-11e",
+		LabelRouterMode:   "edge",
+		LabelAgentName:    "Raspberry-Pi--3",
+		LabelAgentVersion: "2.0.0",
+	}
+	if len(metadata.Labels) != len(expected) {
+		t.Errorf("expected labels %v, got %v", expected, metadata.Labels)
+	}
+	for key, value := range expected {
+		if metadata.Labels[key] != value {
+			t.Errorf("expected label %s=%s, got %q", key, value, metadata.Labels[key])
+		}
+	}
+	if metadata.Annotations[AnnotationLatitude] != "48.85" || metadata.Annotations[AnnotationLocation] != "eu-west/Paris 11e" {
+		t.Errorf("unexpected annotations %v", metadata.Annotations)
+	}
+
+	metadata = agentNodeMetadata(&client.AgentInfo{Name: "-"})
+	if metadata.Architecture != defaultArchitecture || len(metadata.Labels) != 2 || len(metadata.Annotations) != 0 {
+		t.Errorf("unexpected metadata for an unknown agent: %v", metadata)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"strconv"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// NodePolicy assigns taints, labels and annotations to the nodes of the agents matched by its rules.
+// Rules are applied in order, a later rule overrides what an earlier rule set.
+type NodePolicy struct {
+	Rules []NodePolicyRule `json:"rules"`
+}
+
+// NodePolicyRule assigns taints, labels and annotations to the nodes of the matching agents.
+type NodePolicyRule struct {
+	Match       AgentSelector     `json:"match"`
+	Taints      []v1.Taint        `json:"taints,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// AgentSelector matches agents with glob patterns.
+// An agent matches when every non empty list has a matching pattern, an empty selector matches every agent.
+type AgentSelector struct {
+	Names        []string `json:"names,omitempty"`
+	UUIDs        []string `json:"uuids,omitempty"`
+	FogTypes     []string `json:"fogTypes,omitempty"`
+	Descriptions []string `json:"descriptions,omitempty"`
+}
+
+// ParseNodePolicy parses and validates a policy in YAML or JSON.
+func ParseNodePolicy(data []byte) (*NodePolicy, error) {
+	data, err := yaml.ToJSON(data)
+	if err != nil {
+		return nil, strongerrors.InvalidArgument(errors.Wrap(err, "error parsing node policy"))
+	}
+
+	policy := &NodePolicy{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(policy); err != nil {
+		return nil, strongerrors.InvalidArgument(errors.Wrap(err, "error parsing node policy"))
+	}
+	if err := policy.validate(); err != nil {
+		return nil, strongerrors.InvalidArgument(err)
+	}
+	return policy, nil
+}
+
+func (p *NodePolicy) validate() error {
+	for idx, rule := range p.Rules {
+		patterns := [][]string{rule.Match.Names, rule.Match.UUIDs, rule.Match.FogTypes, rule.Match.Descriptions}
+		for _, list := range patterns {
+			for _, pattern := range list {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return errors.Wrapf(err, "rule %d: invalid pattern %q", idx, pattern)
+				}
+			}
+		}
+		for _, taint := range rule.Taints {
+			if errs := validation.IsQualifiedName(taint.Key); len(errs) > 0 {
+				return errors.Errorf("rule %d: invalid taint key %q: %v", idx, taint.Key, errs)
+			}
+			switch taint.Effect {
+			case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+			default:
+				return errors.Errorf("rule %d: invalid effect %q of taint %s", idx, taint.Effect, taint.Key)
+			}
+		}
+		for key, value := range rule.Labels {
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return errors.Errorf("rule %d: invalid label key %q: %v", idx, key, errs)
+			}
+			if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+				return errors.Errorf("rule %d: invalid value of label %s: %v", idx, key, errs)
+			}
+		}
+		for key := range rule.Annotations {
+			if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+				return errors.Errorf("rule %d: invalid annotation key %q: %v", idx, key, errs)
+			}
+		}
+	}
+	return nil
+}
+
+// apply adds the taints, labels and annotations of the rules matching the agent to the metadata.
+func (p *NodePolicy) apply(agent *client.AgentInfo, metadata *providers.NodeMetadata) {
+	if p == nil {
+		return
+	}
+	for _, rule := range p.Rules {
+		if !rule.Match.matches(agent) {
+			continue
+		}
+		for _, taint := range rule.Taints {
+			metadata.Taints = setTaint(metadata.Taints, taint)
+		}
+		for key, value := range rule.Labels {
+			metadata.Labels[key] = value
+		}
+		for key, value := range rule.Annotations {
+			metadata.Annotations[key] = value
+		}
+	}
+}
+
+func (s *AgentSelector) matches(agent *client.AgentInfo) bool {
+	fogType := []string{strconv.Itoa(agent.FogType)}
+	if known, ok := fogTypes[agent.FogType]; ok {
+		fogType = append(fogType, known.name)
+	}
+	return matchesAny(s.Names, agent.Name) &&
+		matchesAny(s.UUIDs, agent.UUID) &&
+		matchesAny(s.FogTypes, fogType...) &&
+		matchesAny(s.Descriptions, agent.Description)
+}
+
+// matchesAny reports whether a pattern matches one of the values, an empty list matches everything.
+func matchesAny(patterns []string, values ...string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if matched, _ := path.Match(pattern, value); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// setTaint adds a taint, replacing the taint with the same key and effect.
+func setTaint(taints []v1.Taint, taint v1.Taint) []v1.Taint {
+	for idx := range taints {
+		if taints[idx].Key == taint.Key && taints[idx].Effect == taint.Effect {
+			taints[idx] = taint
+			return taints
+		}
+	}
+	return append(taints, taint)
+}
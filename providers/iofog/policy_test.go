@@ -0,0 +1,78 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"testing"
+
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	v1 "k8s.io/api/core/v1"
+)
+
+const testNodePolicy = `
+rules:
+- match:
+    fogTypes: [arm]
+  taints:
+  - key: iofog.org/arm
+    effect: NoSchedule
+  labels:
+    class: small
+- match:
+    names: ["camera-*"]
+    descriptions: ["*outdoor*"]
+  taints:
+  - key: iofog.org/arm
+    value: camera
+    effect: NoSchedule
+  labels:
+    class: camera
+  annotations:
+    iofog.org/owner: vision
+`
+
+func TestNodePolicy(t *testing.T) {
+	policy, err := ParseNodePolicy([]byte(testNodePolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	camera := &client.AgentInfo{UUID: "1", Name: "camera-1", Description: "outdoor camera", FogType: 2}
+	metadata := agentNodeMetadata(camera)
+	policy.apply(camera, metadata)
+	if metadata.Labels["class"] != "camera" || metadata.Annotations["iofog.org/owner"] != "vision" {
+		t.Errorf("expected the camera rule to override the arm rule, got %v %v", metadata.Labels, metadata.Annotations)
+	}
+	if len(metadata.Taints) != 1 || metadata.Taints[0].Value != "camera" || metadata.Taints[0].Effect != v1.TaintEffectNoSchedule {
+		t.Errorf("unexpected taints %v", metadata.Taints)
+	}
+
+	server := &client.AgentInfo{UUID: "2", Name: "camera-2", Description: "indoor", FogType: 1}
+	metadata = agentNodeMetadata(server)
+	policy.apply(server, metadata)
+	if _, ok := metadata.Labels["class"]; ok || len(metadata.Taints) != 0 {
+		t.Errorf("expected no rule to match, got %v %v", metadata.Labels, metadata.Taints)
+	}
+
+	for _, invalid := range []string{
+		"rules: [{match: {names: ['[']}}]",
+		"rules: [{taints: [{key: a, effect: Sometimes}]}]",
+		"rules: [{labels: {a: 'not valid'}}]",
+		"rules: [{selector: {}}]",
+	} {
+		if _, err := ParseNodePolicy([]byte(invalid)); err == nil {
+			t.Errorf("expected %q to be invalid", invalid)
+		}
+	}
+}
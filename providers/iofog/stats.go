@@ -0,0 +1,192 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	stats "k8s.io/kubernetes/pkg/kubelet/apis/stats/v1alpha1"
+)
+
+const (
+	// statsCacheTTL is how long a stats summary is served before the controller is asked again.
+	statsCacheTTL = 15 * time.Second
+
+	megabyte = 1024 * 1024
+	gigabyte = 1024 * megabyte
+	// nanoCoresPerPercent converts the CPU usage percentage reported by the agent to nano cores.
+	nanoCoresPerPercent = 1e7
+)
+
+// statsCache serves a stats summary for at most ttl before refreshing it.
+// Concurrent scrapes wait for a single refresh instead of all hitting the controller.
+type statsCache struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	refresh func(ctx context.Context) (*stats.Summary, error)
+	summary *stats.Summary
+	updated time.Time
+}
+
+func newStatsCache(ttl time.Duration, refresh func(ctx context.Context) (*stats.Summary, error)) *statsCache {
+	return &statsCache{ttl: ttl, refresh: refresh}
+}
+
+func (c *statsCache) get(ctx context.Context) (*stats.Summary, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.summary != nil && time.Since(c.updated) < c.ttl {
+		return c.summary, nil
+	}
+
+	summary, err := c.refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.summary = summary
+	c.updated = time.Now()
+	return summary, nil
+}
+
+// GetStatsSummary returns the resource usage of the agent and of the microservices of the pods it runs.
+func (p *BrokerProvider) GetStatsSummary(ctx context.Context) (*stats.Summary, error) {
+	return p.stats.get(ctx)
+}
+
+func (p *BrokerProvider) buildStatsSummary(ctx context.Context) (*stats.Summary, error) {
+	snapshot, err := p.agent()
+	if err != nil {
+		return nil, err
+	}
+	agent := &snapshot.Agent
+
+	pods, err := p.GetPods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := metav1.Now()
+	summary := &stats.Summary{
+		Node: agentToNodeStats(p.nodeName, agent, now),
+		Pods: make([]stats.PodStats, 0, len(pods)),
+	}
+	for _, pod := range pods {
+		flowPod, err := p.getFlowPod(pod.Name)
+		if err != nil {
+			return nil, err
+		}
+		if flowPod.FlowInfo == nil {
+			continue
+		}
+		microservices, err := p.client.GetMicroservicesPerFlow(flowPod.FlowInfo.ID)
+		if err != nil {
+			return nil, err
+		}
+		summary.Pods = append(summary.Pods, microservicesToPodStats(pod, microservices.Microservices, now))
+	}
+	return summary, nil
+}
+
+// agentToNodeStats converts the usage reported by an agent, in percent of CPU and megabytes of memory and disk.
+func agentToNodeStats(nodeName string, agent *client.AgentInfo, now metav1.Time) stats.NodeStats {
+	nodeStats := stats.NodeStats{
+		NodeName:  nodeName,
+		StartTime: metav1.NewTime(now.Add(-time.Duration(agent.UptimeMs) * time.Millisecond)),
+		CPU:       cpuStats(agent.CPUUsage, now),
+		Memory: &stats.MemoryStats{
+			Time:            now,
+			UsageBytes:      uint64Ptr(agent.MemoryUsage * megabyte),
+			WorkingSetBytes: uint64Ptr(agent.MemoryUsage * megabyte),
+		},
+		Fs: &stats.FsStats{
+			Time:      now,
+			UsedBytes: uint64Ptr(agent.DiskUsage * megabyte),
+		},
+	}
+
+	if agent.MemoryLimit > 0 {
+		nodeStats.Memory.AvailableBytes = uint64Ptr(float64(agent.MemoryLimit)*megabyte - agent.MemoryUsage*megabyte)
+	}
+	if agent.DiskLimit > 0 {
+		capacity := float64(agent.DiskLimit) * gigabyte
+		nodeStats.Fs.CapacityBytes = uint64Ptr(capacity)
+		nodeStats.Fs.AvailableBytes = uint64Ptr(capacity - agent.DiskUsage*megabyte)
+	}
+	return nodeStats
+}
+
+// microservicesToPodStats converts the usage of the microservices of a pod, in percent of CPU and bytes of memory.
+func microservicesToPodStats(pod *v1.Pod, microservices []client.MicroserviceInfo, now metav1.Time) stats.PodStats {
+	podStats := stats.PodStats{
+		PodRef: stats.PodReference{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			UID:       string(pod.UID),
+		},
+		Containers: make([]stats.ContainerStats, 0, len(microservices)),
+	}
+	if pod.Status.StartTime != nil {
+		podStats.StartTime = *pod.Status.StartTime
+	}
+
+	var cpuUsage, memoryUsage float64
+	for _, microservice := range microservices {
+		if microservice.Status.Status != microserviceRunning {
+			continue
+		}
+		cpuUsage += microservice.Status.CpuUsage
+		memoryUsage += microservice.Status.MemoryUsage
+
+		podStats.Containers = append(podStats.Containers, stats.ContainerStats{
+			Name:      microservice.Name,
+			StartTime: metav1.NewTime(time.Unix(0, microservice.Status.StartTimne*int64(time.Millisecond))),
+			CPU:       cpuStats(microservice.Status.CpuUsage, now),
+			Memory: &stats.MemoryStats{
+				Time:            now,
+				UsageBytes:      uint64Ptr(microservice.Status.MemoryUsage),
+				WorkingSetBytes: uint64Ptr(microservice.Status.MemoryUsage),
+			},
+		})
+	}
+
+	podStats.CPU = cpuStats(cpuUsage, now)
+	podStats.Memory = &stats.MemoryStats{
+		Time:            now,
+		UsageBytes:      uint64Ptr(memoryUsage),
+		WorkingSetBytes: uint64Ptr(memoryUsage),
+	}
+	return podStats
+}
+
+func cpuStats(percent float64, now metav1.Time) *stats.CPUStats {
+	return &stats.CPUStats{
+		Time:           now,
+		UsageNanoCores: uint64Ptr(percent * nanoCoresPerPercent),
+	}
+}
+
+// uint64Ptr returns a pointer to the value rounded down, negative values are reported as zero.
+func uint64Ptr(value float64) *uint64 {
+	if value < 0 {
+		value = 0
+	}
+	v := uint64(value)
+	return &v
+}
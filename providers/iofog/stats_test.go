@@ -0,0 +1,90 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	stats "k8s.io/kubernetes/pkg/kubelet/apis/stats/v1alpha1"
+)
+
+func TestStatsSummary(t *testing.T) {
+	now := metav1.Now()
+	agent := &client.AgentInfo{
+		CPUUsage:    50,
+		MemoryUsage: 256,
+		MemoryLimit: 1024,
+		DiskUsage:   512,
+		DiskLimit:   2,
+		UptimeMs:    60000,
+	}
+
+	node := agentToNodeStats("node", agent, now)
+	if node.NodeName != "node" || !node.StartTime.Time.Equal(now.Add(-time.Minute)) {
+		t.Fatalf("unexpected node stats: %+v", node)
+	}
+	if *node.CPU.UsageNanoCores != 500000000 {
+		t.Fatalf("unexpected CPU usage: %d", *node.CPU.UsageNanoCores)
+	}
+	if *node.Memory.UsageBytes != 256*megabyte || *node.Memory.AvailableBytes != 768*megabyte {
+		t.Fatalf("unexpected memory usage: %d, available %d", *node.Memory.UsageBytes, *node.Memory.AvailableBytes)
+	}
+	if *node.Fs.CapacityBytes != 2*gigabyte || *node.Fs.AvailableBytes != 2*gigabyte-512*megabyte {
+		t.Fatalf("unexpected fs capacity: %d, available %d", *node.Fs.CapacityBytes, *node.Fs.AvailableBytes)
+	}
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", UID: "uid"}}
+	microservices := []client.MicroserviceInfo{
+		{Name: "a", Status: client.MicroserviceStatus{Status: "RUNNING", CpuUsage: 10, MemoryUsage: 1000}},
+		{Name: "b", Status: client.MicroserviceStatus{Status: "RUNNING", CpuUsage: 5, MemoryUsage: 500}},
+		{Name: "c", Status: client.MicroserviceStatus{Status: "PULLING"}},
+	}
+	podStats := microservicesToPodStats(pod, microservices, now)
+	if podStats.PodRef.UID != "uid" || len(podStats.Containers) != 2 {
+		t.Fatalf("unexpected pod stats: %+v", podStats)
+	}
+	if *podStats.CPU.UsageNanoCores != 150000000 || *podStats.Memory.UsageBytes != 1500 {
+		t.Fatalf("unexpected pod usage: CPU %d, memory %d", *podStats.CPU.UsageNanoCores, *podStats.Memory.UsageBytes)
+	}
+}
+
+func TestStatsCache(t *testing.T) {
+	refreshes := 0
+	cache := newStatsCache(time.Hour, func(ctx context.Context) (*stats.Summary, error) {
+		refreshes++
+		return &stats.Summary{}, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.get(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if refreshes != 1 {
+		t.Fatalf("expected a single refresh, got %d", refreshes)
+	}
+
+	cache.updated = time.Now().Add(-2 * time.Hour)
+	if _, err := cache.get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if refreshes != 2 {
+		t.Fatalf("expected the expired summary to be refreshed, got %d refreshes", refreshes)
+	}
+}
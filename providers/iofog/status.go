@@ -0,0 +1,297 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"strings"
+	"time"
+
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// States of the microservices reported by the ioFog agents.
+const (
+	microserviceQueued     = "QUEUED"
+	microservicePulling    = "PULLING"
+	microserviceStarting   = "STARTING"
+	microserviceRunning    = "RUNNING"
+	microserviceRestarting = "RESTARTING"
+	microserviceStopping   = "STOPPING"
+	microserviceExiting    = "EXITING"
+	microserviceDeleting   = "DELETING"
+	microserviceStopped    = "STOPPED"
+	microserviceDeleted    = "DELETED"
+	microserviceFailed     = "FAILED"
+
+	// containerIDPrefix is the runtime the ioFog agents run the microservices with.
+	containerIDPrefix = "docker://"
+)
+
+// ContainerHistory is what is remembered about the container of a microservice to count its restarts.
+type ContainerHistory struct {
+	ContainerID  string `json:"containerId,omitempty"`
+	StartedAt    int64  `json:"startedAt,omitempty"`
+	RestartCount int32  `json:"restartCount,omitempty"`
+	// LastTermination is the state of the container before its last restart.
+	LastTermination *v1.ContainerStateTerminated `json:"lastTermination,omitempty"`
+}
+
+// observe records the current container of a microservice, counting a restart when the container
+// or its start time changed. It reports whether the history changed.
+func (h *ContainerHistory) observe(status *client.MicroserviceStatus) bool {
+	id := status.ContainerId
+	startedAt := status.StartTimne
+	if id == "" && startedAt == 0 {
+		return false
+	}
+	if id == h.ContainerID && startedAt == h.StartedAt {
+		return false
+	}
+
+	restarted := (h.ContainerID != "" && id != "" && id != h.ContainerID) ||
+		(h.StartedAt != 0 && startedAt > h.StartedAt)
+	if restarted {
+		h.RestartCount++
+		h.LastTermination = &v1.ContainerStateTerminated{
+			Reason:      "Restarted",
+			StartedAt:   msToTime(h.StartedAt),
+			FinishedAt:  msToTime(startedAt),
+			ContainerID: containerID(h.ContainerID),
+		}
+	}
+	if id != "" {
+		h.ContainerID = id
+	}
+	if startedAt != 0 {
+		h.StartedAt = startedAt
+	}
+	return true
+}
+
+// microserviceContainerState maps the state of a microservice to the state of its container.
+// The agents do not report exit codes: stopped microservices exited with 0 and failed ones with 1.
+func microserviceContainerState(status *client.MicroserviceStatus) (v1.ContainerState, bool) {
+	startedAt := msToTime(status.StartTimne)
+	id := containerID(status.ContainerId)
+
+	switch status.Status {
+	case microserviceRunning:
+		return v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: startedAt}}, true
+	case microserviceStopping, microserviceExiting, microserviceDeleting:
+		// The container runs until it is stopped, it no longer serves.
+		return v1.ContainerState{Running: &v1.ContainerStateRunning{StartedAt: startedAt}}, false
+	case microserviceQueued, microservicePulling, microserviceStarting:
+		return v1.ContainerState{Waiting: &v1.ContainerStateWaiting{
+			Reason:  "ContainerCreating",
+			Message: "Microservice is " + status.Status,
+		}}, false
+	case microserviceRestarting:
+		return v1.ContainerState{Waiting: &v1.ContainerStateWaiting{
+			Reason:  "CrashLoopBackOff",
+			Message: "Microservice is restarting",
+		}}, false
+	case microserviceStopped, microserviceDeleted:
+		return v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+			ExitCode:    0,
+			Reason:      "Completed",
+			StartedAt:   startedAt,
+			ContainerID: id,
+		}}, false
+	case microserviceFailed:
+		return v1.ContainerState{Terminated: &v1.ContainerStateTerminated{
+			ExitCode:    1,
+			Reason:      "Error",
+			Message:     "Microservice failed",
+			StartedAt:   startedAt,
+			ContainerID: id,
+		}}, false
+	}
+
+	reason := status.Status
+	if reason == "" {
+		reason = "Unknown"
+	}
+	return v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: reason}}, false
+}
+
+// microserviceTerminated reports whether the container of a microservice no longer runs.
+// Queued microservices and microservices without status are not, the agent may not have reacted to a stop yet.
+func microserviceTerminated(status string) bool {
+	switch status {
+	case microserviceStopped, microserviceDeleted, microserviceFailed:
+		return true
+	}
+	return false
+}
+
+// microservicesToContainerStatuses builds the status of the containers of a pod from its microservices,
+// recording their containers in the history. It reports whether the history changed.
+func microservicesToContainerStatuses(pod *v1.Pod, containerNames map[string]string, microservices []client.MicroserviceInfo, history map[string]*ContainerHistory) ([]v1.ContainerStatus, bool) {
+	changed := false
+	statuses := make([]v1.ContainerStatus, 0, len(microservices))
+	for idx := range microservices {
+		microservice := &microservices[idx]
+		name := microservice.Name
+		if containerName, ok := containerNames[microservice.UUID]; ok {
+			name = containerName
+		}
+
+		containerHistory, ok := history[name]
+		if !ok {
+			containerHistory = &ContainerHistory{}
+			history[name] = containerHistory
+		}
+		if containerHistory.observe(&microservice.Status) {
+			changed = true
+		}
+
+		state, ready := microserviceContainerState(&microservice.Status)
+		status := v1.ContainerStatus{
+			Name:         name,
+			State:        state,
+			Ready:        ready,
+			RestartCount: containerHistory.RestartCount,
+			Image:        microserviceImage(pod, name, microservice),
+			ContainerID:  containerID(microservice.Status.ContainerId),
+		}
+		if containerHistory.LastTermination != nil {
+			status.LastTerminationState = v1.ContainerState{Terminated: containerHistory.LastTermination.DeepCopy()}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, changed
+}
+
+// podPhase derives the phase of a pod from the state of its containers, as the kubelet does.
+func podPhase(pod *v1.Pod, statuses []v1.ContainerStatus) v1.PodPhase {
+	if len(statuses) == 0 {
+		return v1.PodPending
+	}
+
+	restartPolicy := v1.RestartPolicyAlways
+	if pod != nil && pod.Spec.RestartPolicy != "" {
+		restartPolicy = pod.Spec.RestartPolicy
+	}
+
+	running, waiting, succeeded, failed := 0, 0, 0, 0
+	for _, status := range statuses {
+		switch {
+		case status.State.Running != nil:
+			running++
+		case status.State.Terminated != nil && status.State.Terminated.ExitCode == 0:
+			succeeded++
+		case status.State.Terminated != nil:
+			failed++
+		case status.RestartCount > 0:
+			// Waiting to be restarted, the container already ran.
+			running++
+		default:
+			waiting++
+		}
+	}
+
+	switch {
+	case waiting > 0:
+		return v1.PodPending
+	case running > 0:
+		return v1.PodRunning
+	case restartPolicy == v1.RestartPolicyAlways:
+		// The agent restarts the stopped containers.
+		return v1.PodRunning
+	case failed > 0 && restartPolicy == v1.RestartPolicyNever:
+		return v1.PodFailed
+	case failed > 0:
+		return v1.PodRunning
+	}
+	return v1.PodSucceeded
+}
+
+// podConditions returns the standard conditions of a pod: it is ready once all its containers are.
+// Every condition transitions at now, the kubelet keeps the previous transition times of the conditions which did not change.
+func podConditions(statuses []v1.ContainerStatus, now metav1.Time) []v1.PodCondition {
+	ready := v1.ConditionTrue
+	reason, message := "", ""
+	notReady := make([]string, 0)
+	for _, status := range statuses {
+		if !status.Ready {
+			notReady = append(notReady, status.Name)
+		}
+	}
+	switch {
+	case len(statuses) == 0:
+		ready, reason, message = v1.ConditionFalse, "ContainersNotReady", "no microservice deployed"
+	case len(notReady) > 0:
+		ready, reason, message = v1.ConditionFalse, "ContainersNotReady", "containers with unready status: ["+strings.Join(notReady, " ")+"]"
+	}
+
+	return []v1.PodCondition{
+		{Type: v1.PodInitialized, Status: v1.ConditionTrue, LastTransitionTime: now},
+		{Type: v1.PodReady, Status: ready, LastTransitionTime: now, Reason: reason, Message: message},
+		{Type: v1.ContainersReady, Status: ready, LastTransitionTime: now, Reason: reason, Message: message},
+		{Type: v1.PodScheduled, Status: v1.ConditionTrue, LastTransitionTime: now},
+	}
+}
+
+// podStartTime is the earliest start time of the containers, nil while none started.
+func podStartTime(statuses []v1.ContainerStatus) *metav1.Time {
+	var started *metav1.Time
+	for _, status := range statuses {
+		var startedAt metav1.Time
+		switch {
+		case status.State.Running != nil:
+			startedAt = status.State.Running.StartedAt
+		case status.State.Terminated != nil:
+			startedAt = status.State.Terminated.StartedAt
+		}
+		if startedAt.IsZero() {
+			continue
+		}
+		if started == nil || startedAt.Before(started) {
+			startedAt := startedAt
+			started = &startedAt
+		}
+	}
+	return started
+}
+
+// microserviceImage is the image of the container in the pod, or the first image of the microservice.
+func microserviceImage(pod *v1.Pod, name string, microservice *client.MicroserviceInfo) string {
+	if pod != nil {
+		for _, container := range pod.Spec.Containers {
+			if container.Name == name {
+				return container.Image
+			}
+		}
+	}
+	if len(microservice.Images) > 0 {
+		return microservice.Images[0].ContainerImage
+	}
+	return ""
+}
+
+func containerID(id string) string {
+	if id == "" {
+		return ""
+	}
+	return containerIDPrefix + id
+}
+
+func msToTime(ms int64) metav1.Time {
+	if ms <= 0 {
+		return metav1.Time{}
+	}
+	return metav1.NewTime(time.Unix(0, ms*int64(time.Millisecond)))
+}
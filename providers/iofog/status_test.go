@@ -0,0 +1,115 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"testing"
+
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMicroservicesToContainerStatuses(t *testing.T) {
+	pod := &v1.Pod{Spec: v1.PodSpec{
+		Containers: []v1.Container{{Name: "sensor", Image: "iofog/sensor:1"}, {Name: "relay", Image: "iofog/relay:1"}},
+	}}
+	containerNames := map[string]string{"uuid-sensor": "sensor", "uuid-relay": "relay"}
+	history := make(map[string]*ContainerHistory)
+
+	microservices := []client.MicroserviceInfo{
+		{UUID: "uuid-sensor", Name: "sensor-ms", Status: client.MicroserviceStatus{Status: "RUNNING", StartTimne: 1000, ContainerId: "abc"}},
+		{UUID: "uuid-relay", Name: "relay-ms", Status: client.MicroserviceStatus{Status: "PULLING"}},
+	}
+	statuses, changed := microservicesToContainerStatuses(pod, containerNames, microservices, history)
+	if !changed {
+		t.Error("expected the history to record the running container")
+	}
+	sensor, relay := statuses[0], statuses[1]
+	if sensor.Name != "sensor" || !sensor.Ready || sensor.State.Running == nil || sensor.ContainerID != "docker://abc" || sensor.Image != "iofog/sensor:1" {
+		t.Errorf("unexpected sensor status %+v", sensor)
+	}
+	if sensor.State.Running.StartedAt.Unix() != 1 {
+		t.Errorf("expected the sensor to start at 1s, got %v", sensor.State.Running.StartedAt)
+	}
+	if relay.Ready || relay.State.Waiting == nil || relay.State.Waiting.Reason != "ContainerCreating" {
+		t.Errorf("unexpected relay status %+v", relay)
+	}
+	if phase := podPhase(pod, statuses); phase != v1.PodPending {
+		t.Errorf("expected Pending, got %s", phase)
+	}
+	if start := podStartTime(statuses); start == nil || start.Unix() != 1 {
+		t.Errorf("unexpected pod start time %v", start)
+	}
+
+	// The sensor restarted in a new container, the relay failed.
+	microservices[0].Status = client.MicroserviceStatus{Status: "RUNNING", StartTimne: 5000, ContainerId: "def"}
+	microservices[1].Status = client.MicroserviceStatus{Status: "FAILED", StartTimne: 2000}
+	statuses, _ = microservicesToContainerStatuses(pod, containerNames, microservices, history)
+	sensor, relay = statuses[0], statuses[1]
+	if sensor.RestartCount != 1 || sensor.LastTerminationState.Terminated == nil || sensor.LastTerminationState.Terminated.ContainerID != "docker://abc" {
+		t.Errorf("expected a restart of the sensor, got %+v", sensor)
+	}
+	if relay.State.Terminated == nil || relay.State.Terminated.ExitCode != 1 || relay.RestartCount != 0 {
+		t.Errorf("unexpected relay status %+v", relay)
+	}
+	if _, changed := microservicesToContainerStatuses(pod, containerNames, microservices, history); changed {
+		t.Error("expected the history to be unchanged")
+	}
+
+	if phase := podPhase(pod, statuses); phase != v1.PodRunning {
+		t.Errorf("expected Running, got %s", phase)
+	}
+	pod.Spec.RestartPolicy = v1.RestartPolicyNever
+	microservices[0].Status.Status = "STOPPED"
+	statuses, _ = microservicesToContainerStatuses(pod, containerNames, microservices, history)
+	if phase := podPhase(pod, statuses); phase != v1.PodFailed {
+		t.Errorf("expected Failed, got %s", phase)
+	}
+	microservices[1].Status.Status = "STOPPED"
+	statuses, _ = microservicesToContainerStatuses(pod, containerNames, microservices, history)
+	if phase := podPhase(pod, statuses); phase != v1.PodSucceeded {
+		t.Errorf("expected Succeeded, got %s", phase)
+	}
+}
+
+func TestPodConditions(t *testing.T) {
+	statuses := []v1.ContainerStatus{{Name: "sensor", Ready: true}, {Name: "relay"}}
+	conditions := podConditions(statuses, metav1.Now())
+
+	expected := map[v1.PodConditionType]v1.ConditionStatus{
+		v1.PodInitialized:  v1.ConditionTrue,
+		v1.PodReady:        v1.ConditionFalse,
+		v1.ContainersReady: v1.ConditionFalse,
+		v1.PodScheduled:    v1.ConditionTrue,
+	}
+	if len(conditions) != len(expected) {
+		t.Fatalf("expected %d conditions, got %v", len(expected), conditions)
+	}
+	for _, condition := range conditions {
+		if condition.Status != expected[condition.Type] {
+			t.Errorf("expected %s to be %s, got %s", condition.Type, expected[condition.Type], condition.Status)
+		}
+		if condition.Type == v1.PodReady && condition.Message != "containers with unready status: [relay]" {
+			t.Errorf("unexpected message %q", condition.Message)
+		}
+	}
+
+	statuses[1].Ready = true
+	for _, condition := range podConditions(statuses, metav1.Now()) {
+		if condition.Status != v1.ConditionTrue {
+			t.Errorf("expected %s to be True, got %s", condition.Type, condition.Status)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/apps"
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+)
+
+// podUpdate is what changes in the microservices of a pod between two versions of its spec.
+type podUpdate struct {
+	Added   []apps.Microservice
+	Removed []string
+	Updated []microserviceUpdate
+}
+
+// microserviceUpdate is a microservice whose spec changed.
+type microserviceUpdate struct {
+	Microservice apps.Microservice
+	// Changes are the changed parts of the spec, such as image or env.
+	Changes []string
+}
+
+// rebuild reports whether the container of the microservice is rebuilt, which is the case when its image changed.
+func (u *microserviceUpdate) rebuild() bool {
+	for _, change := range u.Changes {
+		if change == "image" {
+			return true
+		}
+	}
+	return false
+}
+
+// planPodUpdate compares the microservices of two versions of a pod by name.
+func planPodUpdate(previous, desired []apps.Microservice) podUpdate {
+	update := podUpdate{}
+	known := make(map[string]*apps.Microservice, len(previous))
+	for idx := range previous {
+		known[previous[idx].Name] = &previous[idx]
+	}
+
+	for _, microservice := range desired {
+		old, ok := known[microservice.Name]
+		if !ok {
+			update.Added = append(update.Added, microservice)
+			continue
+		}
+		delete(known, microservice.Name)
+		if changes := microserviceChanges(old, &microservice); len(changes) > 0 {
+			update.Updated = append(update.Updated, microserviceUpdate{Microservice: microservice, Changes: changes})
+		}
+	}
+
+	for name := range known {
+		update.Removed = append(update.Removed, name)
+	}
+	sort.Strings(update.Removed)
+	return update
+}
+
+// microserviceChanges lists the parts of the spec of a microservice which changed.
+func microserviceChanges(old, desired *apps.Microservice) []string {
+	changes := []string{}
+	if !reflect.DeepEqual(microserviceImages(old), microserviceImages(desired)) {
+		changes = append(changes, "image")
+	}
+	if !reflect.DeepEqual(microserviceEnv(old), microserviceEnv(desired)) {
+		changes = append(changes, "env")
+	}
+	if !equalJSON(old.Config, desired.Config) {
+		changes = append(changes, "config")
+	}
+	if !equalJSON(old.Container.Ports, desired.Container.Ports) {
+		changes = append(changes, "ports")
+	}
+	if !reflect.DeepEqual(microserviceVolumes(old), microserviceVolumes(desired)) {
+		changes = append(changes, "volumes")
+	}
+	if !equalJSON(old.Container.Commands, desired.Container.Commands) {
+		changes = append(changes, "commands")
+	}
+	if old.Container.RootHostAccess != desired.Container.RootHostAccess {
+		changes = append(changes, "rootHostAccess")
+	}
+	return changes
+}
+
+func microserviceImages(microservice *apps.Microservice) apps.MicroserviceImages {
+	if microservice.Images == nil {
+		return apps.MicroserviceImages{}
+	}
+	return *microservice.Images
+}
+
+func microserviceEnv(microservice *apps.Microservice) []apps.MicroserviceEnvironment {
+	if microservice.Container.Env == nil || len(*microservice.Container.Env) == 0 {
+		return nil
+	}
+	return *microservice.Container.Env
+}
+
+func microserviceVolumes(microservice *apps.Microservice) []apps.MicroserviceVolumeMapping {
+	if microservice.Container.Volumes == nil || len(*microservice.Container.Volumes) == 0 {
+		return nil
+	}
+	return *microservice.Container.Volumes
+}
+
+// equalJSON compares values through their JSON form, empty and missing values being equal.
+func equalJSON(a, b interface{}) bool {
+	aJSON, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bJSON, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return emptyJSON(aJSON) == emptyJSON(bJSON)
+}
+
+func emptyJSON(data []byte) string {
+	switch value := string(data); value {
+	case "null", "{}", "[]":
+		return ""
+	default:
+		return value
+	}
+}
+
+// routeDestinations maps the origin of every route to the sorted names of its destinations.
+func routeDestinations(routes []apps.Route) map[string][]string {
+	destinations := make(map[string][]string)
+	for _, route := range routes {
+		destinations[route.From] = append(destinations[route.From], route.To)
+	}
+	for from := range destinations {
+		sort.Strings(destinations[from])
+	}
+	return destinations
+}
+
+// updatePod applies the changes of the spec of a deployed pod microservice by microservice: changed images rebuild
+// their microservice, other changes update it in place, and only added or removed microservices are created or deleted.
+func (p *BrokerProvider) updatePod(ctx context.Context, flowPod *FlowPod, pod *v1.Pod) error {
+	previous, err := podToMicroservices(flowPod.Pod)
+	if err != nil {
+		return err
+	}
+	desired, err := podToMicroservices(pod)
+	if err != nil {
+		return err
+	}
+	if len(desired) == 0 {
+		return fmt.Errorf("pod %s does not define any container or microservice", pod.Name)
+	}
+	routes, err := podToRoutes(pod)
+	if err != nil {
+		return err
+	}
+	update := planPodUpdate(previous, desired)
+	if err := p.resolveCatalogImages(pod, update.Added); err != nil {
+		return err
+	}
+	updated := make([]apps.Microservice, len(update.Updated))
+	for idx := range update.Updated {
+		updated[idx] = update.Updated[idx].Microservice
+	}
+	if err := p.resolveCatalogImages(pod, updated); err != nil {
+		return err
+	}
+	for idx := range updated {
+		update.Updated[idx].Microservice = updated[idx]
+	}
+
+	deployed, err := p.flowMicroservices(flowPod.FlowInfo.ID)
+	if err != nil {
+		return err
+	}
+	adoptDeployedMicroservices(&update, deployed)
+
+	for _, name := range update.Removed {
+		microservice, ok := deployed[name]
+		if !ok {
+			continue
+		}
+		if err := p.client.DeleteMicroservice(microservice.UUID); err != nil {
+			return errors.Wrapf(err, "error deleting microservice %s", name)
+		}
+		delete(deployed, name)
+		p.recordEvent(ctx, pod, v1.EventTypeNormal, "MicroserviceDeleted", "Deleted microservice %s", name)
+	}
+
+	for _, change := range update.Updated {
+		name := change.Microservice.Name
+		microservice, ok := deployed[name]
+		if !ok {
+			// The microservice is missing from the flow, it is created again.
+			update.Added = append(update.Added, change.Microservice)
+			continue
+		}
+		request, err := microserviceUpdateRequest(microservice, &change)
+		if err != nil {
+			return err
+		}
+		updated, err := p.client.UpdateMicroservice(request)
+		if err != nil {
+			return errors.Wrapf(err, "error updating microservice %s", name)
+		}
+		deployed[name] = updated
+		if change.rebuild() {
+			p.recordEvent(ctx, pod, v1.EventTypeNormal, "MicroserviceRebuilt", "Rebuilt microservice %s, changed %s", name, strings.Join(change.Changes, ", "))
+		} else {
+			p.recordEvent(ctx, pod, v1.EventTypeNormal, "MicroserviceUpdated", "Updated microservice %s, changed %s", name, strings.Join(change.Changes, ", "))
+		}
+	}
+
+	if len(update.Added) > 0 {
+		snapshot, err := p.agent()
+		if err != nil {
+			return err
+		}
+		for _, microservice := range update.Added {
+			microservice.Agent = apps.MicroserviceAgent{Name: snapshot.Agent.Name}
+			microservice.Flow = &pod.Name
+			// Routes are set once every microservice exists.
+			microservice.Routes = nil
+			if err := apps.DeployMicroservice(p.controller, microservice); err != nil {
+				return errors.Wrapf(err, "error creating microservice %s", microservice.Name)
+			}
+			p.recordEvent(ctx, pod, v1.EventTypeNormal, "MicroserviceCreated", "Created microservice %s", microservice.Name)
+		}
+		if deployed, err = p.flowMicroservices(flowPod.FlowInfo.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := p.updateRoutes(ctx, pod, routes, deployed); err != nil {
+		return err
+	}
+
+	return p.storeFlowInfo(flowPod.FlowInfo, pod)
+}
+
+// adoptDeployedMicroservices turns the added microservices which already exist in the flow, such as those created by
+// an earlier update which failed before the pod was stored, into updates so that they are not created twice.
+func adoptDeployedMicroservices(update *podUpdate, deployed map[string]*client.MicroserviceInfo) {
+	added := make([]apps.Microservice, 0, len(update.Added))
+	for _, microservice := range update.Added {
+		existing, ok := deployed[microservice.Name]
+		if !ok {
+			added = append(added, microservice)
+			continue
+		}
+		changes := []string{"spec"}
+		if deployedImagesChanged(existing, &microservice) {
+			changes = []string{"image", "spec"}
+		}
+		update.Updated = append(update.Updated, microserviceUpdate{Microservice: microservice, Changes: changes})
+	}
+	update.Added = added
+}
+
+// deployedImagesChanged reports whether the images of a deployed microservice differ from those of its spec.
+func deployedImagesChanged(deployed *client.MicroserviceInfo, microservice *apps.Microservice) bool {
+	images := microserviceImages(microservice)
+	if images.CatalogID != 0 {
+		return deployed.CatalogItemID != images.CatalogID
+	}
+	for _, image := range deployed.Images {
+		switch image.AgentTypeID {
+		case client.AgentTypeAgentTypeIDDict["x86"]:
+			if image.ContainerImage != images.X86 {
+				return true
+			}
+		case client.AgentTypeAgentTypeIDDict["arm"]:
+			if image.ContainerImage != images.ARM {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// updateRoutes sets the routes of the microservices of a pod, only changing the microservices whose routes differ.
+func (p *BrokerProvider) updateRoutes(ctx context.Context, pod *v1.Pod, routes []apps.Route, deployed map[string]*client.MicroserviceInfo) error {
+	destinations := routeDestinations(routes)
+	for from := range destinations {
+		if _, ok := deployed[from]; !ok {
+			return fmt.Errorf("could not find origin microservice %s of the routes of pod %s", from, pod.Name)
+		}
+	}
+
+	names := make([]string, 0, len(deployed))
+	for name := range deployed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		microservice := deployed[name]
+		desired := make([]string, 0, len(destinations[name]))
+		for _, to := range destinations[name] {
+			destination, ok := deployed[to]
+			if !ok {
+				return fmt.Errorf("could not find destination microservice %s of the route from %s", to, name)
+			}
+			desired = append(desired, destination.UUID)
+		}
+
+		current := append([]string{}, microservice.Routes...)
+		sort.Strings(current)
+		sort.Strings(desired)
+		if equalJSON(current, desired) {
+			continue
+		}
+		if err := p.client.UpdateMicroserviceRoutes(microservice.UUID, microservice.Routes, desired); err != nil {
+			return errors.Wrapf(err, "error updating the routes of microservice %s", name)
+		}
+		p.recordEvent(ctx, pod, v1.EventTypeNormal, "RoutesUpdated", "Updated the routes of microservice %s to %s", name, strings.Join(destinations[name], ", "))
+	}
+	return nil
+}
+
+// flowMicroservices returns the microservices of a flow by name.
+func (p *BrokerProvider) flowMicroservices(flowID int) (map[string]*client.MicroserviceInfo, error) {
+	list, err := p.client.GetMicroservicesPerFlow(flowID)
+	if err != nil {
+		return nil, err
+	}
+	microservices := make(map[string]*client.MicroserviceInfo, len(list.Microservices))
+	for idx := range list.Microservices {
+		microservices[list.Microservices[idx].Name] = &list.Microservices[idx]
+	}
+	return microservices, nil
+}
+
+// microserviceUpdateRequest builds the update of a deployed microservice to its new spec. The current routes are kept,
+// they are updated separately.
+func microserviceUpdateRequest(deployed *client.MicroserviceInfo, update *microserviceUpdate) (client.MicroserviceUpdateRequest, error) {
+	microservice := &update.Microservice
+
+	config := ""
+	if microservice.Config != nil {
+		data, err := json.Marshal(microservice.Config)
+		if err != nil {
+			return client.MicroserviceUpdateRequest{}, errors.Wrapf(err, "invalid config of microservice %s", microservice.Name)
+		}
+		config = string(data)
+	}
+
+	env := make([]client.MicroserviceEnvironment, 0)
+	for _, variable := range microserviceEnv(microservice) {
+		env = append(env, client.MicroserviceEnvironment(variable))
+	}
+	volumes := make([]client.MicroserviceVolumeMapping, 0)
+	for _, volume := range microserviceVolumes(microservice) {
+		volumes = append(volumes, client.MicroserviceVolumeMapping(volume))
+	}
+	ports := make([]client.MicroservicePortMapping, 0, len(microservice.Container.Ports))
+	for _, port := range microservice.Container.Ports {
+		ports = append(ports, client.MicroservicePortMapping(port))
+	}
+	commands := microservice.Container.Commands
+	if commands == nil {
+		commands = []string{}
+	}
+
+	request := client.MicroserviceUpdateRequest{
+		UUID:           deployed.UUID,
+		Config:         &config,
+		RootHostAccess: &microservice.Container.RootHostAccess,
+		Env:            &env,
+		Volumes:        &volumes,
+		Commands:       &commands,
+		Ports:          ports,
+		Routes:         deployed.Routes,
+		Rebuild:        update.rebuild(),
+	}
+
+	// Microservices of catalog items take their images from the catalog.
+	images := microserviceImages(microservice)
+	if images.CatalogID != 0 && update.rebuild() {
+		request.CatalogItemID = images.CatalogID
+	}
+	if images.CatalogID == 0 && update.rebuild() {
+		request.Images = []client.CatalogImage{
+			{ContainerImage: images.X86, AgentTypeID: client.AgentTypeAgentTypeIDDict["x86"]},
+			{ContainerImage: images.ARM, AgentTypeID: client.AgentTypeAgentTypeIDDict["arm"]},
+		}
+		if images.Registry != "" {
+			registryID, err := strconv.Atoi(images.Registry)
+			if err != nil {
+				registryID = client.RegistryTypeRegistryTypeIDDict[images.Registry]
+			}
+			request.RegistryID = &registryID
+		}
+	}
+	return request, nil
+}
+
+// recordEvent reports a step taken on a pod, when the context carries an event recorder.
+func (p *BrokerProvider) recordEvent(ctx context.Context, pod *v1.Pod, eventType, reason, messageFmt string, args ...interface{}) {
+	log.G(ctx).WithField("reason", reason).Infof(messageFmt, args...)
+	if recorder := providers.GetEventRecorder(ctx); recorder != nil {
+		recorder.Eventf(pod, eventType, reason, messageFmt, args...)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/apps"
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPlanPodUpdate(t *testing.T) {
+	previous := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "sensor"},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{Name: "reader", Image: "reader:1.0", Env: []v1.EnvVar{{Name: "LEVEL", Value: "info"}}},
+				{Name: "writer", Image: "writer:1.0"},
+				{Name: "viewer", Image: "viewer:1.0"},
+				{Name: "legacy", Image: "legacy:1.0"},
+			},
+		},
+	}
+	desired := previous.DeepCopy()
+	desired.Spec.Containers = []v1.Container{
+		{Name: "reader", Image: "reader:2.0", Env: []v1.EnvVar{{Name: "LEVEL", Value: "debug"}}},
+		{Name: "writer", Image: "writer:1.0", Ports: []v1.ContainerPort{{ContainerPort: 80, HostPort: 8080}}},
+		{Name: "viewer", Image: "viewer:1.0"},
+		{Name: "exporter", Image: "exporter:1.0"},
+	}
+
+	old, err := podToMicroservices(previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	microservices, err := podToMicroservices(desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := planPodUpdate(old, microservices)
+
+	if len(update.Added) != 1 || update.Added[0].Name != "exporter" {
+		t.Errorf("expected exporter to be added, got %v", update.Added)
+	}
+	if !reflect.DeepEqual(update.Removed, []string{"legacy"}) {
+		t.Errorf("expected legacy to be removed, got %v", update.Removed)
+	}
+	if len(update.Updated) != 2 {
+		t.Fatalf("expected reader and writer to be updated, got %v", update.Updated)
+	}
+	reader, writer := update.Updated[0], update.Updated[1]
+	if !reflect.DeepEqual(reader.Changes, []string{"image", "env"}) || !reader.rebuild() {
+		t.Errorf("expected reader to be rebuilt, got %v", reader.Changes)
+	}
+	if !reflect.DeepEqual(writer.Changes, []string{"ports"}) || writer.rebuild() {
+		t.Errorf("expected writer to be updated in place, got %v", writer.Changes)
+	}
+
+	request, err := microserviceUpdateRequest(&client.MicroserviceInfo{UUID: "writer-uuid", Routes: []string{"viewer-uuid"}}, &writer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.UUID != "writer-uuid" || request.Rebuild || request.Images != nil {
+		t.Errorf("unexpected request %+v", request)
+	}
+	if !reflect.DeepEqual(request.Routes, []string{"viewer-uuid"}) {
+		t.Errorf("expected the routes to be kept, got %v", request.Routes)
+	}
+	if len(request.Ports) != 1 || request.Ports[0].Internal != 80 || request.Ports[0].External != 8080 {
+		t.Errorf("unexpected ports %v", request.Ports)
+	}
+
+	request, err = microserviceUpdateRequest(&client.MicroserviceInfo{UUID: "reader-uuid"}, &reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !request.Rebuild || len(request.Images) != 2 || request.Images[0].ContainerImage != "reader:2.0" {
+		t.Errorf("expected the image to be rebuilt, got %+v", request)
+	}
+}
+
+func TestRouteDestinations(t *testing.T) {
+	routes, err := podToRoutes(&v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Annotations: map[string]string{routesAnnotation: `[{"from":"reader","to":"writer"},{"from":"reader","to":"viewer"}]`},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{"reader": {"viewer", "writer"}}
+	if destinations := routeDestinations(routes); !reflect.DeepEqual(destinations, expected) {
+		t.Errorf("expected %v, got %v", expected, destinations)
+	}
+}
+
+func TestAdoptDeployedMicroservices(t *testing.T) {
+	update := podUpdate{Added: []apps.Microservice{
+		{Name: "reader", Images: &apps.MicroserviceImages{X86: "reader:2.0", ARM: "reader:2.0-arm"}},
+		{Name: "writer", Images: &apps.MicroserviceImages{X86: "writer:1.0", ARM: "writer:1.0-arm"}},
+		{Name: "exporter", Images: &apps.MicroserviceImages{X86: "exporter:1.0"}},
+	}}
+	deployed := map[string]*client.MicroserviceInfo{
+		"reader": {UUID: "reader-uuid", Images: []client.CatalogImage{
+			{ContainerImage: "reader:1.0", AgentTypeID: client.AgentTypeAgentTypeIDDict["x86"]},
+			{ContainerImage: "reader:1.0-arm", AgentTypeID: client.AgentTypeAgentTypeIDDict["arm"]},
+		}},
+		"writer": {UUID: "writer-uuid", Images: []client.CatalogImage{
+			{ContainerImage: "writer:1.0", AgentTypeID: client.AgentTypeAgentTypeIDDict["x86"]},
+			{ContainerImage: "writer:1.0-arm", AgentTypeID: client.AgentTypeAgentTypeIDDict["arm"]},
+		}},
+	}
+
+	adoptDeployedMicroservices(&update, deployed)
+
+	if len(update.Added) != 1 || update.Added[0].Name != "exporter" {
+		t.Errorf("expected only exporter to be created, got %v", update.Added)
+	}
+	if len(update.Updated) != 2 {
+		t.Fatalf("expected reader and writer to be updated, got %v", update.Updated)
+	}
+	if reader := update.Updated[0]; reader.Microservice.Name != "reader" || !reader.rebuild() {
+		t.Errorf("expected reader to be rebuilt, got %v", reader)
+	}
+	if writer := update.Updated[1]; writer.Microservice.Name != "writer" || writer.rebuild() {
+		t.Errorf("expected writer to be updated in place, got %v", writer)
+	}
+}
@@ -0,0 +1,364 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/apps"
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// CatalogFunc returns the items of the catalog of the ioFog Controller.
+type CatalogFunc func() ([]client.CatalogItemInfo, error)
+
+// architectureImages maps the architectures of the nodes to the fog types of their images.
+var architectureImages = map[string]string{
+	"amd64": "x86",
+	"arm":   "arm",
+	"arm64": "arm",
+}
+
+// HasIofogAnnotations returns whether a pod declares microservices, routes or catalog items through its annotations.
+func HasIofogAnnotations(pod *v1.Pod) bool {
+	for _, annotation := range []string{microservicesAnnotation, routesAnnotation, catalogAnnotation} {
+		if _, ok := pod.Annotations[annotation]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MicroservicesChanged returns whether an update of a pod changes the microservices it is deployed as, that is its
+// containers or its ioFog annotations.
+func MicroservicesChanged(old, pod *v1.Pod) bool {
+	for _, annotation := range []string{microservicesAnnotation, routesAnnotation, catalogAnnotation} {
+		oldValue, oldOk := old.Annotations[annotation]
+		value, ok := pod.Annotations[annotation]
+		if oldOk != ok || oldValue != value {
+			return true
+		}
+	}
+	return !reflect.DeepEqual(old.Spec.Containers, pod.Spec.Containers)
+}
+
+// ValidatePod validates the microservices and routes a pod is deployed as, before it is scheduled.
+// The annotations must match the apps.Microservice and apps.Route schemas, the routes must join microservices
+// of the pod, and every microservice needs an image for the architecture selected by the pod node selector.
+// The catalog items referenced by the pod must exist. The catalog is only listed when a microservice references an item.
+func ValidatePod(ctx context.Context, pod *v1.Pod, catalog CatalogFunc) field.ErrorList {
+	allErrs := field.ErrorList{}
+	annotationsPath := field.NewPath("metadata", "annotations")
+
+	architecture, archPath := podArchitecture(pod)
+	validator := &imageValidator{ctx: ctx, catalog: catalog, architecture: architecture, architecturePath: archPath}
+
+	catalogPath := annotationsPath.Key(catalogAnnotation)
+	catalogItems := map[string]string{}
+	if err := decodeAnnotation(pod, catalogAnnotation, &catalogItems); err != nil {
+		allErrs = append(allErrs, field.Invalid(catalogPath, pod.Annotations[catalogAnnotation], err.Error()))
+		catalogItems = nil
+	}
+
+	containersPath := field.NewPath("spec", "containers")
+	for idx := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[idx]
+		for portIdx, port := range container.Ports {
+			if port.Protocol != "" && port.Protocol != v1.ProtocolTCP {
+				allErrs = append(allErrs, field.NotSupported(containersPath.Index(idx).Child("ports").Index(portIdx).Child("protocol"),
+					port.Protocol, []string{string(v1.ProtocolTCP)}))
+			}
+		}
+	}
+
+	microservicesPath := annotationsPath.Key(microservicesAnnotation)
+	overrides := []apps.Microservice{}
+	if err := decodeAnnotation(pod, microservicesAnnotation, &overrides); err != nil {
+		allErrs = append(allErrs, field.Invalid(microservicesPath, pod.Annotations[microservicesAnnotation], err.Error()))
+		overrides = nil
+	}
+	routesPath := annotationsPath.Key(routesAnnotation)
+	routes := []apps.Route{}
+	if err := decodeAnnotation(pod, routesAnnotation, &routes); err != nil {
+		allErrs = append(allErrs, field.Invalid(routesPath, pod.Annotations[routesAnnotation], err.Error()))
+		routes = nil
+	}
+
+	names := make(map[string]bool, len(pod.Spec.Containers)+len(overrides))
+	for _, container := range pod.Spec.Containers {
+		names[container.Name] = true
+	}
+	overridden := make(map[string]bool, len(overrides))
+	for idx, override := range overrides {
+		namePath := microservicesPath.Index(idx).Child("name")
+		switch {
+		case override.Name == "":
+			allErrs = append(allErrs, field.Required(namePath, "the name of the microservice, or of the container it replaces"))
+		case overridden[override.Name]:
+			allErrs = append(allErrs, field.Duplicate(namePath, override.Name))
+		}
+		overridden[override.Name] = true
+		names[override.Name] = true
+	}
+	if len(names) == 0 {
+		allErrs = append(allErrs, field.Required(containersPath, "the pod does not define any container or microservice"))
+	}
+
+	for idx, container := range pod.Spec.Containers {
+		if overridden[container.Name] || catalogItems[container.Name] != "" {
+			continue
+		}
+		if name, ok := catalogImageName(container.Image); ok {
+			allErrs = append(allErrs, validator.validateCatalogItem(name, containersPath.Index(idx).Child("image"))...)
+		}
+	}
+
+	for idx := range overrides {
+		path := microservicesPath.Index(idx)
+		if catalogItems[overrides[idx].Name] == "" {
+			// The microservices of the catalog annotation take their images from their catalog item.
+			allErrs = append(allErrs, validator.validate(overrides[idx].Images, path.Child("images"))...)
+		}
+		allErrs = append(allErrs, validateMicroservice(&overrides[idx], path, names)...)
+	}
+
+	itemNames := make([]string, 0, len(catalogItems))
+	for name := range catalogItems {
+		itemNames = append(itemNames, name)
+	}
+	sort.Strings(itemNames)
+	for _, name := range itemNames {
+		path := catalogPath.Key(name)
+		switch {
+		case !names[name]:
+			allErrs = append(allErrs, field.NotFound(path, name))
+		case catalogItems[name] == "":
+			allErrs = append(allErrs, field.Required(path, "the name of a catalog item"))
+		default:
+			allErrs = append(allErrs, validator.validateCatalogItem(catalogItems[name], path)...)
+		}
+	}
+
+	for idx, route := range routes {
+		path := routesPath.Index(idx)
+		allErrs = append(allErrs, validateRouteEndpoint(route.From, path.Child("from"), names)...)
+		allErrs = append(allErrs, validateRouteEndpoint(route.To, path.Child("to"), names)...)
+	}
+
+	return allErrs
+}
+
+func validateMicroservice(microservice *apps.Microservice, path *field.Path, names map[string]bool) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for idx, port := range microservice.Container.Ports {
+		portPath := path.Child("container", "ports").Index(idx)
+		if port.Host != "" && port.Public == 0 {
+			allErrs = append(allErrs, field.Required(portPath.Child("publicPort"), "a public port is required by the port host"))
+		}
+		switch strings.ToLower(port.Protocol) {
+		case "", "tcp", "http":
+		default:
+			allErrs = append(allErrs, field.NotSupported(portPath.Child("protocol"), port.Protocol, []string{"tcp", "http"}))
+		}
+	}
+
+	for idx, route := range microservice.Routes {
+		allErrs = append(allErrs, validateRouteEndpoint(route, path.Child("routes").Index(idx), names)...)
+	}
+	return allErrs
+}
+
+func validateRouteEndpoint(name string, path *field.Path, names map[string]bool) field.ErrorList {
+	if name == "" {
+		return field.ErrorList{field.Required(path, "the name of a microservice of the pod")}
+	}
+	if !names[name] {
+		return field.ErrorList{field.NotFound(path, name)}
+	}
+	return nil
+}
+
+// imageValidator checks that microservices have images, for the architecture of their node when it is selected.
+type imageValidator struct {
+	ctx              context.Context
+	catalog          CatalogFunc
+	architecture     string
+	architecturePath *field.Path
+
+	items    []client.CatalogItemInfo
+	itemsErr error
+}
+
+func (v *imageValidator) validate(images *apps.MicroserviceImages, path *field.Path) field.ErrorList {
+	if images == nil {
+		return field.ErrorList{field.Required(path, "the images of the microservice, or a catalog item")}
+	}
+
+	allErrs := field.ErrorList{}
+	if images.Registry != "" {
+		if _, err := strconv.Atoi(images.Registry); err != nil {
+			if _, ok := client.RegistryTypeRegistryTypeIDDict[images.Registry]; !ok {
+				allErrs = append(allErrs, field.NotSupported(path.Child("registry"), images.Registry, registryTypes()))
+			}
+		}
+	}
+
+	for _, image := range []struct {
+		name string
+		path *field.Path
+	}{{images.X86, path.Child("x86")}, {images.ARM, path.Child("arm")}} {
+		if name, ok := catalogImageName(image.name); ok {
+			return append(allErrs, v.validateCatalogItem(name, image.path)...)
+		}
+	}
+
+	fogType := architectureImages[v.architecture]
+	if images.CatalogID > 0 {
+		item, err := v.catalogItem(images.CatalogID)
+		switch {
+		case err != nil:
+			// The catalog could not be listed, the catalog item is not checked rather than rejecting the pod.
+		case item == nil:
+			allErrs = append(allErrs, field.NotFound(path.Child("catalogId"), images.CatalogID))
+		case fogType != "" && !catalogItemHasImage(item, fogType):
+			allErrs = append(allErrs, field.Invalid(path.Child("catalogId"), images.CatalogID,
+				"catalog item "+item.Name+" has no "+fogType+" image, required by "+v.architectureRequirement()))
+		}
+		return allErrs
+	}
+
+	if images.X86 == "" && images.ARM == "" {
+		return append(allErrs, field.Required(path, "an x86 or arm image, or a catalog item"))
+	}
+	switch fogType {
+	case "x86":
+		if images.X86 == "" {
+			allErrs = append(allErrs, field.Required(path.Child("x86"), "required by "+v.architectureRequirement()))
+		}
+	case "arm":
+		if images.ARM == "" {
+			allErrs = append(allErrs, field.Required(path.Child("arm"), "required by "+v.architectureRequirement()))
+		}
+	}
+	return allErrs
+}
+
+// validateCatalogItem checks that a catalog item exists, with an image for the architecture of the node when it is selected.
+func (v *imageValidator) validateCatalogItem(name string, path *field.Path) field.ErrorList {
+	if name == "" {
+		return field.ErrorList{field.Required(path, "the name of a catalog item")}
+	}
+	item, err := v.catalogItemByName(name)
+	fogType := architectureImages[v.architecture]
+	switch {
+	case err != nil:
+		// The catalog could not be listed, the catalog item is not checked rather than rejecting the pod.
+		return nil
+	case item == nil:
+		return field.ErrorList{field.NotFound(path, name)}
+	case fogType != "" && !catalogItemHasImage(item, fogType):
+		return field.ErrorList{field.Invalid(path, name, "catalog item has no "+fogType+" image, required by "+v.architectureRequirement())}
+	}
+	return nil
+}
+
+func (v *imageValidator) architectureRequirement() string {
+	return v.architecturePath.String() + "=" + v.architecture
+}
+
+// catalogItem returns a catalog item by ID, nil when it does not exist.
+func (v *imageValidator) catalogItem(id int) (*client.CatalogItemInfo, error) {
+	items, err := v.catalogItems()
+	if err != nil {
+		return nil, err
+	}
+	for idx := range items {
+		if items[idx].ID == id {
+			return &items[idx], nil
+		}
+	}
+	return nil, nil
+}
+
+// catalogItemByName returns a catalog item by name, nil when it does not exist.
+func (v *imageValidator) catalogItemByName(name string) (*client.CatalogItemInfo, error) {
+	items, err := v.catalogItems()
+	if err != nil {
+		return nil, err
+	}
+	return catalogItemByName(items, name), nil
+}
+
+// catalogItems lists the catalog once per validation.
+func (v *imageValidator) catalogItems() ([]client.CatalogItemInfo, error) {
+	if v.items == nil && v.itemsErr == nil {
+		v.items = []client.CatalogItemInfo{}
+		if v.catalog != nil {
+			v.items, v.itemsErr = v.catalog()
+		}
+		if v.itemsErr != nil {
+			log.G(v.ctx).WithError(v.itemsErr).Warn("Error listing the catalog, the catalog items of the pod are not validated")
+		}
+	}
+	return v.items, v.itemsErr
+}
+
+// catalogItemHasImage returns whether a catalog item has an image for a fog type.
+func catalogItemHasImage(item *client.CatalogItemInfo, fogType string) bool {
+	for _, image := range item.Images {
+		if image.AgentTypeID == client.AgentTypeAgentTypeIDDict[fogType] && image.ContainerImage != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// podArchitecture returns the architecture a pod selects its node by, and the path of the selector.
+func podArchitecture(pod *v1.Pod) (string, *field.Path) {
+	for _, label := range []string{LabelArch, LabelArchBeta} {
+		if architecture, ok := pod.Spec.NodeSelector[label]; ok {
+			return architecture, field.NewPath("spec", "nodeSelector").Key(label)
+		}
+	}
+	return "", nil
+}
+
+func registryTypes() []string {
+	types := make([]string, 0, len(client.RegistryTypeRegistryTypeIDDict))
+	for registryType := range client.RegistryTypeRegistryTypeIDDict {
+		types = append(types, registryType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// decodeAnnotation decodes a JSON annotation, rejecting the fields the target does not define.
+func decodeAnnotation(pod *v1.Pod, annotation string, target interface{}) error {
+	value, ok := pod.Annotations[annotation]
+	if !ok || strings.TrimSpace(value) == "" {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(value)))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(target)
+}
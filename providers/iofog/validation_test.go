@@ -0,0 +1,160 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package iofog
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidatePod(t *testing.T) {
+	catalog := func() ([]client.CatalogItemInfo, error) {
+		return []client.CatalogItemInfo{
+			{ID: 7, Name: "heart-rate", Images: []client.CatalogImage{{ContainerImage: "heart-rate:x86", AgentTypeID: 1}}},
+		}, nil
+	}
+	newPod := func(microservices, routes, catalogItems string, nodeSelector map[string]string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "sensor",
+				Annotations: map[string]string{
+					microservicesAnnotation: microservices,
+					routesAnnotation:        routes,
+					catalogAnnotation:       catalogItems,
+				},
+			},
+			Spec: v1.PodSpec{
+				Containers:   []v1.Container{{Name: "reader", Image: "reader:1.0"}, {Name: "writer", Image: "catalog://heart-rate"}},
+				NodeSelector: nodeSelector,
+			},
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		microservices string
+		routes        string
+		catalogItems  string
+		nodeSelector  map[string]string
+		expected      []string
+	}{
+		{
+			name:          "valid",
+			microservices: `[{"name":"viewer","images":{"x86":"viewer:x86","arm":"viewer:arm"}},{"name":"monitor","images":{"catalogId":7}}]`,
+			routes:        `[{"from":"reader","to":"viewer"},{"from":"monitor","to":"viewer"}]`,
+			nodeSelector:  map[string]string{LabelArch: "amd64"},
+		},
+		{
+			name:          "malformed annotations",
+			microservices: `[{"name":"viewer","image":"viewer:1.0"}]`,
+			routes:        `{"from":"reader"}`,
+			expected:      []string{"metadata.annotations[microservices]", "metadata.annotations[routes]"},
+		},
+		{
+			name:          "unknown route endpoints",
+			microservices: `[{"name":"viewer","images":{"x86":"viewer:x86"},"routes":["printer"]}]`,
+			routes:        `[{"from":"reader","to":"scanner"},{"to":"viewer"}]`,
+			expected: []string{
+				"metadata.annotations[microservices][0].routes[0]",
+				"metadata.annotations[routes][0].to",
+				"metadata.annotations[routes][1].from",
+			},
+		},
+		{
+			name:          "missing images",
+			microservices: `[{"name":"reader"},{"name":"viewer","images":{"x86":"viewer:x86","registry":"private"}},{"name":"monitor","images":{"catalogId":7}},{"name":"printer","images":{"catalogId":8}}]`,
+			nodeSelector:  map[string]string{LabelArchBeta: "arm"},
+			expected: []string{
+				"spec.containers[1].image",
+				"metadata.annotations[microservices][0].images",
+				"metadata.annotations[microservices][1].images.registry",
+				"metadata.annotations[microservices][1].images.arm",
+				"metadata.annotations[microservices][2].images.catalogId",
+				"metadata.annotations[microservices][3].images.catalogId",
+			},
+		},
+		{
+			name:          "catalog items",
+			microservices: `[{"name":"viewer"},{"name":"printer","images":{"x86":"catalog://printer"}}]`,
+			catalogItems:  `{"viewer":"heart-rate","monitor":"heart-rate","reader":""}`,
+			nodeSelector:  map[string]string{LabelArch: "amd64"},
+			expected: []string{
+				"metadata.annotations[microservices][1].images.x86",
+				"metadata.annotations[catalog][monitor]",
+				"metadata.annotations[catalog][reader]",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			errs := ValidatePod(context.Background(), newPod(tc.microservices, tc.routes, tc.catalogItems, tc.nodeSelector), catalog)
+			if len(errs) != len(tc.expected) {
+				t.Fatalf("expected %d errors, got %v", len(tc.expected), errs)
+			}
+			for idx, err := range errs {
+				if err.Field != tc.expected[idx] {
+					t.Errorf("expected an error on %s, got %v", tc.expected[idx], err)
+				}
+			}
+		})
+	}
+}
+
+func TestValidatePodWithUnavailableCatalog(t *testing.T) {
+	catalog := func() ([]client.CatalogItemInfo, error) {
+		return nil, errors.New("controller unavailable")
+	}
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "sensor",
+			Annotations: map[string]string{microservicesAnnotation: `[{"name":"monitor","images":{"catalogId":7}}]`},
+		},
+		Spec: v1.PodSpec{Containers: []v1.Container{{Name: "writer", Image: "catalog://heart-rate"}}},
+	}
+
+	// The pod is allowed when the catalog cannot be listed.
+	if errs := ValidatePod(context.Background(), pod, catalog); len(errs) != 0 {
+		t.Fatalf("expected no errors, got %v", errs)
+	}
+}
+
+func TestMicroservicesChanged(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "sensor", Annotations: map[string]string{routesAnnotation: `[]`}},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "reader", Image: "reader:1.0"}}},
+	}
+
+	labeled := pod.DeepCopy()
+	labeled.Labels = map[string]string{"app": "sensor"}
+	labeled.Finalizers = []string{"iofog.org/cleanup"}
+	if MicroservicesChanged(pod, labeled) {
+		t.Error("expected the metadata not to change the microservices")
+	}
+	image := pod.DeepCopy()
+	image.Spec.Containers[0].Image = "reader:2.0"
+	if !MicroservicesChanged(pod, image) {
+		t.Error("expected the image to change the microservices")
+	}
+	removed := pod.DeepCopy()
+	delete(removed.Annotations, routesAnnotation)
+	if !MicroservicesChanged(pod, removed) {
+		t.Error("expected the removed routes to change the microservices")
+	}
+}
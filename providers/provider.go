@@ -39,11 +39,13 @@ type Provider interface {
 	GetPod(ctx context.Context, namespace, name string) (*v1.Pod, error)
 
 	// GetContainerLogs retrieves the logs of a container by name from the provider.
-	GetContainerLogs(ctx context.Context, namespace, podName, containerName string, tail int) (string, error)
+	// The returned stream is closed by the caller, it stays open when following the logs.
+	GetContainerLogs(ctx context.Context, namespace, podName, containerName string, opts ContainerLogOpts) (io.ReadCloser, error)
 
 	// ExecInContainer executes a command in a container in the pod, copying data
 	// between in/out/err and the container's stdin/stdout/stderr.
-	ExecInContainer(name string, uid types.UID, container string, cmd []string, in io.Reader, out, err io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize, timeout time.Duration) error
+	// The command is stopped when the context is done.
+	ExecInContainer(ctx context.Context, name string, uid types.UID, container string, cmd []string, in io.Reader, out, err io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize, timeout time.Duration) error
 
 	// GetPodStatus retrieves the status of a pod by name from the provider.
 	GetPodStatus(ctx context.Context, namespace, name string) (*v1.PodStatus, error)
@@ -77,3 +79,35 @@ type Provider interface {
 type PodMetricsProvider interface {
 	GetStatsSummary(context.Context) (*stats.Summary, error)
 }
+
+// PodStatusBatchProvider is an optional interface that providers can implement to compute the status of all their pods at once,
+// pods missing from the result have no status in the provider.
+type PodStatusBatchProvider interface {
+	GetPodStatuses(context.Context) (map[types.NamespacedName]*v1.PodStatus, error)
+}
+
+// PodStopper is an optional interface that providers can implement to terminate pods gracefully: the containers of a
+// pod marked for deletion are stopped with StopPod, and the pod is deleted with DeletePod once PodStopped reports them
+// stopped or its grace period is over.
+type PodStopper interface {
+	StopPod(context.Context, *v1.Pod) error
+	PodStopped(context.Context, *v1.Pod) (bool, error)
+}
+
+// NodeMetadataProvider is an optional interface that providers can implement to describe their node,
+// the metadata is kept in sync on every node update.
+type NodeMetadataProvider interface {
+	NodeMetadata(context.Context) (*NodeMetadata, error)
+}
+
+// NodeMetadata describes the node of a provider.
+type NodeMetadata struct {
+	// Architecture is the architecture of the node, such as amd64 or arm.
+	Architecture string
+	// Labels are set on the node, labels previously set but no longer reported are removed.
+	Labels map[string]string
+	// Annotations are set on the node, annotations previously set but no longer reported are removed.
+	Annotations map[string]string
+	// Taints are set on the node, taints previously set but no longer reported are removed.
+	Taints []v1.Taint
+}
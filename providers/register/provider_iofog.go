@@ -26,9 +26,15 @@ func initWeb(cfg InitConfig) (providers.Provider, error) {
 	return iofog.NewBrokerProvider(
 		cfg.DaemonPort,
 		cfg.NodeName,
+		cfg.InternalIP,
 		cfg.OperatingSystem,
 		cfg.Controller,
 		cfg.ControllerClient,
 		cfg.NodeId,
-		cfg.Store)
+		cfg.Store,
+		cfg.NodePolicy,
+		cfg.Agents,
+		cfg.Catalog,
+		cfg.Logs,
+		cfg.Exec)
 }
@@ -19,6 +19,7 @@ import (
 	"github.com/eclipse-iofog/iofog-go-sdk/v2/pkg/client"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/manager"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers/iofog"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/vkubelet/api"
 	"github.com/pkg/errors"
 )
@@ -37,6 +38,11 @@ type InitConfig struct {
 	ControllerClient *client.Client
 	NodeId           string
 	Store            *api.KeyValueStore
+	NodePolicy       func() *iofog.NodePolicy
+	Agents           *iofog.AgentCache
+	Catalog          *iofog.CatalogCache
+	Logs             iofog.LogSource
+	Exec             iofog.ExecBackend
 }
 
 type initFunc func(InitConfig) (providers.Provider, error)
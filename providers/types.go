@@ -13,6 +13,10 @@
 
 package providers
 
+import (
+	"time"
+)
+
 const (
 	// OperatingSystemLinux is the configuration value for defining Linux.
 	OperatingSystemLinux = "Linux"
@@ -38,3 +42,27 @@ func (o OperatingSystems) Names() []string {
 	}
 	return keys
 }
+
+// ContainerLogOpts are the options of a container log request.
+type ContainerLogOpts struct {
+	// Tail is the number of lines to return from the end of the logs, all lines when zero.
+	Tail int
+	// LimitBytes is the maximum number of bytes to return, unlimited when zero.
+	LimitBytes int64
+	// Timestamps prefixes every line with its RFC3339 timestamp.
+	Timestamps bool
+	// Follow keeps the stream open and sends new lines as they are written.
+	Follow bool
+	// SinceSeconds only returns the lines written in the last seconds, ignored when zero.
+	SinceSeconds int
+	// SinceTime only returns the lines written after this time, ignored when zero.
+	SinceTime time.Time
+}
+
+// Since returns the oldest time of the requested lines, the zero time when unbounded.
+func (opts ContainerLogOpts) Since() time.Time {
+	if opts.SinceSeconds > 0 {
+		return time.Now().Add(-time.Duration(opts.SinceSeconds) * time.Second)
+	}
+	return opts.SinceTime
+}
@@ -0,0 +1,100 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"github.com/pkg/errors"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// PodValidator validates a pod created or updated through the Kubernetes API. old is the previous version of an
+// updated pod, nil when the pod is created.
+type PodValidator func(ctx context.Context, pod, old *v1.Pod) field.ErrorList
+
+var podResource = metav1.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+// PodAdmissionHandlerFunc returns an http.HandlerFunc answering the AdmissionReviews of a validating webhook.
+// Pods are denied with the field errors of the validator, other resources are allowed.
+func PodAdmissionHandlerFunc(validate PodValidator) http.HandlerFunc {
+	return handleError(func(w http.ResponseWriter, req *http.Request) error {
+		review := &admissionv1beta1.AdmissionReview{}
+		if err := json.NewDecoder(req.Body).Decode(review); err != nil {
+			return strongerrors.InvalidArgument(errors.Wrap(err, "error decoding admission review"))
+		}
+		if review.Request == nil {
+			return strongerrors.InvalidArgument(errors.New("admission review without request"))
+		}
+
+		review.Response = admitPod(req.Context(), review.Request, validate)
+		review.Response.UID = review.Request.UID
+		review.Request = nil
+		return writeJSON(w, review)
+	})
+}
+
+func admitPod(ctx context.Context, request *admissionv1beta1.AdmissionRequest, validate PodValidator) *admissionv1beta1.AdmissionResponse {
+	if request.Resource != podResource || request.SubResource != "" {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+	if request.Operation != admissionv1beta1.Create && request.Operation != admissionv1beta1.Update {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+
+	pod := &v1.Pod{}
+	if err := json.Unmarshal(request.Object.Raw, pod); err != nil {
+		return &admissionv1beta1.AdmissionResponse{
+			Result: &k8serrors.NewBadRequest(errors.Wrap(err, "error decoding pod").Error()).ErrStatus,
+		}
+	}
+	// A pod being deleted is allowed whatever it declares, so that it can be cleaned up.
+	if pod.DeletionTimestamp != nil {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+	var old *v1.Pod
+	if request.Operation == admissionv1beta1.Update {
+		old = &v1.Pod{}
+		if err := json.Unmarshal(request.OldObject.Raw, old); err != nil {
+			return &admissionv1beta1.AdmissionResponse{
+				Result: &k8serrors.NewBadRequest(errors.Wrap(err, "error decoding old pod").Error()).ErrStatus,
+			}
+		}
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = request.Namespace
+	}
+	name := pod.Name
+	if name == "" {
+		name = pod.GenerateName
+	}
+
+	errs := validate(ctx, pod, old)
+	if len(errs) == 0 {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+	log.G(ctx).WithField("pod", pod.Namespace+"/"+name).WithError(errs.ToAggregate()).Debug("Denying invalid pod")
+	return &admissionv1beta1.AdmissionResponse{
+		Result: &k8serrors.NewInvalid(schema.GroupKind{Kind: "Pod"}, name, errs).ErrStatus,
+	}
+}
@@ -0,0 +1,103 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestPodAdmissionHandler(t *testing.T) {
+	handler := PodAdmissionHandlerFunc(func(ctx context.Context, pod, old *v1.Pod) field.ErrorList {
+		if pod.Annotations["routes"] == "" || (old != nil && old.Annotations["routes"] == pod.Annotations["routes"]) {
+			return nil
+		}
+		return field.ErrorList{field.NotFound(field.NewPath("metadata", "annotations").Key("routes").Index(0).Child("to"), "writer")}
+	})
+	review := func(pod, old *v1.Pod) *admissionv1beta1.AdmissionResponse {
+		raw, err := json.Marshal(pod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		request := &admissionv1beta1.AdmissionRequest{
+			UID:       "review",
+			Resource:  podResource,
+			Operation: admissionv1beta1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		}
+		if old != nil {
+			request.Operation = admissionv1beta1.Update
+			if request.OldObject.Raw, err = json.Marshal(old); err != nil {
+				t.Fatal(err)
+			}
+		}
+		body, err := json.Marshal(&admissionv1beta1.AdmissionReview{Request: request})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/validate/pods", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status code %d: %s", w.Code, w.Body.String())
+		}
+		result := &admissionv1beta1.AdmissionReview{}
+		if err := json.NewDecoder(w.Body).Decode(result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Response == nil || result.Response.UID != "review" {
+			t.Fatalf("expected the response to the review, got %+v", result.Response)
+		}
+		return result.Response
+	}
+
+	if response := review(&v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "sensor"}}, nil); !response.Allowed {
+		t.Errorf("expected the valid pod to be allowed, got %+v", response.Result)
+	}
+
+	invalid := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "sensor", Annotations: map[string]string{"routes": `[{"to":"writer"}]`}}}
+	response := review(invalid, nil)
+	if response.Allowed {
+		t.Fatal("expected the invalid pod to be denied")
+	}
+	if response.Result.Details == nil || len(response.Result.Details.Causes) != 1 || response.Result.Details.Causes[0].Field != "metadata.annotations[routes][0].to" {
+		t.Errorf("expected the field of the error to be reported, got %+v", response.Result)
+	}
+
+	// An update is validated against the previous version of the pod, and a pod being deleted is always allowed.
+	labeled := invalid.DeepCopy()
+	labeled.Labels = map[string]string{"app": "sensor"}
+	if response := review(labeled, invalid); !response.Allowed {
+		t.Errorf("expected the unchanged routes to be allowed, got %+v", response.Result)
+	}
+	if response := review(invalid, &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "sensor"}}); response.Allowed {
+		t.Error("expected the changed routes to be denied")
+	}
+	deleting := invalid.DeepCopy()
+	now := metav1.Now()
+	deleting.DeletionTimestamp = &now
+	if response := review(deleting, &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "sensor"}}); !response.Allowed {
+		t.Errorf("expected the pod being deleted to be allowed, got %+v", response.Result)
+	}
+}
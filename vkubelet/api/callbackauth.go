@@ -0,0 +1,128 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/pkg/errors"
+)
+
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 signature of a callback.
+	SignatureHeader = "X-Iofog-Signature"
+	// TimestampHeader carries the Unix time, in seconds, at which a callback was signed.
+	TimestampHeader = "X-Iofog-Timestamp"
+
+	// defaultSignatureMaxAge bounds how old a signed callback can be, limiting replays.
+	defaultSignatureMaxAge = 5 * time.Minute
+	// maxSignedBodySize bounds the body read to verify a signature.
+	maxSignedBodySize = 1 << 20
+)
+
+// CallbackAuthenticator authenticates the callbacks of the ioFog Controller, either with a shared
+// token sent as a bearer token or with an HMAC signature of the request.
+// Requests are not authenticated when neither a token nor an HMAC key is configured.
+type CallbackAuthenticator struct {
+	Token   string
+	HMACKey []byte
+	MaxAge  time.Duration
+}
+
+// Enabled reports whether callbacks must be authenticated.
+func (a *CallbackAuthenticator) Enabled() bool {
+	return a != nil && (a.Token != "" || len(a.HMACKey) > 0)
+}
+
+// Authenticate checks the credentials of a request.
+// The signature covers the timestamp, the method, the request URI and the body, each separated by a new line.
+func (a *CallbackAuthenticator) Authenticate(req *http.Request) error {
+	if !a.Enabled() {
+		return nil
+	}
+
+	if a.Token != "" {
+		if token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "); token != "" {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) == 1 {
+				return nil
+			}
+		}
+	}
+
+	if len(a.HMACKey) > 0 && req.Header.Get(SignatureHeader) != "" {
+		return a.verifySignature(req)
+	}
+
+	return strongerrors.Unauthorized(errors.New("missing or invalid credentials"))
+}
+
+// Handler rejects the requests which are not authenticated.
+func (a *CallbackAuthenticator) Handler(h http.Handler) http.Handler {
+	return handleError(func(w http.ResponseWriter, req *http.Request) error {
+		if err := a.Authenticate(req); err != nil {
+			return err
+		}
+		h.ServeHTTP(w, req)
+		return nil
+	})
+}
+
+// Sign returns the signature of a request for the given timestamp and body.
+func (a *CallbackAuthenticator) Sign(timestamp, method, requestURI string, body []byte) string {
+	mac := hmac.New(sha256.New, a.HMACKey)
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + requestURI + "\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (a *CallbackAuthenticator) verifySignature(req *http.Request) error {
+	timestamp := req.Header.Get(TimestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return strongerrors.Unauthorized(errors.Errorf("invalid %s header", TimestampHeader))
+	}
+
+	maxAge := a.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultSignatureMaxAge
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > maxAge || age < -maxAge {
+		return strongerrors.Unauthorized(errors.New("signature expired"))
+	}
+
+	var body []byte
+	if req.Body != nil {
+		body, err = ioutil.ReadAll(http.MaxBytesReader(nil, req.Body, maxSignedBodySize))
+		if err != nil {
+			return strongerrors.InvalidArgument(errors.Wrap(err, "error reading request body"))
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := a.Sign(timestamp, req.Method, req.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(req.Header.Get(SignatureHeader)))) {
+		return strongerrors.Unauthorized(errors.New("invalid signature"))
+	}
+	return nil
+}
@@ -15,19 +15,51 @@ package api
 
 import (
 	"bytes"
-	"encoding/gob"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
 	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
-	"sync"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// storeLabel is set on every shard of a store to the name of the store.
+	storeLabel = "iofog.org/kubelet-store"
+
+	// defaultMaxShardSize keeps each shard well below the 1 MiB limit of a ConfigMap.
+	defaultMaxShardSize = 768 * 1024
+	// maxShards bounds how far a store grows before a Put is refused.
+	maxShards = 64
 )
 
+// errShardFull is returned by a shard mutation when the result would not fit in the shard.
+var errShardFull = fmt.Errorf("shard is full")
+
+// KeyValueStore persists values in ConfigMaps.
+// Keys are hashed across shards; the first shard is named after the store and the
+// following ones get an index suffix. Shards are created and rebalanced when they fill up.
+//
+// Several stores, in this process or in others, can share the same ConfigMaps:
+// writes are read-modify-write cycles retried on conflict, and Run keeps the
+// in-memory view in sync with the changes made by the other stores.
 type KeyValueStore struct {
 	configMapInterface corev1.ConfigMapInterface
 	mutex              *sync.Mutex
 	name               string
-	configMap          *v1.ConfigMap
+	shards             []*v1.ConfigMap
+	maxShardSize       int
 }
 
 func NewKeyValueStore(configMapInterface corev1.ConfigMapInterface, storeName string) (*KeyValueStore, error) {
@@ -35,17 +67,11 @@ func NewKeyValueStore(configMapInterface corev1.ConfigMapInterface, storeName st
 		configMapInterface: configMapInterface,
 		mutex:              &sync.Mutex{},
 		name:               storeName,
-		configMap:          nil,
+		maxShardSize:       defaultMaxShardSize,
 	}
 
-	if configMap, err := store.getStore(); err != nil {
+	if err := store.loadShards(); err != nil {
 		return nil, err
-	} else {
-		store.configMap = configMap
-	}
-
-	if store.configMap.BinaryData == nil {
-		store.configMap.BinaryData = make(map[string][]byte)
 	}
 
 	return store, nil
@@ -55,92 +81,576 @@ func (store *KeyValueStore) Get(key string, target interface{}) error {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	if data := store.configMap.BinaryData[key]; data == nil {
+	data := store.lookup(key)
+	if data == nil {
 		return nil
-	} else {
-		return store.decode(data, target)
 	}
+
+	legacy, err := decodeEntry(data, target)
+	if err != nil {
+		return fmt.Errorf("error decoding %s from store %s: %v", key, store.name, err)
+	}
+	if legacy {
+		store.migrate(key, data, target)
+	}
+	return nil
+}
+
+// Decode decodes the entry of a key like Get, but leaves legacy entries alone so that target may hold
+// only part of the value.
+func (store *KeyValueStore) Decode(key string, target interface{}) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	data := store.lookup(key)
+	if data == nil {
+		return nil
+	}
+
+	if _, err := decodeEntry(data, target); err != nil {
+		return fmt.Errorf("error decoding %s from store %s: %v", key, store.name, err)
+	}
+	return nil
 }
 
 func (store *KeyValueStore) Put(key string, value interface{}) error {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	data, err := store.encode(value)
+	data, err := encodeEntry(value)
 	if err != nil {
 		return err
 	}
+	if len(key)+len(data) > store.maxShardSize {
+		return fmt.Errorf("value of %s is too large for the store: %d bytes", key, len(data))
+	}
 
-	store.configMap.BinaryData[key] = data
-	_, err = store.configMapInterface.Update(store.configMap)
-
-	return err
+	idx := shardIndex(key, len(store.shards))
+	err = store.mutateShard(idx, func(content map[string][]byte) error {
+		content[key] = data
+		if dataSize(content) > store.maxShardSize {
+			return errShardFull
+		}
+		return nil
+	})
+	if err == errShardFull {
+		return store.rebalance(key, data)
+	}
+	if err != nil {
+		return err
+	}
+	return store.removeFromOtherShards(key, idx)
 }
 
 func (store *KeyValueStore) Remove(key string) error {
 	store.mutex.Lock()
 	defer store.mutex.Unlock()
 
-	delete(store.configMap.BinaryData, key)
-	_, err := store.configMapInterface.Update(store.configMap)
+	return store.removeFromOtherShards(key, -1)
+}
+
+// Run keeps the store in sync with the changes made to its ConfigMaps until the context is done.
+func (store *KeyValueStore) Run(ctx context.Context) {
+	selector := labels.SelectorFromSet(labels.Set{storeLabel: store.name}).String()
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = selector
+			return store.configMapInterface.List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = selector
+			return store.configMapInterface.Watch(options)
+		},
+	}
 
-	return err
+	_, informer := cache.NewInformer(listWatch, &v1.ConfigMap{}, 0, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if configMap, ok := obj.(*v1.ConfigMap); ok {
+				store.observe(configMap)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if configMap, ok := newObj.(*v1.ConfigMap); ok {
+				store.observe(configMap)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if configMap, ok := obj.(*v1.ConfigMap); ok {
+				log.G(ctx).WithField("configMap", configMap.Name).Warn("Shard of the store was deleted")
+				if err := store.forget(configMap); err != nil {
+					log.G(ctx).WithError(err).WithField("configMap", configMap.Name).Error("Failed to re-create shard of the store")
+				}
+			}
+		},
+	})
+	informer.Run(ctx.Done())
 }
 
-func (store *KeyValueStore) Keys() []string {
-	keys := make([]string, 0, len(store.configMap.BinaryData))
-	for key := range store.configMap.BinaryData {
-		keys = append(keys, key)
+// observe records a shard seen by the watch unless the store already has a more recent version of it.
+func (store *KeyValueStore) observe(configMap *v1.ConfigMap) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	idx, ok := store.shardIndexOf(configMap.Name)
+	if !ok || idx > len(store.shards) {
+		return
 	}
 
-	return keys
+	configMap = configMap.DeepCopy()
+	if idx == len(store.shards) {
+		store.shards = append(store.shards, configMap)
+		return
+	}
+	if isNewer(configMap.ResourceVersion, store.shards[idx].ResourceVersion) {
+		store.shards[idx] = configMap
+	}
+}
+
+// forget drops the entries of a deleted shard and re-creates it empty, so that the store neither serves
+// them nor writes to a ConfigMap which no longer exists. The shard is kept when it was already re-created.
+func (store *KeyValueStore) forget(configMap *v1.ConfigMap) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	idx, ok := store.shardIndexOf(configMap.Name)
+	if !ok || idx >= len(store.shards) {
+		return nil
+	}
+	current := store.shards[idx].ResourceVersion
+	if current != configMap.ResourceVersion && isNewer(current, configMap.ResourceVersion) {
+		return nil
+	}
+
+	shard, err := store.createShard(idx)
+	if err != nil {
+		// Writes to the shard fail until it is re-created, reads no longer see its entries.
+		empty := store.shards[idx].DeepCopy()
+		setShardContent(empty, nil)
+		store.shards[idx] = empty
+		return err
+	}
+	store.shards[idx] = shard
+	return nil
+}
+
+func (store *KeyValueStore) Keys() []string {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.keys()
 }
 
 func (store *KeyValueStore) Size() int {
-	return len(store.configMap.BinaryData)
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return len(store.keys())
+}
+
+func (store *KeyValueStore) keys() []string {
+	seen := make(map[string]bool)
+	keys := make([]string, 0)
+	for _, shard := range store.shards {
+		for key := range shardContent(shard) {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys
 }
 
-func (store *KeyValueStore) getStore() (*v1.ConfigMap, error) {
-	var configMap *v1.ConfigMap
-	var err error
+// lookup returns the value of a key, looking in its shard first and then in the others
+// in case a rebalance was interrupted.
+func (store *KeyValueStore) lookup(key string) []byte {
+	idx := shardIndex(key, len(store.shards))
+	if data, ok := shardValue(store.shards[idx], key); ok {
+		return data
+	}
+	for _, shard := range store.shards {
+		if data, ok := shardValue(shard, key); ok {
+			return data
+		}
+	}
+	return nil
+}
 
-	configMap, err = store.configMapInterface.Get(store.name, metav1.GetOptions{})
+// migrate rewrites an entry stored in a legacy encoding with the current one.
+// Failures are only logged since the entry could still be decoded.
+func (store *KeyValueStore) migrate(key string, legacy []byte, value interface{}) {
+	data, err := encodeEntry(value)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			configMap, err = store.createStore()
+		log.L.WithError(err).WithField("key", key).Warn("Error encoding legacy store entry")
+		return
+	}
+
+	for idx, shard := range store.shards {
+		if current, ok := shardValue(shard, key); !ok || !bytes.Equal(current, legacy) {
+			continue
+		}
+		err := store.mutateShard(idx, func(content map[string][]byte) error {
+			// Leave the entry alone if another store wrote it in the meantime.
+			if bytes.Equal(content[key], legacy) {
+				content[key] = data
+			}
+			return nil
+		})
+		if err != nil {
+			log.L.WithError(err).WithField("key", key).Warn("Error migrating legacy store entry")
 		}
+		return
+	}
+}
 
+// removeFromOtherShards removes a key from every shard except the one at index keep.
+func (store *KeyValueStore) removeFromOtherShards(key string, keep int) error {
+	for idx, shard := range store.shards {
+		if idx == keep {
+			continue
+		}
+		if _, ok := shardValue(shard, key); !ok {
+			continue
+		}
+		err := store.mutateShard(idx, func(content map[string][]byte) error {
+			delete(content, key)
+			return nil
+		})
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
+	return nil
+}
 
-	return configMap, nil
+// rebalance adds shards until every entry, including the new one, fits and redistributes the entries.
+// Entries are first copied to their new shard and only then removed from the old one,
+// so that they can always be found even if another store writes concurrently.
+func (store *KeyValueStore) rebalance(key string, data []byte) error {
+	if err := store.refreshShards(); err != nil {
+		return err
+	}
+
+	entries := make(map[string][]byte)
+	for _, name := range store.keys() {
+		entries[name] = store.lookup(name)
+	}
+	entries[key] = data
+
+	for count := len(store.shards) + 1; count <= maxShards; count++ {
+		partitions := partition(entries, count)
+		if !store.fits(partitions) {
+			continue
+		}
+
+		for idx := len(store.shards); idx < count; idx++ {
+			shard, err := store.createShard(idx)
+			if err != nil {
+				return err
+			}
+			store.shards = append(store.shards, shard)
+		}
+		// Every round moves the entries which fit into their new shard and drops the copies left behind,
+		// freeing the room needed by the next round.
+		for round := 0; round <= count; round++ {
+			changed := false
+			for idx := range store.shards {
+				version := store.shards[idx].ResourceVersion
+				err := store.mutateShard(idx, func(content map[string][]byte) error {
+					for name := range content {
+						if target := shardIndex(name, count); target != idx {
+							if _, ok := shardValue(store.shards[target], name); ok {
+								delete(content, name)
+							}
+						}
+					}
+					for name, value := range partitions[idx] {
+						// The value written concurrently by another store wins over the copy.
+						if _, ok := content[name]; ok && name != key {
+							continue
+						}
+						previous, existed := content[name]
+						content[name] = value
+						if dataSize(content) > store.maxShardSize {
+							if existed {
+								content[name] = previous
+							} else {
+								delete(content, name)
+							}
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				changed = changed || store.shards[idx].ResourceVersion != version
+			}
+			if !changed {
+				break
+			}
+		}
+		if !store.placed(partitions) {
+			return fmt.Errorf("error rebalancing store %s: entries could not be moved to their shard", store.name)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("store %s is full: cannot fit %d entries in %d shards", store.name, len(entries), maxShards)
+}
+
+func (store *KeyValueStore) fits(partitions []map[string][]byte) bool {
+	for _, content := range partitions {
+		if dataSize(content) > store.maxShardSize {
+			return false
+		}
+	}
+	return true
+}
+
+// placed reports whether every entry of the partitions is stored in its shard.
+func (store *KeyValueStore) placed(partitions []map[string][]byte) bool {
+	for idx, content := range partitions {
+		for name := range content {
+			if _, ok := shardValue(store.shards[idx], name); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// loadShards reads the existing shards of the store, creating the first one if needed.
+func (store *KeyValueStore) loadShards() error {
+	if err := store.refreshShards(); err != nil {
+		return err
+	}
+
+	// The first shard may predate sharding and miss the label the watch selects shards with.
+	if store.shards[0].Labels[storeLabel] == store.name {
+		return nil
+	}
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		updated := store.shards[0].DeepCopy()
+		if updated.Labels == nil {
+			updated.Labels = make(map[string]string)
+		}
+		updated.Labels[storeLabel] = store.name
+		return store.update(0, updated)
+	})
+}
+
+// refreshShards reads every shard of the store from the API server.
+func (store *KeyValueStore) refreshShards() error {
+	shards := make([]*v1.ConfigMap, 0, len(store.shards))
+	for idx := 0; ; idx++ {
+		configMap, err := store.configMapInterface.Get(store.shardName(idx), metav1.GetOptions{})
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				return err
+			}
+			if idx > 0 {
+				break
+			}
+			if configMap, err = store.createShard(idx); err != nil {
+				return err
+			}
+		}
+
+		shards = append(shards, configMap)
+	}
+
+	store.shards = shards
+	return nil
 }
 
-func (store *KeyValueStore) createStore() (*v1.ConfigMap, error) {
+// refreshShard reads a shard from the API server after a conflict.
+func (store *KeyValueStore) refreshShard(idx int) error {
+	configMap, err := store.configMapInterface.Get(store.shardName(idx), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	store.shards[idx] = configMap
+	return nil
+}
+
+// createShard creates an empty shard, or returns it when another store created it first.
+func (store *KeyValueStore) createShard(idx int) (*v1.ConfigMap, error) {
 	cfgMap := &v1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: store.name,
+			Name:   store.shardName(idx),
+			Labels: map[string]string{storeLabel: store.name},
 		},
 		Data: map[string]string{},
 	}
 
-	return store.configMapInterface.Create(cfgMap)
+	configMap, err := store.configMapInterface.Create(cfgMap)
+	if errors.IsAlreadyExists(err) {
+		configMap, err = store.configMapInterface.Get(cfgMap.Name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return configMap, nil
 }
 
-func (store *KeyValueStore) encode(data interface{}) ([]byte, error) {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	err := enc.Encode(data)
+// mutateShard applies a change to the latest known content of a shard and writes it,
+// reading the shard again and reapplying the change when another writer updated it first.
+func (store *KeyValueStore) mutateShard(idx int, mutate func(content map[string][]byte) error) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		shard := store.shards[idx]
+		original := shardContent(shard)
+		content := copyData(original)
+		if err := mutate(content); err != nil {
+			return err
+		}
+		if sameData(original, content) {
+			return nil
+		}
+
+		updated := shard.DeepCopy()
+		setShardContent(updated, content)
+		err := store.update(idx, updated)
+		if errors.IsConflict(err) {
+			if refreshErr := store.refreshShard(idx); refreshErr != nil {
+				return refreshErr
+			}
+		}
+		return err
+	})
+}
+
+// update writes a shard, its resource version guarding against concurrent writes, and keeps the result.
+func (store *KeyValueStore) update(idx int, shard *v1.ConfigMap) error {
+	configMap, err := store.configMapInterface.Update(shard)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	store.shards[idx] = configMap
+	return nil
+}
+
+func (store *KeyValueStore) shardName(idx int) string {
+	if idx == 0 {
+		return store.name
+	}
+	return fmt.Sprintf("%s-%d", store.name, idx)
+}
+
+// shardIndexOf returns the index of the shard with the given name.
+func (store *KeyValueStore) shardIndexOf(name string) (int, bool) {
+	if name == store.name {
+		return 0, true
+	}
+	suffix := strings.TrimPrefix(name, store.name+"-")
+	if suffix == name {
+		return 0, false
+	}
+	idx, err := strconv.Atoi(suffix)
+	if err != nil || idx <= 0 {
+		return 0, false
 	}
-	return buf.Bytes(), nil
+	return idx, true
 }
 
-func (store *KeyValueStore) decode(data []byte, target interface{}) error {
-	buf := bytes.NewBuffer(data)
-	dec := gob.NewDecoder(buf)
-	return dec.Decode(target)
+// shardValue returns the entry of a shard, stored either as text or as binary data.
+func shardValue(shard *v1.ConfigMap, key string) ([]byte, bool) {
+	if data, ok := shard.Data[key]; ok {
+		return []byte(data), true
+	}
+	data, ok := shard.BinaryData[key]
+	return data, ok
+}
+
+// shardContent returns every entry of a shard.
+func shardContent(shard *v1.ConfigMap) map[string][]byte {
+	content := make(map[string][]byte, len(shard.Data)+len(shard.BinaryData))
+	for key, data := range shard.BinaryData {
+		content[key] = data
+	}
+	for key, data := range shard.Data {
+		content[key] = []byte(data)
+	}
+	return content
+}
+
+// setShardContent replaces the entries of a shard. Entries are stored as text so that they can be
+// read with kubectl, except legacy binary entries which are kept until they are migrated.
+func setShardContent(shard *v1.ConfigMap, content map[string][]byte) {
+	shard.Data = make(map[string]string)
+	shard.BinaryData = nil
+	for key, data := range content {
+		if isTextEntry(data) {
+			shard.Data[key] = string(data)
+			continue
+		}
+		if shard.BinaryData == nil {
+			shard.BinaryData = make(map[string][]byte)
+		}
+		shard.BinaryData[key] = data
+	}
+}
+
+func shardIndex(key string, count int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(count))
+}
+
+// isNewer reports whether a resource version is more recent than the current one.
+// Resource versions are opaque, so unless both are numbers the observed one is assumed newer.
+func isNewer(observed, current string) bool {
+	observedVersion, err := strconv.ParseUint(observed, 10, 64)
+	if err != nil {
+		return true
+	}
+	currentVersion, err := strconv.ParseUint(current, 10, 64)
+	if err != nil {
+		return true
+	}
+	return observedVersion > currentVersion
+}
+
+func partition(entries map[string][]byte, count int) []map[string][]byte {
+	partitions := make([]map[string][]byte, count)
+	for idx := range partitions {
+		partitions[idx] = make(map[string][]byte)
+	}
+	for key, data := range entries {
+		partitions[shardIndex(key, count)][key] = data
+	}
+	return partitions
+}
+
+func dataSize(content map[string][]byte) int {
+	size := 0
+	for key, data := range content {
+		size += len(key) + len(data)
+	}
+	return size
+}
+
+func copyData(content map[string][]byte) map[string][]byte {
+	copied := make(map[string][]byte, len(content))
+	for key, data := range content {
+		copied[key] = data
+	}
+	return copied
+}
+
+func sameData(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, data := range a {
+		other, ok := b[key]
+		if !ok || !bytes.Equal(data, other) {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,263 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// fakeConfigMaps is an in-memory ConfigMapInterface which enforces resource versions on update.
+type fakeConfigMaps struct {
+	corev1.ConfigMapInterface
+	mutex      sync.Mutex
+	configMaps map[string]*v1.ConfigMap
+	version    int
+}
+
+func newFakeConfigMaps() *fakeConfigMaps {
+	return &fakeConfigMaps{configMaps: make(map[string]*v1.ConfigMap)}
+}
+
+var configMapResource = schema.GroupResource{Resource: "configmaps"}
+
+func (f *fakeConfigMaps) Create(configMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.configMaps[configMap.Name]; ok {
+		return nil, errors.NewAlreadyExists(configMapResource, configMap.Name)
+	}
+	return f.save(configMap), nil
+}
+
+func (f *fakeConfigMaps) Update(configMap *v1.ConfigMap) (*v1.ConfigMap, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	current, ok := f.configMaps[configMap.Name]
+	if !ok {
+		return nil, errors.NewNotFound(configMapResource, configMap.Name)
+	}
+	if configMap.ResourceVersion != current.ResourceVersion {
+		return nil, errors.NewConflict(configMapResource, configMap.Name, fmt.Errorf("resource version mismatch"))
+	}
+	return f.save(configMap), nil
+}
+
+func (f *fakeConfigMaps) Delete(name string, options *metav1.DeleteOptions) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.configMaps[name]; !ok {
+		return errors.NewNotFound(configMapResource, name)
+	}
+	delete(f.configMaps, name)
+	return nil
+}
+
+func (f *fakeConfigMaps) Get(name string, options metav1.GetOptions) (*v1.ConfigMap, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	configMap, ok := f.configMaps[name]
+	if !ok {
+		return nil, errors.NewNotFound(configMapResource, name)
+	}
+	return configMap.DeepCopy(), nil
+}
+
+func (f *fakeConfigMaps) List(opts metav1.ListOptions) (*v1.ConfigMapList, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	list := &v1.ConfigMapList{ListMeta: metav1.ListMeta{ResourceVersion: strconv.Itoa(f.version)}}
+	for _, configMap := range f.configMaps {
+		list.Items = append(list.Items, *configMap.DeepCopy())
+	}
+	return list, nil
+}
+
+func (f *fakeConfigMaps) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	return watch.NewFake(), nil
+}
+
+func (f *fakeConfigMaps) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (*v1.ConfigMap, error) {
+	return nil, fmt.Errorf("patch is not supported")
+}
+
+func (f *fakeConfigMaps) save(configMap *v1.ConfigMap) *v1.ConfigMap {
+	f.version++
+	saved := configMap.DeepCopy()
+	saved.ResourceVersion = strconv.Itoa(f.version)
+	if len(saved.Data) == 0 {
+		saved.Data = nil
+	}
+	if len(saved.BinaryData) == 0 {
+		saved.BinaryData = nil
+	}
+	f.configMaps[saved.Name] = saved
+	return saved.DeepCopy()
+}
+
+func TestKeyValueStoreSharding(t *testing.T) {
+	configMaps := newFakeConfigMaps()
+	store, err := NewKeyValueStore(configMaps, "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.maxShardSize = 1024
+
+	value := strings.Repeat("x", 100)
+	for i := 0; i < 40; i++ {
+		if err := store.Put(fmt.Sprintf("key-%d", i), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(store.shards) < 4 {
+		t.Fatalf("expected the store to be sharded, got %d shards", len(store.shards))
+	}
+	for _, shard := range configMaps.configMaps {
+		if size := dataSize(shardContent(shard)); size > store.maxShardSize {
+			t.Fatalf("shard %s exceeds the maximum size: %d", shard.Name, size)
+		}
+	}
+	if store.Size() != 40 {
+		t.Fatalf("expected 40 keys, got %d", store.Size())
+	}
+
+	if err := store.Remove("key-3"); err != nil {
+		t.Fatal(err)
+	}
+	var removed string
+	if err := store.Get("key-3", &removed); err != nil || removed != "" {
+		t.Fatalf("expected key-3 to be removed, got %q, %v", removed, err)
+	}
+
+	// A new store finds every shard and every key.
+	reloaded, err := NewKeyValueStore(configMaps, "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := reloaded.Keys()
+	sort.Strings(keys)
+	if len(keys) != 39 || len(reloaded.shards) != len(store.shards) {
+		t.Fatalf("unexpected reloaded store: %d keys in %d shards", len(keys), len(reloaded.shards))
+	}
+	var got string
+	if err := reloaded.Get("key-39", &got); err != nil || got != value {
+		t.Fatalf("unexpected value of key-39: %q, %v", got, err)
+	}
+
+	if err := store.Put("huge", strings.Repeat("x", 2048)); err == nil {
+		t.Fatal("expected an error storing a value larger than a shard")
+	}
+}
+
+func TestKeyValueStoreConcurrentWriters(t *testing.T) {
+	configMaps := newFakeConfigMaps()
+	first, err := NewKeyValueStore(configMaps, "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewKeyValueStore(configMaps, "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second store writes with a stale view of the shard and must not drop the first entry.
+	if err := first.Put("first", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Put("second", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	shard := configMaps.configMaps["store"]
+	if len(shard.Data) != 2 {
+		t.Fatalf("expected both entries to be stored, got %v", shard.Data)
+	}
+	if shard.Labels[storeLabel] != "store" {
+		t.Fatalf("expected the shard to be labelled, got %v", shard.Labels)
+	}
+
+	// The first store learns about the second entry from the watch.
+	first.observe(shard)
+	var value string
+	if err := first.Get("second", &value); err != nil || value != "b" {
+		t.Fatalf("unexpected value of the second entry: %q, %v", value, err)
+	}
+
+	// Events older than the known shard are ignored.
+	stale := shard.DeepCopy()
+	stale.ResourceVersion = "1"
+	stale.Data = nil
+	first.observe(stale)
+	if first.Size() != 2 {
+		t.Fatalf("expected a stale event to be ignored, got %d entries", first.Size())
+	}
+}
+
+func TestKeyValueStoreDeletedShard(t *testing.T) {
+	configMaps := newFakeConfigMaps()
+	store, err := NewKeyValueStore(configMaps, "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put("key", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := configMaps.configMaps["store"].DeepCopy()
+	if err := configMaps.Delete("store", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.forget(deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	// The entries of the deleted shard are gone and the store writes to the re-created shard.
+	if store.Size() != 0 {
+		t.Fatalf("expected the entries of the deleted shard to be dropped, got %v", store.Keys())
+	}
+	recreated, ok := configMaps.configMaps["store"]
+	if !ok || recreated.Labels[storeLabel] != "store" {
+		t.Fatalf("expected the shard to be re-created, got %v", recreated)
+	}
+	if err := store.Put("other", "value"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A deletion older than the re-created shard is ignored.
+	if err := store.forget(deleted); err != nil {
+		t.Fatal(err)
+	}
+	var value string
+	if err := store.Get("other", &value); err != nil || value != "value" {
+		t.Fatalf("unexpected value of the entry: %q, %v", value, err)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package api
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+)
+
+// entryVersion is the schema version of the entries written to the store.
+// Bump it and handle the previous versions in decodeEntry when the layout of the stored values changes.
+const entryVersion = 1
+
+// entry is the envelope every value is stored in.
+type entry struct {
+	Version int             `json:"version"`
+	Value   json.RawMessage `json:"value"`
+}
+
+// encodeEntry encodes a value as JSON in a versioned envelope.
+func encodeEntry(value interface{}) ([]byte, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding store entry: %v", err)
+	}
+	return json.Marshal(entry{Version: entryVersion, Value: raw})
+}
+
+// decodeEntry decodes an entry into target. Entries written with gob before the envelope
+// was introduced are still decoded, legacy is then true so that the caller can rewrite them.
+func decodeEntry(data []byte, target interface{}) (legacy bool, err error) {
+	if !isTextEntry(data) {
+		return decodeLegacyEntry(data, target)
+	}
+
+	var envelope entry
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		// A gob value may look like text, give it a chance before failing.
+		if legacy, legacyErr := decodeLegacyEntry(data, target); legacyErr == nil {
+			return legacy, nil
+		}
+		return false, fmt.Errorf("invalid entry: %v", err)
+	}
+	switch {
+	case envelope.Version == 0:
+		return false, fmt.Errorf("invalid entry: missing schema version")
+	case envelope.Version > entryVersion:
+		return false, fmt.Errorf("unsupported schema version %d, the latest supported version is %d", envelope.Version, entryVersion)
+	}
+
+	if err := json.Unmarshal(envelope.Value, target); err != nil {
+		return false, fmt.Errorf("invalid entry of version %d: %v", envelope.Version, err)
+	}
+	return false, nil
+}
+
+func decodeLegacyEntry(data []byte, target interface{}) (bool, error) {
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(target); err != nil {
+		return false, fmt.Errorf("invalid legacy entry: %v", err)
+	}
+	return true, nil
+}
+
+// isTextEntry reports whether data holds a JSON envelope rather than a legacy gob value.
+func isTextEntry(data []byte) bool {
+	return len(data) > 0 && data[0] == '{' && utf8.Valid(data)
+}
@@ -0,0 +1,98 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package api
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type storedValue struct {
+	Name  string
+	Count int
+}
+
+func TestEntryEncoding(t *testing.T) {
+	data, err := encodeEntry(storedValue{Name: "pod", Count: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), `{"version":1,`) {
+		t.Fatalf("unexpected encoding: %s", data)
+	}
+
+	var value storedValue
+	if legacy, err := decodeEntry(data, &value); err != nil || legacy || value.Name != "pod" || value.Count != 2 {
+		t.Fatalf("unexpected decoding: %+v, legacy %v, %v", value, legacy, err)
+	}
+
+	if _, err := decodeEntry([]byte(`{"version":2,"value":{}}`), &value); err == nil || !strings.Contains(err.Error(), "unsupported schema version 2") {
+		t.Fatalf("expected an unsupported version error, got: %v", err)
+	}
+	if _, err := decodeEntry([]byte(`{"version":1,"value":{"Count":"two"}}`), &value); err == nil {
+		t.Fatal("expected an error decoding a mistyped entry")
+	}
+	if _, err := decodeEntry([]byte{0x01, 0x02}, &value); err == nil {
+		t.Fatal("expected an error decoding garbage")
+	}
+}
+
+func TestKeyValueStoreMigratesGobEntries(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(storedValue{Name: "legacy", Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	configMaps := newFakeConfigMaps()
+	configMaps.Create(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "store"},
+		BinaryData: map[string][]byte{"pod": buf.Bytes()},
+	})
+	store, err := NewKeyValueStore(configMaps, "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Decoding part of the entry leaves it alone.
+	var name struct{ Name string }
+	if err := store.Decode("pod", &name); err != nil || name.Name != "legacy" {
+		t.Fatalf("unexpected part of the legacy value: %+v, %v", name, err)
+	}
+	if len(configMaps.configMaps["store"].BinaryData) != 1 {
+		t.Fatal("expected the legacy entry not to be rewritten when decoding part of it")
+	}
+
+	var value storedValue
+	if err := store.Get("pod", &value); err != nil || value.Name != "legacy" {
+		t.Fatalf("unexpected legacy value: %+v, %v", value, err)
+	}
+
+	shard := configMaps.configMaps["store"]
+	if len(shard.BinaryData) != 0 || !strings.Contains(shard.Data["pod"], `"Name":"legacy"`) {
+		t.Fatalf("expected the entry to be rewritten as JSON, got data %v, binary data %v", shard.Data, shard.BinaryData)
+	}
+
+	corrupted := shard.DeepCopy()
+	corrupted.ResourceVersion = "100"
+	corrupted.Data["pod"] = `{"version":1,"value":[]}`
+	store.observe(corrupted)
+	if err := store.Get("pod", &value); err == nil || !strings.Contains(err.Error(), "error decoding pod from store store") {
+		t.Fatalf("expected a decoding error, got: %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	remoteutils "k8s.io/apimachinery/pkg/util/remotecommand"
+)
+
+const (
+	execIdleTimeout = 30 * time.Second
+)
+
+// PodExecHandlerFunc returns an http.HandlerFunc executing a command in a pod container.
+// The connection is upgraded to SPDY and the container streams are relayed to the provider.
+func PodExecHandlerFunc(resolver ProviderResolver) http.HandlerFunc {
+	return handleError(func(w http.ResponseWriter, req *http.Request) error {
+		vars := mux.Vars(req)
+		namespace := vars["namespace"]
+		pod := vars["pod"]
+		container := vars["container"]
+
+		query := req.URL.Query()
+		command := query["command"]
+		if len(command) == 0 {
+			return strongerrors.InvalidArgument(errors.New("missing \"command\" parameter"))
+		}
+
+		opts := streamOptions{
+			stdin:  isTrue(query.Get(v1.ExecStdinParam)),
+			stdout: isTrue(query.Get(v1.ExecStdoutParam)),
+			stderr: isTrue(query.Get(v1.ExecStderrParam)),
+			tty:    isTrue(query.Get(v1.ExecTTYParam)),
+		}
+		if opts.tty && opts.stderr {
+			// Stderr is multiplexed into stdout by the terminal.
+			opts.stderr = false
+		}
+		if !opts.stdin && !opts.stdout && !opts.stderr {
+			return strongerrors.InvalidArgument(errors.New("you must specify at least one of stdin, stdout, stderr"))
+		}
+
+		provider, err := resolver.ProviderForPod(req, namespace, pod)
+		if err != nil {
+			return err
+		}
+
+		ctx, ok := createStreams(w, req, opts, remoteutils.DefaultStreamCreationTimeout, execIdleTimeout)
+		if !ok {
+			// The error has already been written to the client.
+			return nil
+		}
+		defer ctx.conn.Close()
+
+		execErr := provider.ExecInContainer(req.Context(), pod, types.UID(""), container, command, ctx.stdinStream, ctx.stdoutStream, ctx.stderrStream, opts.tty, ctx.resizeChan, 0)
+		if err := ctx.writeStatus(execErr); err != nil {
+			log.G(req.Context()).WithError(err).Error("Error writing exec status to client")
+		}
+		return nil
+	})
+}
+
+func isTrue(value string) bool {
+	return value == "1" || strings.EqualFold(value, "true")
+}
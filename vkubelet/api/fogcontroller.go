@@ -15,22 +15,115 @@ package api
 
 import (
 	"net/http"
+	"regexp"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
 )
 
-func FogControllerHandlerStopFunc(stopFunc func(nodeId string, deleteNode bool)) http.HandlerFunc {
+// agentUUIDPattern matches the UUIDs the ioFog Controller gives to agents.
+var agentUUIDPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// FogControllerCallbacks are the actions triggered by the ioFog Controller.
+type FogControllerCallbacks struct {
+	// Start starts the node of an agent.
+	Start func(nodeId string) error
+	// Stop stops the node of an agent, deleting it from Kubernetes if requested.
+	Stop func(nodeId string, deleteNode bool) error
+	// Status reports the state of the nodes.
+	Status func() interface{}
+	// AgentExists asks the ioFog Controller whether an agent exists.
+	AgentExists func(nodeId string) (bool, error)
+	// NodeRunning reports whether the node of an agent is running.
+	NodeRunning func(nodeId string) bool
+}
+
+func FogControllerHandlerStopFunc(callbacks FogControllerCallbacks, operations *OperationTracker) http.HandlerFunc {
 	return handleError(func(w http.ResponseWriter, req *http.Request) error {
-		nodeId := req.FormValue("uuid")
-		go stopFunc(nodeId, true)
+		nodeId, err := agentUUID(req)
+		if err != nil {
+			return err
+		}
+		// The agent is usually already removed from the Controller when it asks to stop its node.
+		if !callbacks.NodeRunning(nodeId) {
+			if err := checkAgentExists(callbacks, nodeId); err != nil {
+				return err
+			}
+		}
 
-		return nil
+		operation, err := operations.Run("stop", nodeId, func() error {
+			return callbacks.Stop(nodeId, true)
+		})
+		if err != nil {
+			return err
+		}
+		return writeAccepted(w, operation)
 	})
 }
 
-func FogControllerHandlerStartFunc(startFunc func(nodeId string)) http.HandlerFunc {
+func FogControllerHandlerStartFunc(callbacks FogControllerCallbacks, operations *OperationTracker) http.HandlerFunc {
 	return handleError(func(w http.ResponseWriter, req *http.Request) error {
-		nodeId := req.FormValue("uuid")
-		go startFunc(nodeId)
+		nodeId, err := agentUUID(req)
+		if err != nil {
+			return err
+		}
+		if err := checkAgentExists(callbacks, nodeId); err != nil {
+			return err
+		}
+
+		operation, err := operations.Run("start", nodeId, func() error {
+			return callbacks.Start(nodeId)
+		})
+		if err != nil {
+			return err
+		}
+		return writeAccepted(w, operation)
+	})
+}
 
-		return nil
+// FogControllerHandlerOperationFunc reports the progress of an operation as JSON.
+func FogControllerHandlerOperationFunc(operations *OperationTracker) http.HandlerFunc {
+	return handleError(func(w http.ResponseWriter, req *http.Request) error {
+		id := mux.Vars(req)["id"]
+		operation, ok := operations.Get(id)
+		if !ok {
+			return strongerrors.NotFound(errors.Errorf("operation %s not found", id))
+		}
+		return writeJSON(w, operation)
 	})
-}
\ No newline at end of file
+}
+
+// FogControllerHandlerStatusFunc reports the state of the nodes as JSON.
+func FogControllerHandlerStatusFunc(statusFunc func() interface{}) http.HandlerFunc {
+	return handleError(func(w http.ResponseWriter, req *http.Request) error {
+		return writeJSON(w, statusFunc())
+	})
+}
+
+func agentUUID(req *http.Request) (string, error) {
+	nodeId := req.FormValue("uuid")
+	if !agentUUIDPattern.MatchString(nodeId) {
+		return "", strongerrors.InvalidArgument(errors.Errorf("invalid agent UUID %q", nodeId))
+	}
+	return nodeId, nil
+}
+
+func checkAgentExists(callbacks FogControllerCallbacks, nodeId string) error {
+	exists, err := callbacks.AgentExists(nodeId)
+	if err != nil {
+		return strongerrors.Unavailable(errors.Wrap(err, "error looking up the agent in the ioFog Controller"))
+	}
+	if !exists {
+		return strongerrors.NotFound(errors.Errorf("agent %s not found", nodeId))
+	}
+	return nil
+}
+
+// writeAccepted answers 202 with the pending operation and where to follow it.
+func writeAccepted(w http.ResponseWriter, operation Operation) error {
+	w.Header().Set("Location", "/operations/"+operation.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	return writeJSON(w, operation)
+}
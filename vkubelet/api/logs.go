@@ -0,0 +1,125 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// PodLogsHandlerFunc returns an http.HandlerFunc serving the logs of a pod container.
+func PodLogsHandlerFunc(resolver ProviderResolver) http.HandlerFunc {
+	return handleError(func(w http.ResponseWriter, req *http.Request) error {
+		vars := mux.Vars(req)
+		if len(vars) != 3 {
+			return strongerrors.NotFound(errors.New("not found"))
+		}
+
+		namespace := vars["namespace"]
+		pod := vars["pod"]
+		container := vars["container"]
+
+		opts, err := parseLogOptions(req.URL.Query())
+		if err != nil {
+			return strongerrors.InvalidArgument(err)
+		}
+
+		provider, err := resolver.ProviderForPod(req, namespace, pod)
+		if err != nil {
+			return err
+		}
+
+		logs, err := provider.GetContainerLogs(req.Context(), namespace, pod, container, opts)
+		if err != nil {
+			return errors.Wrap(err, "error getting container logs")
+		}
+		defer logs.Close()
+
+		var out io.Writer = w
+		if flusher, ok := w.(http.Flusher); ok && opts.Follow {
+			out = &flushWriter{w: w, f: flusher}
+		}
+		if _, err := io.Copy(out, logs); err != nil {
+			return strongerrors.Unknown(errors.Wrap(err, "error writing response to client"))
+		}
+		return nil
+	})
+}
+
+// parseLogOptions reads the options of a log request, named as in v1.PodLogOptions.
+func parseLogOptions(query url.Values) (providers.ContainerLogOpts, error) {
+	opts := providers.ContainerLogOpts{}
+
+	if value := query.Get("tailLines"); value != "" {
+		tail, err := strconv.Atoi(value)
+		if err != nil || tail < 0 {
+			return opts, errors.Errorf("could not parse \"tailLines\": %q", value)
+		}
+		opts.Tail = tail
+	}
+
+	if value := query.Get("limitBytes"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 {
+			return opts, errors.Errorf("could not parse \"limitBytes\": %q", value)
+		}
+		opts.LimitBytes = limit
+	}
+
+	if value := query.Get("sinceSeconds"); value != "" {
+		since, err := strconv.Atoi(value)
+		if err != nil || since < 1 {
+			return opts, errors.Errorf("could not parse \"sinceSeconds\": %q", value)
+		}
+		opts.SinceSeconds = since
+	}
+
+	if value := query.Get("sinceTime"); value != "" {
+		if opts.SinceSeconds > 0 {
+			return opts, errors.New("\"sinceSeconds\" and \"sinceTime\" are mutually exclusive")
+		}
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return opts, errors.Wrap(err, "could not parse \"sinceTime\"")
+		}
+		opts.SinceTime = since
+	}
+
+	opts.Follow = isTrue(query.Get("follow"))
+	opts.Timestamps = isTrue(query.Get("timestamps"))
+
+	return opts, nil
+}
+
+// flushWriter flushes every write so that followed logs reach the client as they come.
+type flushWriter struct {
+	w io.Writer
+	f http.Flusher
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if n > 0 {
+		fw.f.Flush()
+	}
+	return n, err
+}
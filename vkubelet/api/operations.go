@@ -0,0 +1,139 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// defaultOperationsLimit is how many operations are remembered before the oldest finished ones are forgotten.
+const defaultOperationsLimit = 1000
+
+// OperationStatus is the progress of an asynchronous operation.
+type OperationStatus string
+
+const (
+	OperationPending   OperationStatus = "Pending"
+	OperationRunning   OperationStatus = "Running"
+	OperationSucceeded OperationStatus = "Succeeded"
+	OperationFailed    OperationStatus = "Failed"
+)
+
+// Operation is an asynchronous action requested by the ioFog Controller.
+type Operation struct {
+	ID       string          `json:"id"`
+	Type     string          `json:"type"`
+	NodeID   string          `json:"nodeId"`
+	Status   OperationStatus `json:"status"`
+	Error    string          `json:"error,omitempty"`
+	Created  time.Time       `json:"created"`
+	Finished *time.Time      `json:"finished,omitempty"`
+}
+
+// OperationTracker runs operations in the background and keeps their result so that they can be queried.
+type OperationTracker struct {
+	mutex      sync.Mutex
+	operations map[string]*Operation
+	order      []string
+	limit      int
+}
+
+// NewOperationTracker creates a tracker remembering the most recent operations.
+func NewOperationTracker() *OperationTracker {
+	return &OperationTracker{
+		operations: make(map[string]*Operation),
+		limit:      defaultOperationsLimit,
+	}
+}
+
+// Run starts an operation in the background and returns it while it is pending. The operation is running until run
+// returns, it then succeeded or failed with the error of run.
+func (t *OperationTracker) Run(operationType, nodeId string, run func() error) (Operation, error) {
+	id, err := newOperationID()
+	if err != nil {
+		return Operation{}, err
+	}
+
+	operation := &Operation{
+		ID:      id,
+		Type:    operationType,
+		NodeID:  nodeId,
+		Status:  OperationPending,
+		Created: time.Now(),
+	}
+
+	t.mutex.Lock()
+	t.operations[id] = operation
+	t.order = append(t.order, id)
+	t.prune()
+	pending := *operation
+	t.mutex.Unlock()
+
+	go func() {
+		t.mutex.Lock()
+		operation.Status = OperationRunning
+		t.mutex.Unlock()
+
+		err := run()
+
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		finished := time.Now()
+		operation.Finished = &finished
+		if err != nil {
+			operation.Status = OperationFailed
+			operation.Error = err.Error()
+		} else {
+			operation.Status = OperationSucceeded
+		}
+	}()
+
+	return pending, nil
+}
+
+// Get returns an operation by ID.
+func (t *OperationTracker) Get(id string) (Operation, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	operation, ok := t.operations[id]
+	if !ok {
+		return Operation{}, false
+	}
+	return *operation, true
+}
+
+// prune forgets the oldest finished operations above the limit.
+func (t *OperationTracker) prune() {
+	for idx := 0; len(t.order) > t.limit && idx < len(t.order); {
+		id := t.order[idx]
+		if t.operations[id].Finished == nil {
+			idx++
+			continue
+		}
+		delete(t.operations, id)
+		t.order = append(t.order[:idx], t.order[idx+1:]...)
+	}
+}
+
+func newOperationID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
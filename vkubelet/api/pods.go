@@ -0,0 +1,111 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+)
+
+// ProviderResolver finds the provider backing the node targeted by a kubelet API request.
+type ProviderResolver interface {
+	// ProviderForNode returns the provider of the named node.
+	ProviderForNode(req *http.Request, nodeName string) (providers.Provider, error)
+
+	// ProviderForPod returns the provider of the node running the given pod.
+	ProviderForPod(req *http.Request, namespace, name string) (providers.Provider, error)
+
+	// Providers returns the providers of every node served, indexed by node name.
+	Providers() map[string]providers.Provider
+}
+
+// RunningPodsHandlerFunc returns an http.HandlerFunc listing the pods running on the nodes served.
+// The nodes share the address of the server, a request cannot target one of them.
+func RunningPodsHandlerFunc(resolver ProviderResolver) http.HandlerFunc {
+	return handleError(func(w http.ResponseWriter, req *http.Request) error {
+		podList := &v1.PodList{}
+		podList.Kind = "PodList"
+		podList.APIVersion = "v1"
+		podList.Items = []v1.Pod{}
+		for _, provider := range resolver.Providers() {
+			pods, err := provider.GetPods(req.Context())
+			if err != nil {
+				return errors.Wrap(err, "error getting pods from provider")
+			}
+			for _, pod := range pods {
+				podList.Items = append(podList.Items, *pod)
+			}
+		}
+		return writeJSON(w, podList)
+	})
+}
+
+type nodeNameKey struct{}
+
+// WithNodeName returns a context naming the node whose kubelet port a request was addressed to.
+func WithNodeName(ctx context.Context, nodeName string) context.Context {
+	return context.WithValue(ctx, nodeNameKey{}, nodeName)
+}
+
+// NodeName returns the node whose kubelet port a request was addressed to, empty for the shared port.
+func NodeName(ctx context.Context) string {
+	nodeName, _ := ctx.Value(nodeNameKey{}).(string)
+	return nodeName
+}
+
+// PodStatsSummaryHandlerFunc returns an http.HandlerFunc serving the stats summary of the node whose kubelet port
+// the request was addressed to.
+func PodStatsSummaryHandlerFunc(resolver ProviderResolver) http.HandlerFunc {
+	return handleError(func(w http.ResponseWriter, req *http.Request) error {
+		nodeName := NodeName(req.Context())
+		if nodeName == "" {
+			return strongerrors.InvalidArgument(errors.New("the stats summary is only served on the kubelet port of a node"))
+		}
+
+		provider, err := resolver.ProviderForNode(req, nodeName)
+		if err != nil {
+			return err
+		}
+
+		metricsProvider, ok := provider.(providers.PodMetricsProvider)
+		if !ok {
+			return strongerrors.NotImplemented(errors.New("provider does not implement stats summary"))
+		}
+
+		stats, err := metricsProvider.GetStatsSummary(req.Context())
+		if err != nil {
+			return errors.Wrap(err, "error getting stats from provider")
+		}
+		return writeJSON(w, stats)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling response")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(b); err != nil {
+		return errors.Wrap(err, "could not write to client")
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	remoteutils "k8s.io/apimachinery/pkg/util/remotecommand"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+)
+
+// supportedStreamProtocols are the remote command SPDY subprotocols served by the kubelet API.
+// The initial unversioned protocol is not supported.
+var supportedStreamProtocols = []string{
+	remoteutils.StreamProtocolV4Name,
+	remoteutils.StreamProtocolV3Name,
+	remoteutils.StreamProtocolV2Name,
+}
+
+// streamOptions holds the streams requested by the client.
+type streamOptions struct {
+	stdin  bool
+	stdout bool
+	stderr bool
+	tty    bool
+}
+
+// streamContext holds the streams of an upgraded remote command connection.
+type streamContext struct {
+	conn         io.Closer
+	protocol     string
+	stdinStream  io.ReadCloser
+	stdoutStream io.WriteCloser
+	stderrStream io.WriteCloser
+	errorStream  io.WriteCloser
+	resizeStream io.ReadCloser
+	resizeChan   chan remotecommand.TerminalSize
+}
+
+type streamAndReply struct {
+	httpstream.Stream
+	replySent <-chan struct{}
+}
+
+// createStreams negotiates the protocol, upgrades the connection and waits for the client to open the expected streams.
+// When false is returned, the error has already been written to the client.
+func createStreams(w http.ResponseWriter, req *http.Request, opts streamOptions, streamCreationTimeout, idleTimeout time.Duration) (*streamContext, bool) {
+	protocol, err := httpstream.Handshake(req, w, supportedStreamProtocols)
+	if err != nil {
+		return nil, false
+	}
+	if protocol == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "unable to negotiate a remote command protocol, supported protocols: %v", supportedStreamProtocols)
+		return nil, false
+	}
+
+	streamCh := make(chan streamAndReply)
+	upgrader := spdy.NewResponseUpgrader()
+	conn := upgrader.UpgradeResponse(w, req, func(stream httpstream.Stream, replySent <-chan struct{}) error {
+		streamCh <- streamAndReply{Stream: stream, replySent: replySent}
+		return nil
+	})
+	// The upgrader writes the error to the client when it fails.
+	if conn == nil {
+		return nil, false
+	}
+	conn.SetIdleTimeout(idleTimeout)
+
+	ctx, err := waitForStreams(streamCh, opts, protocol, streamCreationTimeout)
+	if err != nil {
+		log.G(req.Context()).WithError(err).Error("Error waiting for remote command streams")
+		conn.Close()
+		return nil, false
+	}
+	ctx.conn = conn
+
+	if ctx.resizeStream != nil {
+		ctx.resizeChan = make(chan remotecommand.TerminalSize)
+		go handleResizeEvents(ctx.resizeStream, ctx.resizeChan)
+	}
+
+	return ctx, true
+}
+
+func waitForStreams(streams <-chan streamAndReply, opts streamOptions, protocol string, timeout time.Duration) (*streamContext, error) {
+	expected := 1 // error stream
+	if opts.stdin {
+		expected++
+	}
+	if opts.stdout {
+		expected++
+	}
+	if opts.stderr {
+		expected++
+	}
+	if opts.tty && protocol != remoteutils.StreamProtocolV2Name {
+		expected++
+	}
+
+	ctx := &streamContext{protocol: protocol}
+	replyChan := make(chan struct{}, expected)
+	expired := time.NewTimer(timeout)
+	defer expired.Stop()
+
+	for received := 0; received < expected; {
+		select {
+		case stream := <-streams:
+			switch streamType := stream.Headers().Get(v1.StreamType); streamType {
+			case v1.StreamTypeError:
+				ctx.errorStream = stream
+			case v1.StreamTypeStdin:
+				ctx.stdinStream = stream
+			case v1.StreamTypeStdout:
+				ctx.stdoutStream = stream
+			case v1.StreamTypeStderr:
+				ctx.stderrStream = stream
+			case v1.StreamTypeResize:
+				ctx.resizeStream = stream
+			default:
+				return nil, fmt.Errorf("unexpected stream type: %q", streamType)
+			}
+			received++
+			go waitStreamReply(stream.replySent, replyChan)
+		case <-expired.C:
+			return nil, fmt.Errorf("timed out waiting for client to create streams")
+		}
+	}
+
+	// Wait for the replies to be sent before streaming data.
+	for i := 0; i < expected; i++ {
+		select {
+		case <-replyChan:
+		case <-expired.C:
+			return nil, fmt.Errorf("timed out waiting for stream replies to be sent")
+		}
+	}
+
+	return ctx, nil
+}
+
+func waitStreamReply(replySent <-chan struct{}, notify chan<- struct{}) {
+	<-replySent
+	notify <- struct{}{}
+}
+
+func handleResizeEvents(stream io.Reader, channel chan<- remotecommand.TerminalSize) {
+	defer close(channel)
+
+	decoder := json.NewDecoder(stream)
+	for {
+		size := remotecommand.TerminalSize{}
+		if err := decoder.Decode(&size); err != nil {
+			return
+		}
+		channel <- size
+	}
+}
+
+// writeStatus reports the result of the remote command on the error stream.
+func (ctx *streamContext) writeStatus(err error) error {
+	defer ctx.errorStream.Close()
+
+	if ctx.protocol != remoteutils.StreamProtocolV4Name {
+		if err == nil {
+			return nil
+		}
+		_, writeErr := ctx.errorStream.Write([]byte(err.Error()))
+		return writeErr
+	}
+
+	status := &metav1.Status{Status: metav1.StatusSuccess}
+	if err != nil {
+		status = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: err.Error(),
+		}
+		if exitErr, ok := err.(exec.ExitError); ok && exitErr.Exited() {
+			status.Reason = remoteutils.NonZeroExitCodeReason
+			status.Details = &metav1.StatusDetails{
+				Causes: []metav1.StatusCause{
+					{
+						Type:    remoteutils.ExitCodeCauseType,
+						Message: fmt.Sprintf("%d", exitErr.ExitStatus()),
+					},
+				},
+			}
+		}
+	}
+
+	b, marshalErr := json.Marshal(status)
+	if marshalErr != nil {
+		return marshalErr
+	}
+	_, writeErr := ctx.errorStream.Write(b)
+	return writeErr
+}
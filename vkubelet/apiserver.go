@@ -67,16 +67,85 @@ func NotImplemented(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "501 not implemented", http.StatusNotImplemented)
 }
 
-func AttachFogControllerRoutes(mux ServeMux, startFunc func(nodeId string), stopFunc func(nodeId string, deleteNode bool)) {
-	mux.Handle("/", InstrumentHandler(FogControllerHandler(startFunc, stopFunc)))
+// PodHandler creates an http handler for interacting with pods/containers.
+func PodHandler(resolver api.ProviderResolver) http.Handler {
+	r := mux.NewRouter()
+
+	r.HandleFunc("/runningpods/", api.RunningPodsHandlerFunc(resolver)).Methods("GET")
+	r.HandleFunc("/containerLogs/{namespace}/{pod}/{container}", api.PodLogsHandlerFunc(resolver)).Methods("GET")
+	r.HandleFunc("/exec/{namespace}/{pod}/{container}", api.PodExecHandlerFunc(resolver)).Methods("POST", "GET")
+	r.NotFoundHandler = http.HandlerFunc(NotFound)
+	return r
 }
 
-func FogControllerHandler(startFunc func(nodeId string), stopFunc func(nodeId string, deleteNode bool)) http.Handler {
+// MetricsSummaryHandler creates an http handler for serving pod metrics.
+//
+// The nodes share the address of the server, the summary of a node is served on the kubelet port of the node,
+// see NodeHandler. If the provider of the requested node does not implement providers.PodMetricsProvider,
+// the handler will respond with NotImplemented.
+func MetricsSummaryHandler(resolver api.ProviderResolver) http.Handler {
 	r := mux.NewRouter()
 
-	r.HandleFunc("/node", api.FogControllerHandlerStopFunc(stopFunc)).Queries("uuid", "{uuid}").Methods("DELETE")
-	r.HandleFunc("/node", api.FogControllerHandlerStartFunc(startFunc)).Queries("uuid", "{uuid}").Methods("POST")
-
+	r.HandleFunc("/stats/summary", api.PodStatsSummaryHandlerFunc(resolver)).Methods("GET")
 	r.NotFoundHandler = http.HandlerFunc(NotFound)
 	return r
 }
+
+// NodeHandler serves the requests addressed to the kubelet port of a node, which the node advertises so that the
+// requests without a pod, such as /stats/summary, reach it.
+func NodeHandler(nodeName string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		h.ServeHTTP(w, req.WithContext(api.WithNodeName(req.Context(), nodeName)))
+	})
+}
+
+// AttachPodRoutes adds the http routes for pod stuff to the passed in serve mux.
+//
+// Callers should take care to namespace the serve mux as they see fit, however
+// these routes get called by the Kubernetes API server.
+func AttachPodRoutes(resolver api.ProviderResolver, mux ServeMux) {
+	mux.Handle("/", InstrumentHandler(PodHandler(resolver)))
+}
+
+// AttachMetricsRoutes adds the http routes for pod/node metrics to the passed in serve mux.
+//
+// Callers should take care to namespace the serve mux as they see fit, however
+// these routes get called by the Kubernetes API server.
+func AttachMetricsRoutes(resolver api.ProviderResolver, mux ServeMux) {
+	mux.Handle("/stats/", InstrumentHandler(MetricsSummaryHandler(resolver)))
+}
+
+// AttachAdmissionRoutes adds the http route of the validating webhook of the pods to the passed in serve mux.
+func AttachAdmissionRoutes(mux ServeMux, validate api.PodValidator) {
+	mux.Handle("/validate/pods", InstrumentHandler(api.PodAdmissionHandlerFunc(validate)))
+}
+
+// FogControllerConfig configures the server handling the callbacks of the ioFog Controller.
+type FogControllerConfig struct {
+	Callbacks     api.FogControllerCallbacks
+	Authenticator *api.CallbackAuthenticator
+	Operations    *api.OperationTracker
+}
+
+func AttachFogControllerRoutes(mux ServeMux, config FogControllerConfig) {
+	mux.Handle("/", InstrumentHandler(FogControllerHandler(config)))
+}
+
+// FogControllerHandler handles the callbacks of the ioFog Controller.
+// Starting and stopping nodes is asynchronous: the handlers answer 202 with an operation
+// which can be followed on GET /operations/{id}. The state of the nodes is reported on GET /nodes.
+func FogControllerHandler(config FogControllerConfig) http.Handler {
+	if config.Operations == nil {
+		config.Operations = api.NewOperationTracker()
+	}
+
+	r := mux.NewRouter()
+
+	r.HandleFunc("/nodes", api.FogControllerHandlerStatusFunc(config.Callbacks.Status)).Methods("GET")
+	r.HandleFunc("/operations/{id}", api.FogControllerHandlerOperationFunc(config.Operations)).Methods("GET")
+	r.HandleFunc("/node", api.FogControllerHandlerStopFunc(config.Callbacks, config.Operations)).Queries("uuid", "{uuid}").Methods("DELETE")
+	r.HandleFunc("/node", api.FogControllerHandlerStartFunc(config.Callbacks, config.Operations)).Queries("uuid", "{uuid}").Methods("POST")
+
+	r.NotFoundHandler = http.HandlerFunc(NotFound)
+	return config.Authenticator.Handler(r)
+}
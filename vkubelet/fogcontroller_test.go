@@ -0,0 +1,108 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package vkubelet
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/eclipse-iofog/iofog-kubelet/v2/vkubelet/api"
+	"github.com/pkg/errors"
+)
+
+func TestFogControllerHandler(t *testing.T) {
+	started := make(chan string, 1)
+	authenticator := &api.CallbackAuthenticator{Token: "secret", HMACKey: []byte("key")}
+	handler := FogControllerHandler(FogControllerConfig{
+		Authenticator: authenticator,
+		Callbacks: api.FogControllerCallbacks{
+			Start: func(nodeId string) error {
+				started <- nodeId
+				return nil
+			},
+			Stop: func(nodeId string, deleteNode bool) error {
+				return errors.New("stop failed")
+			},
+			Status:      func() interface{} { return []string{} },
+			AgentExists: func(nodeId string) (bool, error) { return nodeId == "known", nil },
+			NodeRunning: func(nodeId string) bool { return nodeId == "running" },
+		},
+	})
+
+	serve := func(method, target string, auth func(req *http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if auth != nil {
+			auth(req)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	bearer := func(req *http.Request) { req.Header.Set("Authorization", "Bearer secret") }
+
+	if w := serve("POST", "/node?uuid=known", nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected unauthenticated requests to be rejected, got %d", w.Code)
+	}
+	if w := serve("POST", "/node?uuid=unknown", bearer); w.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown agents to be rejected, got %d", w.Code)
+	}
+	if w := serve("POST", "/node?uuid=bad%20uuid", bearer); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid UUIDs to be rejected, got %d", w.Code)
+	}
+
+	w := serve("POST", "/node?uuid=known", bearer)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected the start to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+	if nodeId := <-started; nodeId != "known" {
+		t.Fatalf("unexpected started node: %s", nodeId)
+	}
+
+	// Signed requests are accepted as well.
+	signed := func(req *http.Request) {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(api.TimestampHeader, timestamp)
+		req.Header.Set(api.SignatureHeader, authenticator.Sign(timestamp, req.Method, req.URL.RequestURI(), nil))
+	}
+	w = serve("DELETE", "/node?uuid=running", signed)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected the stop to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+	var operation api.Operation
+	if err := json.Unmarshal(w.Body.Bytes(), &operation); err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get("Location") != "/operations/"+operation.ID {
+		t.Fatalf("unexpected location: %s", w.Header().Get("Location"))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for operation.Finished == nil && time.Now().Before(deadline) {
+		w = serve("GET", "/operations/"+operation.ID, bearer)
+		if err := json.Unmarshal(w.Body.Bytes(), &operation); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if operation.Status != api.OperationFailed || operation.Error != "stop failed" {
+		t.Fatalf("unexpected operation: %+v", operation)
+	}
+
+	if w := serve("GET", "/operations/unknown", bearer); w.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown operations to be not found, got %d", w.Code)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package vkubelet
+
+import (
+	"context"
+	"time"
+
+	"github.com/cpuguy83/strongerrors/status/ocstatus"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/trace"
+	coordinationv1beta1 "k8s.io/api/coordination/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// nodeLeaseNamespace is where the kubelets renew the Lease of their node.
+	nodeLeaseNamespace = "kube-node-lease"
+	// DefaultNodeLeaseDuration is how long a node Lease is valid, it is renewed four times as often.
+	DefaultNodeLeaseDuration = 40 * time.Second
+)
+
+// renewNodeLease renews the Lease of the node, creating it when missing.
+// It reports whether the Lease could be renewed, the cluster may not serve node Leases.
+func (s *Server) renewNodeLease(ctx context.Context) bool {
+	ctx, span := trace.StartSpan(ctx, "renewNodeLease")
+	defer span.End()
+
+	leases := s.Client.CoordinationV1beta1().Leases(nodeLeaseNamespace)
+	now := metav1.NewMicroTime(time.Now())
+
+	lease, err := leases.Get(s.nodeName, metav1.GetOptions{})
+	switch {
+	case errors.IsNotFound(err):
+		lease = s.newNodeLease(now)
+		_, err = leases.Create(lease)
+	case err == nil:
+		lease = lease.DeepCopy()
+		s.setNodeLeaseSpec(lease, now)
+		_, err = leases.Update(lease)
+	}
+
+	if err != nil {
+		log.G(ctx).WithError(err).Debug("Failed to renew node lease")
+		span.SetStatus(ocstatus.FromError(err))
+		return false
+	}
+	return true
+}
+
+func (s *Server) newNodeLease(now metav1.MicroTime) *coordinationv1beta1.Lease {
+	lease := &coordinationv1beta1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      s.nodeName,
+			Namespace: nodeLeaseNamespace,
+		},
+	}
+	s.setNodeLeaseSpec(lease, now)
+	return lease
+}
+
+// setNodeLeaseSpec renews the Lease and makes the node its owner, so that it is deleted with the node.
+func (s *Server) setNodeLeaseSpec(lease *coordinationv1beta1.Lease, now metav1.MicroTime) {
+	durationSeconds := int32(s.nodeLeaseDuration / time.Second)
+	lease.Spec.HolderIdentity = &s.nodeName
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.RenewTime = &now
+
+	uid := s.getNodeUID()
+	if uid == "" || len(lease.OwnerReferences) > 0 {
+		return
+	}
+	lease.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: corev1.SchemeGroupVersion.String(),
+		Kind:       "Node",
+		Name:       s.nodeName,
+		UID:        uid,
+	}}
+}
@@ -0,0 +1,197 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package vkubelet
+
+import (
+	"context"
+	"time"
+
+	"github.com/cpuguy83/strongerrors/status/ocstatus"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/trace"
+	pkgerrors "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// TaintNodeNotReady is set on the node while its Ready condition is False.
+	TaintNodeNotReady = "node.kubernetes.io/not-ready"
+	// TaintNodeUnreachable is set on the node while its Ready condition is Unknown.
+	TaintNodeUnreachable = "node.kubernetes.io/unreachable"
+
+	// DefaultPodEvictionTimeout is how long the node can be unready before its pods are evicted.
+	DefaultPodEvictionTimeout = 5 * time.Minute
+	// drainRetryPeriod is how often the evictions refused by disruption budgets are retried while draining.
+	drainRetryPeriod = 5 * time.Second
+)
+
+// nodeReadyStatus returns the status of the Ready condition, Unknown when it is not reported.
+func nodeReadyStatus(conditions []corev1.NodeCondition) corev1.ConditionStatus {
+	for _, condition := range conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status
+		}
+	}
+	return corev1.ConditionUnknown
+}
+
+// readinessTaints returns the taints matching the Ready condition of a node, like the node lifecycle controller does.
+func readinessTaints(conditions []corev1.NodeCondition) []corev1.Taint {
+	var key string
+	switch nodeReadyStatus(conditions) {
+	case corev1.ConditionFalse:
+		key = TaintNodeNotReady
+	case corev1.ConditionUnknown:
+		key = TaintNodeUnreachable
+	default:
+		return nil
+	}
+	return []corev1.Taint{
+		{Key: key, Effect: corev1.TaintEffectNoSchedule},
+		{Key: key, Effect: corev1.TaintEffectNoExecute},
+	}
+}
+
+// syncReadinessTaints sets the readiness taints of a node and removes the ones which no longer apply.
+// It reports whether the taints changed.
+func syncReadinessTaints(n *corev1.Node, conditions []corev1.NodeCondition) bool {
+	wanted := make(map[string]corev1.Taint)
+	for _, taint := range readinessTaints(conditions) {
+		wanted[taintID(taint)] = taint
+	}
+
+	changed := false
+	taints := make([]corev1.Taint, 0, len(n.Spec.Taints)+len(wanted))
+	for _, taint := range n.Spec.Taints {
+		if taint.Key != TaintNodeNotReady && taint.Key != TaintNodeUnreachable {
+			taints = append(taints, taint)
+			continue
+		}
+		if _, ok := wanted[taintID(taint)]; ok {
+			delete(wanted, taintID(taint))
+			taints = append(taints, taint)
+			continue
+		}
+		changed = true
+	}
+	for _, taint := range readinessTaints(conditions) {
+		if _, ok := wanted[taintID(taint)]; !ok {
+			continue
+		}
+		if taint.Effect == corev1.TaintEffectNoExecute {
+			now := metav1.Now()
+			taint.TimeAdded = &now
+		}
+		taints = append(taints, taint)
+		changed = true
+	}
+
+	n.Spec.Taints = taints
+	return changed
+}
+
+// observeReadiness records since when the node is unready.
+func (s *Server) observeReadiness(status corev1.ConditionStatus) {
+	s.nodeMutex.Lock()
+	defer s.nodeMutex.Unlock()
+
+	switch {
+	case status == corev1.ConditionTrue:
+		s.unreadySince = time.Time{}
+	case s.unreadySince.IsZero():
+		s.unreadySince = time.Now()
+	}
+}
+
+func (s *Server) getUnreadySince() time.Time {
+	s.nodeMutex.Lock()
+	defer s.nodeMutex.Unlock()
+	return s.unreadySince
+}
+
+// evictPodsOfUnreadyNode evicts the pods of the node once it has been unready for longer than the pod eviction timeout.
+// The evictions refused by disruption budgets are retried on the next node sync.
+func (s *Server) evictPodsOfUnreadyNode(ctx context.Context) {
+	if s.podEvictionTimeout < 0 {
+		return
+	}
+	since := s.getUnreadySince()
+	if since.IsZero() || time.Since(since) < s.podEvictionTimeout {
+		return
+	}
+
+	if err := s.EvictPods(ctx); err != nil {
+		log.G(ctx).WithError(err).Warn("Failed to evict the pods of the unready node")
+	}
+}
+
+// EvictPods evicts the pods of the node through the eviction API, so that pod disruption budgets are respected.
+// Pods owned by a DaemonSet are left in place. An error is returned while budgets prevent some evictions.
+func (s *Server) EvictPods(ctx context.Context) error {
+	ctx, span := trace.StartSpan(ctx, "evictPods")
+	defer span.End()
+
+	blocked := 0
+	for _, pod := range s.resourceManager.GetPods() {
+		if pod.DeletionTimestamp != nil || ownedByDaemonSet(pod) {
+			continue
+		}
+
+		eviction := &policyv1beta1.Eviction{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+		}
+		err := s.Client.PolicyV1beta1().Evictions(pod.Namespace).Evict(eviction)
+		logger := log.G(ctx).WithField("pod", pod.Name).WithField("namespace", pod.Namespace)
+		switch {
+		case err == nil:
+			logger.Info("Evicted pod")
+		case errors.IsNotFound(err):
+		case errors.IsTooManyRequests(err):
+			logger.Debug("Pod eviction refused by its disruption budget")
+			blocked++
+		default:
+			span.SetStatus(ocstatus.FromError(err))
+			return pkgerrors.Wrapf(err, "error evicting pod %s/%s", pod.Namespace, pod.Name)
+		}
+	}
+
+	if blocked > 0 {
+		return pkgerrors.Errorf("%d pods cannot be evicted without violating their disruption budget", blocked)
+	}
+	return nil
+}
+
+// DrainNode evicts the pods of the node, retrying the evictions refused by disruption budgets until the context is done.
+func (s *Server) DrainNode(ctx context.Context) error {
+	return wait.PollImmediateUntil(drainRetryPeriod, func() (bool, error) {
+		if err := s.EvictPods(ctx); err != nil {
+			log.G(ctx).WithError(err).Debug("Node not drained yet")
+			return false, nil
+		}
+		return true, nil
+	}, ctx.Done())
+}
+
+func ownedByDaemonSet(pod *corev1.Pod) bool {
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "DaemonSet" && owner.Controller != nil && *owner.Controller {
+			return true
+		}
+	}
+	return false
+}
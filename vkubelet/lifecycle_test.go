@@ -0,0 +1,58 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package vkubelet
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSyncReadinessTaints(t *testing.T) {
+	defaultTaint := corev1.Taint{Key: "resource-type", Value: "iofog-custom-resource", Effect: corev1.TaintEffectNoSchedule}
+	node := &corev1.Node{Spec: corev1.NodeSpec{Taints: []corev1.Taint{defaultTaint}}}
+	unknown := []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionUnknown}}
+
+	if !syncReadinessTaints(node, unknown) {
+		t.Fatal("expected the node to change")
+	}
+	if len(node.Spec.Taints) != 3 {
+		t.Fatalf("expected the unreachable taints, got %v", node.Spec.Taints)
+	}
+	for _, taint := range node.Spec.Taints[1:] {
+		if taint.Key != TaintNodeUnreachable {
+			t.Errorf("expected an unreachable taint, got %v", taint)
+		}
+		if (taint.Effect == corev1.TaintEffectNoExecute) != (taint.TimeAdded != nil) {
+			t.Errorf("expected only the NoExecute taint to have a time, got %v", taint)
+		}
+	}
+	if syncReadinessTaints(node, unknown) {
+		t.Fatal("expected the node to be unchanged")
+	}
+
+	if !syncReadinessTaints(node, []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionFalse}}) {
+		t.Fatal("expected the node to change")
+	}
+	if len(node.Spec.Taints) != 3 || node.Spec.Taints[1].Key != TaintNodeNotReady {
+		t.Fatalf("expected the not-ready taints, got %v", node.Spec.Taints)
+	}
+
+	if !syncReadinessTaints(node, []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}) {
+		t.Fatal("expected the node to change")
+	}
+	if len(node.Spec.Taints) != 1 || node.Spec.Taints[0] != defaultTaint {
+		t.Fatalf("expected only the default taint, got %v", node.Spec.Taints)
+	}
+}
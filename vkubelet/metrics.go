@@ -0,0 +1,56 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package vkubelet
+
+import (
+	"context"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+const (
+	podStatusWritten = "written"
+	podStatusSkipped = "skipped"
+	podStatusFailed  = "failed"
+)
+
+var (
+	podStatusUpdates = stats.Int64("iofog_kubelet/pod_status_updates", "Pod status updates by result", stats.UnitDimensionless)
+	resultKey        = mustNewKey("result")
+)
+
+// Views are the metrics recorded by the kubelet, they are exported once registered with view.Register.
+var Views = []*view.View{
+	{
+		Name:        "iofog_kubelet/pod_status_updates",
+		Description: "Number of pod statuses written to Kubernetes or skipped because they did not change",
+		Measure:     podStatusUpdates,
+		TagKeys:     []tag.Key{resultKey},
+		Aggregation: view.Count(),
+	},
+}
+
+func recordPodStatusUpdate(ctx context.Context, result string) {
+	stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(resultKey, result)}, podStatusUpdates.M(1))
+}
+
+func mustNewKey(name string) tag.Key {
+	key, err := tag.NewKey(name)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
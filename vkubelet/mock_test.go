@@ -0,0 +1,106 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package vkubelet
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// mockProvider is an in-memory provider used by the tests of this package.
+type mockProvider struct {
+	pods      map[string]*corev1.Pod
+	addresses []corev1.NodeAddress
+}
+
+func newMockProvider(addresses ...string) *mockProvider {
+	p := &mockProvider{pods: make(map[string]*corev1.Pod)}
+	for _, address := range addresses {
+		p.addresses = append(p.addresses, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: address})
+	}
+	return p
+}
+
+func (p *mockProvider) CreatePod(ctx context.Context, pod *corev1.Pod) error {
+	p.pods[pod.Namespace+"/"+pod.Name] = pod
+	return nil
+}
+
+func (p *mockProvider) UpdatePod(ctx context.Context, pod *corev1.Pod) error {
+	return p.CreatePod(ctx, pod)
+}
+
+func (p *mockProvider) DeletePod(ctx context.Context, pod *corev1.Pod) error {
+	delete(p.pods, pod.Namespace+"/"+pod.Name)
+	return nil
+}
+
+func (p *mockProvider) GetPod(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+	return p.pods[namespace+"/"+name], nil
+}
+
+func (p *mockProvider) GetContainerLogs(ctx context.Context, namespace, podName, containerName string, opts providers.ContainerLogOpts) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (p *mockProvider) ExecInContainer(ctx context.Context, name string, uid types.UID, container string, cmd []string, in io.Reader, out, err io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize, timeout time.Duration) error {
+	return nil
+}
+
+func (p *mockProvider) GetPodStatus(ctx context.Context, namespace, name string) (*corev1.PodStatus, error) {
+	if pod := p.pods[namespace+"/"+name]; pod != nil {
+		return &pod.Status, nil
+	}
+	return nil, nil
+}
+
+func (p *mockProvider) GetPods(ctx context.Context) ([]*corev1.Pod, error) {
+	pods := make([]*corev1.Pod, 0, len(p.pods))
+	for _, pod := range p.pods {
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+func (p *mockProvider) Capacity(ctx context.Context) corev1.ResourceList {
+	return corev1.ResourceList{}
+}
+
+func (p *mockProvider) Allocatable(ctx context.Context) corev1.ResourceList {
+	return corev1.ResourceList{}
+}
+
+func (p *mockProvider) NodeConditions(ctx context.Context) []corev1.NodeCondition {
+	return nil
+}
+
+func (p *mockProvider) NodeAddresses(ctx context.Context) []corev1.NodeAddress {
+	return p.addresses
+}
+
+func (p *mockProvider) NodeDaemonEndpoints(ctx context.Context) *corev1.NodeDaemonEndpoints {
+	return &corev1.NodeDaemonEndpoints{}
+}
+
+func (p *mockProvider) OperatingSystem() string {
+	return "linux"
+}
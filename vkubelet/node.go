@@ -14,16 +14,24 @@
 package vkubelet
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/cpuguy83/strongerrors/status/ocstatus"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/trace"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/versions"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/util/retry"
 )
 
 var (
@@ -32,17 +40,22 @@ var (
 	vkVersion = strings.Join([]string{"iofog-kubelet", version.Version}, "-")
 )
 
+const (
+	// managedLabelsAnnotation lists the labels set from the provider metadata, so that they are removed once no longer reported.
+	managedLabelsAnnotation = "iofog.org/managed-labels"
+	// managedAnnotationsAnnotation lists the annotations set from the provider metadata.
+	managedAnnotationsAnnotation = "iofog.org/managed-annotations"
+	// managedTaintsAnnotation lists the key and effect of the taints set from the provider metadata, and of the taint of every node.
+	managedTaintsAnnotation = "iofog.org/managed-taints"
+
+	defaultArchitecture = "amd64"
+)
+
 // registerNode registers the virtual node with the Kubernetes API.
 func (s *Server) registerNode(ctx context.Context) error {
 	ctx, span := trace.StartSpan(ctx, "registerNode")
 	defer span.End()
 
-	taints := make([]corev1.Taint, 0)
-
-	if s.taint != nil {
-		taints = append(taints, *s.taint)
-	}
-
 	node := &corev1.Node{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: s.nodeName,
@@ -55,12 +68,12 @@ func (s *Server) registerNode(ctx context.Context) error {
 			},
 		},
 		Spec: corev1.NodeSpec{
-			Taints: taints,
+			Taints: []corev1.Taint{},
 		},
 		Status: corev1.NodeStatus{
 			NodeInfo: corev1.NodeSystemInfo{
 				OperatingSystem: s.provider.OperatingSystem(),
-				Architecture:    "amd64",
+				Architecture:    defaultArchitecture,
 				KubeletVersion:  vkVersion,
 			},
 			Capacity:        s.provider.Capacity(ctx),
@@ -70,33 +83,44 @@ func (s *Server) registerNode(ctx context.Context) error {
 			DaemonEndpoints: *s.provider.NodeDaemonEndpoints(ctx),
 		},
 	}
+	metadata := s.nodeMetadata(ctx)
+	if metadata == nil {
+		// The node is tainted from the start even when the provider cannot describe it yet.
+		metadata = withDefaultTaint(&providers.NodeMetadata{}, s.taint)
+	}
+	applyNodeMetadata(node, metadata)
 	ctx = addNodeAttributes(ctx, span, node)
-	if _, err := s.Client.CoreV1().Nodes().Create(node); err != nil && !errors.IsAlreadyExists(err) {
+	created, err := s.Client.CoreV1().Nodes().Create(node)
+	if err != nil && !errors.IsAlreadyExists(err) {
 		span.SetStatus(ocstatus.FromError(err))
 		return err
 	}
+	if err == nil {
+		s.setNodeUID(created.UID)
+		s.setLastStatusReport(time.Now())
+	}
 
 	log.G(ctx).Info("Registered node")
 
 	return nil
 }
 
-// updateNode updates the node status within Kubernetes with updated NodeConditions.
+// updateNode patches the metadata of the node when it changed, and its status when it changed or was last
+// reported longer than the status report frequency ago. The status is reported on every call while the node
+// Lease cannot be renewed, since the status is then the only heartbeat of the node.
 func (s *Server) updateNode(ctx context.Context) {
 	ctx, span := trace.StartSpan(ctx, "updateNode")
 	defer span.End()
 
-	opts := metav1.GetOptions{}
-	n, err := s.Client.CoreV1().Nodes().Get(s.nodeName, opts)
+	// Reading from the cache of the API server is enough: the status patch does not depend on the resource version,
+	// and the metadata patch is computed again from a quorum read when the cached node was stale.
+	n, err := s.Client.CoreV1().Nodes().Get(s.nodeName, metav1.GetOptions{ResourceVersion: "0"})
 	if err != nil && !errors.IsNotFound(err) {
 		log.G(ctx).WithError(err).Error("Failed to retrive node")
 		span.SetStatus(ocstatus.FromError(err))
 		return
 	}
 
-	ctx = addNodeAttributes(ctx, span, n)
-	log.G(ctx).Debug("Fetched node details from k8s")
-
 	if errors.IsNotFound(err) {
 		if err = s.registerNode(ctx); err != nil {
 			log.G(ctx).WithError(err).Error("Failed to register node")
@@ -107,22 +131,293 @@ func (s *Server) updateNode(ctx context.Context) {
 		return
 	}
 
-	n.ResourceVersion = "" // Blank out resource version to prevent object has been modified error
-	n.Status.Conditions = s.provider.NodeConditions(ctx)
+	ctx = addNodeAttributes(ctx, span, n)
+	s.setNodeUID(n.UID)
 
-	capacity := s.provider.Capacity(ctx)
-	allocatable := s.provider.Allocatable(ctx)
-	n.Status.Capacity = capacity
-	n.Status.Allocatable = allocatable
+	conditions := mergeNodeConditions(n.Status.Conditions, s.provider.NodeConditions(ctx))
+	s.observeReadiness(nodeReadyStatus(conditions))
 
-	n.Status.Addresses = s.provider.NodeAddresses(ctx)
+	// The status is ignored when patching the node itself, it is patched afterwards.
+	metadata := s.nodeMetadata(ctx)
+	apply := func(n *corev1.Node) bool {
+		changed := metadata != nil && applyNodeMetadata(n, metadata)
+		if syncReadinessTaints(n, conditions) {
+			changed = true
+		}
+		return changed
+	}
+	updated := n.DeepCopy()
+	if apply(updated) {
+		if n, err = s.patchNodeMetadata(n, apply); err != nil {
+			log.G(ctx).WithError(err).Error("Failed to update node metadata")
+			span.SetStatus(ocstatus.FromError(err))
+			return
+		}
+		updated = n.DeepCopy()
+		apply(updated)
+	}
 
-	n, err = s.Client.CoreV1().Nodes().UpdateStatus(n)
-	if err != nil {
+	updated.Status.Conditions = conditions
+	updated.Status.Capacity = s.provider.Capacity(ctx)
+	updated.Status.Allocatable = s.provider.Allocatable(ctx)
+	updated.Status.Addresses = s.provider.NodeAddresses(ctx)
+	// The kubelet port of the node can change when it is started again.
+	updated.Status.DaemonEndpoints = *s.provider.NodeDaemonEndpoints(ctx)
+
+	if !nodeStatusChanged(&n.Status, &updated.Status) && s.leaseRenewed() && time.Since(s.lastStatusReport()) < s.nodeStatusReportFrequency {
+		log.G(ctx).Debug("Node status unchanged, skipping report")
+		return
+	}
+
+	if _, err = s.patchNodeStatus(n, updated); err != nil {
 		log.G(ctx).WithError(err).Error("Failed to update node")
 		span.SetStatus(ocstatus.FromError(err))
 		return
 	}
+	s.setLastStatusReport(time.Now())
+}
+
+// patchNodeMetadata patches the metadata and spec of the node as changed by apply. The patch carries the resource
+// version of the node it is computed from, so that it does not overwrite the changes made since, such as taints added
+// by the node lifecycle controller: on a conflict, the node is read again from etcd and the patch computed again.
+func (s *Server) patchNodeMetadata(n *corev1.Node, apply func(n *corev1.Node) bool) (*corev1.Node, error) {
+	var patched *corev1.Node
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		updated := n.DeepCopy()
+		if !apply(updated) {
+			patched = n
+			return nil
+		}
+		patch, err := nodePatch(n, updated, true)
+		if err != nil {
+			return err
+		}
+		patched, err = s.Client.CoreV1().Nodes().Patch(s.nodeName, types.StrategicMergePatchType, patch)
+		if errors.IsConflict(err) {
+			latest, getErr := s.Client.CoreV1().Nodes().Get(s.nodeName, metav1.GetOptions{})
+			if getErr != nil {
+				return getErr
+			}
+			n = latest
+		}
+		return err
+	})
+	return patched, err
+}
+
+// patchNodeStatus patches the status of the node with the strategic merge patch from the original to the updated node.
+func (s *Server) patchNodeStatus(original, updated *corev1.Node) (*corev1.Node, error) {
+	patch, err := nodePatch(original, updated, false)
+	if err != nil {
+		return nil, err
+	}
+	return s.Client.CoreV1().Nodes().PatchStatus(s.nodeName, patch)
+}
+
+// nodePatch creates the strategic merge patch from the original to the updated node. When versioned, the patch
+// carries the resource version of the original node and is rejected with a conflict if the node changed since,
+// else it is applied whatever the version of the node.
+func nodePatch(original, updated *corev1.Node, versioned bool) ([]byte, error) {
+	if versioned {
+		updated = updated.DeepCopy()
+		updated.ResourceVersion = original.ResourceVersion
+		original = original.DeepCopy()
+		original.ResourceVersion = ""
+	}
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return nil, err
+	}
+	updatedJSON, err := json.Marshal(updated)
+	if err != nil {
+		return nil, err
+	}
+	return strategicpatch.CreateTwoWayMergePatch(originalJSON, updatedJSON, corev1.Node{})
+}
+
+// mergeNodeConditions keeps the transition time of the conditions whose status did not change.
+func mergeNodeConditions(previous, conditions []corev1.NodeCondition) []corev1.NodeCondition {
+	merged := make([]corev1.NodeCondition, 0, len(conditions))
+	for _, condition := range conditions {
+		for _, old := range previous {
+			if old.Type == condition.Type && old.Status == condition.Status && !old.LastTransitionTime.IsZero() {
+				condition.LastTransitionTime = old.LastTransitionTime
+			}
+		}
+		merged = append(merged, condition)
+	}
+	return merged
+}
+
+// nodeStatusChanged reports whether the status changed, ignoring the heartbeat times of the conditions.
+func nodeStatusChanged(original, updated *corev1.NodeStatus) bool {
+	withoutHeartbeats := func(status *corev1.NodeStatus) *corev1.NodeStatus {
+		status = status.DeepCopy()
+		for idx := range status.Conditions {
+			status.Conditions[idx].LastHeartbeatTime = metav1.Time{}
+		}
+		return status
+	}
+	originalJSON, err := json.Marshal(withoutHeartbeats(original))
+	if err != nil {
+		return true
+	}
+	updatedJSON, err := json.Marshal(withoutHeartbeats(updated))
+	if err != nil {
+		return true
+	}
+	return !bytes.Equal(originalJSON, updatedJSON)
+}
+
+// nodeMetadata returns the metadata of the node: the taint of every node, and what the provider describes.
+// It is nil when the provider fails to describe the node, so that the node is left unchanged.
+func (s *Server) nodeMetadata(ctx context.Context) *providers.NodeMetadata {
+	metadata := &providers.NodeMetadata{}
+	if p, ok := s.provider.(providers.NodeMetadataProvider); ok {
+		var err error
+		if metadata, err = p.NodeMetadata(ctx); err != nil {
+			log.G(ctx).WithError(err).Warn("Failed to get node metadata")
+			return nil
+		}
+	}
+	return withDefaultTaint(metadata, s.taint)
+}
+
+// withDefaultTaint adds the taint of every node to the taints of the metadata, unless they set a taint with the same
+// key and effect. The default taint is then managed like the other taints of the node: it is restored once the
+// metadata no longer overrides it, and removed once it is no longer configured.
+func withDefaultTaint(metadata *providers.NodeMetadata, taint *corev1.Taint) *providers.NodeMetadata {
+	if metadata == nil || taint == nil {
+		return metadata
+	}
+	for _, existing := range metadata.Taints {
+		if taintID(existing) == taintID(*taint) {
+			return metadata
+		}
+	}
+	withTaint := *metadata
+	withTaint.Taints = append([]corev1.Taint{*taint}, metadata.Taints...)
+	return &withTaint
+}
+
+// applyNodeMetadata sets the labels, annotations, taints and architecture of a node, removing the labels,
+// annotations and taints it previously set which are no longer reported. It reports whether the metadata changed.
+func applyNodeMetadata(n *corev1.Node, metadata *providers.NodeMetadata) bool {
+	if n.Labels == nil {
+		n.Labels = make(map[string]string)
+	}
+	if n.Annotations == nil {
+		n.Annotations = make(map[string]string)
+	}
+
+	if metadata.Architecture != "" {
+		n.Status.NodeInfo.Architecture = metadata.Architecture
+	}
+
+	changed := false
+	if syncManaged(n.Labels, n.Annotations, managedLabelsAnnotation, metadata.Labels) {
+		changed = true
+	}
+	if syncManaged(n.Annotations, n.Annotations, managedAnnotationsAnnotation, metadata.Annotations) {
+		changed = true
+	}
+	if syncManagedTaints(n, metadata.Taints) {
+		changed = true
+	}
+	return changed
+}
+
+// syncManagedTaints sets taints on a node and removes the taints listed in the managed annotation which are no longer set.
+func syncManagedTaints(n *corev1.Node, taints []corev1.Taint) bool {
+	wanted := make(map[string]corev1.Taint, len(taints))
+	for _, taint := range taints {
+		wanted[taintID(taint)] = taint
+	}
+	managed := make(map[string]bool)
+	for _, id := range strings.Split(n.Annotations[managedTaintsAnnotation], ",") {
+		managed[id] = id != ""
+	}
+
+	changed := false
+	result := make([]corev1.Taint, 0, len(n.Spec.Taints)+len(taints))
+	for _, taint := range n.Spec.Taints {
+		id := taintID(taint)
+		want, ok := wanted[id]
+		switch {
+		case ok:
+			if want.Value != taint.Value {
+				changed = true
+			}
+			result = append(result, want)
+			delete(wanted, id)
+		case managed[id]:
+			changed = true
+		default:
+			result = append(result, taint)
+		}
+	}
+	for _, taint := range taints {
+		if want, ok := wanted[taintID(taint)]; ok {
+			result = append(result, want)
+			delete(wanted, taintID(taint))
+			changed = true
+		}
+	}
+	n.Spec.Taints = result
+
+	ids := make([]string, 0, len(taints))
+	for _, taint := range taints {
+		ids = append(ids, taintID(taint))
+	}
+	sort.Strings(ids)
+	if list := strings.Join(ids, ","); n.Annotations[managedTaintsAnnotation] != list {
+		if list == "" {
+			delete(n.Annotations, managedTaintsAnnotation)
+		} else {
+			n.Annotations[managedTaintsAnnotation] = list
+		}
+		changed = true
+	}
+	return changed
+}
+
+func taintID(taint corev1.Taint) string {
+	return taint.Key + ":" + string(taint.Effect)
+}
+
+// syncManaged sets values into target and deletes the keys listed in the managed annotation which are no longer set.
+// The managed annotation is updated with the keys of values.
+func syncManaged(target, annotations map[string]string, managedAnnotation string, values map[string]string) bool {
+	changed := false
+	for _, key := range strings.Split(annotations[managedAnnotation], ",") {
+		if _, ok := values[key]; !ok && key != "" {
+			if _, ok := target[key]; ok {
+				delete(target, key)
+				changed = true
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for key, value := range values {
+		keys = append(keys, key)
+		if current, ok := target[key]; !ok || current != value {
+			target[key] = value
+			changed = true
+		}
+	}
+	sort.Strings(keys)
+
+	managed := strings.Join(keys, ",")
+	if annotations[managedAnnotation] != managed {
+		if managed == "" {
+			delete(annotations, managedAnnotation)
+		} else {
+			annotations[managedAnnotation] = managed
+		}
+		changed = true
+	}
+	return changed
 }
 
 // deleteNode deletes the virtual node with the Kubernetes API.
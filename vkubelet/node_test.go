@@ -0,0 +1,188 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package vkubelet
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplyNodeMetadata(t *testing.T) {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"type": "iofog-kubelet"},
+		},
+	}
+
+	metadata := &providers.NodeMetadata{
+		Architecture: "arm",
+		Labels:       map[string]string{"kubernetes.io/arch": "arm", "iofog.org/agent-name": "first"},
+		Annotations:  map[string]string{"iofog.org/location": "eu/paris"},
+	}
+	if !applyNodeMetadata(node, metadata) {
+		t.Fatal("expected the node to change")
+	}
+	if node.Status.NodeInfo.Architecture != "arm" || node.Labels["kubernetes.io/arch"] != "arm" || node.Annotations["iofog.org/location"] != "eu/paris" {
+		t.Fatalf("unexpected node metadata: %v %v", node.Labels, node.Annotations)
+	}
+	if applyNodeMetadata(node, metadata) {
+		t.Fatal("expected the node to be unchanged")
+	}
+
+	// Metadata no longer reported is removed, labels set by others are kept.
+	node.Labels["team"] = "edge"
+	metadata = &providers.NodeMetadata{
+		Labels: map[string]string{"iofog.org/agent-name": "renamed"},
+	}
+	if !applyNodeMetadata(node, metadata) {
+		t.Fatal("expected the node to change")
+	}
+	expected := map[string]string{"type": "iofog-kubelet", "team": "edge", "iofog.org/agent-name": "renamed"}
+	if len(node.Labels) != len(expected) {
+		t.Fatalf("expected labels %v, got %v", expected, node.Labels)
+	}
+	for key, value := range expected {
+		if node.Labels[key] != value {
+			t.Errorf("expected label %s=%s, got %q", key, value, node.Labels[key])
+		}
+	}
+	if _, ok := node.Annotations["iofog.org/location"]; ok {
+		t.Error("expected the location annotation to be removed")
+	}
+	if node.Annotations[managedLabelsAnnotation] != "iofog.org/agent-name" {
+		t.Errorf("unexpected managed labels %q", node.Annotations[managedLabelsAnnotation])
+	}
+}
+
+func TestSyncManagedTaints(t *testing.T) {
+	defaultTaint := corev1.Taint{Key: "resource-type", Value: "iofog-custom-resource", Effect: corev1.TaintEffectNoSchedule}
+	node := &corev1.Node{Spec: corev1.NodeSpec{Taints: []corev1.Taint{defaultTaint}}}
+
+	camera := corev1.Taint{Key: "iofog.org/camera", Effect: corev1.TaintEffectNoExecute}
+	if !applyNodeMetadata(node, &providers.NodeMetadata{Taints: []corev1.Taint{camera}}) {
+		t.Fatal("expected the node to change")
+	}
+	if len(node.Spec.Taints) != 2 || node.Annotations[managedTaintsAnnotation] != "iofog.org/camera:NoExecute" {
+		t.Fatalf("unexpected taints %v %v", node.Spec.Taints, node.Annotations)
+	}
+	if applyNodeMetadata(node, &providers.NodeMetadata{Taints: []corev1.Taint{camera}}) {
+		t.Fatal("expected the node to be unchanged")
+	}
+
+	// Taints no longer reported are removed, taints set by others are kept.
+	if !applyNodeMetadata(node, &providers.NodeMetadata{}) {
+		t.Fatal("expected the node to change")
+	}
+	if len(node.Spec.Taints) != 1 || node.Spec.Taints[0] != defaultTaint {
+		t.Fatalf("expected only the default taint, got %v", node.Spec.Taints)
+	}
+	if _, ok := node.Annotations[managedTaintsAnnotation]; ok {
+		t.Error("expected the managed taints annotation to be removed")
+	}
+}
+
+func TestDefaultTaint(t *testing.T) {
+	defaultTaint := corev1.Taint{Key: "resource-type", Value: "iofog-custom-resource", Effect: corev1.TaintEffectNoSchedule}
+	node := &corev1.Node{}
+	if !applyNodeMetadata(node, withDefaultTaint(&providers.NodeMetadata{}, &defaultTaint)) {
+		t.Fatal("expected the node to change")
+	}
+	if len(node.Spec.Taints) != 1 || node.Spec.Taints[0] != defaultTaint {
+		t.Fatalf("expected the default taint, got %v", node.Spec.Taints)
+	}
+
+	// A policy taint with the same key and effect overrides the default taint, which is restored once it is removed.
+	override := corev1.Taint{Key: "resource-type", Value: "camera", Effect: corev1.TaintEffectNoSchedule}
+	applyNodeMetadata(node, withDefaultTaint(&providers.NodeMetadata{Taints: []corev1.Taint{override}}, &defaultTaint))
+	if len(node.Spec.Taints) != 1 || node.Spec.Taints[0] != override {
+		t.Fatalf("expected the policy taint, got %v", node.Spec.Taints)
+	}
+	applyNodeMetadata(node, withDefaultTaint(&providers.NodeMetadata{}, &defaultTaint))
+	if len(node.Spec.Taints) != 1 || node.Spec.Taints[0] != defaultTaint {
+		t.Fatalf("expected the default taint to be restored, got %v", node.Spec.Taints)
+	}
+
+	// A changed default taint replaces the previous one.
+	changed := corev1.Taint{Key: "iofog.org/agent", Effect: corev1.TaintEffectNoSchedule}
+	applyNodeMetadata(node, withDefaultTaint(&providers.NodeMetadata{}, &changed))
+	if len(node.Spec.Taints) != 1 || node.Spec.Taints[0] != changed {
+		t.Fatalf("expected the changed default taint, got %v", node.Spec.Taints)
+	}
+}
+
+func TestNodeStatusPatch(t *testing.T) {
+	transition := metav1.NewTime(time.Unix(1000, 0))
+	original := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "iofog-node", ResourceVersion: "42"},
+		Status: corev1.NodeStatus{
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: corev1.ConditionTrue, LastTransitionTime: transition, LastHeartbeatTime: transition},
+			},
+		},
+	}
+
+	// A new heartbeat with the same status is not a change, and keeps the transition time.
+	heartbeat := metav1.NewTime(time.Unix(2000, 0))
+	updated := original.DeepCopy()
+	updated.Status.Conditions = mergeNodeConditions(original.Status.Conditions, []corev1.NodeCondition{
+		{Type: corev1.NodeReady, Status: corev1.ConditionTrue, LastTransitionTime: heartbeat, LastHeartbeatTime: heartbeat},
+	})
+	if nodeStatusChanged(&original.Status, &updated.Status) {
+		t.Fatal("expected a new heartbeat not to change the status")
+	}
+	if !updated.Status.Conditions[0].LastTransitionTime.Equal(&transition) {
+		t.Errorf("expected the transition time to be kept, got %v", updated.Status.Conditions[0].LastTransitionTime)
+	}
+
+	updated.Status.Conditions = mergeNodeConditions(original.Status.Conditions, []corev1.NodeCondition{
+		{Type: corev1.NodeReady, Status: corev1.ConditionFalse, LastTransitionTime: heartbeat, LastHeartbeatTime: heartbeat},
+	})
+	if !nodeStatusChanged(&original.Status, &updated.Status) {
+		t.Fatal("expected the status to change")
+	}
+	if !updated.Status.Conditions[0].LastTransitionTime.Equal(&heartbeat) {
+		t.Errorf("expected a new transition time, got %v", updated.Status.Conditions[0].LastTransitionTime)
+	}
+
+	patch, err := nodePatch(original, updated, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(patch), "resourceVersion") || !strings.Contains(string(patch), `"status":"False"`) {
+		t.Errorf("unexpected patch %s", patch)
+	}
+}
+
+func TestNodeMetadataPatch(t *testing.T) {
+	original := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "iofog-node", ResourceVersion: "42"},
+		Spec:       corev1.NodeSpec{Taints: []corev1.Taint{{Key: "team", Effect: corev1.TaintEffectNoSchedule}}},
+	}
+	updated := original.DeepCopy()
+	updated.Spec.Taints = append(updated.Spec.Taints, corev1.Taint{Key: "iofog.org/policy", Effect: corev1.TaintEffectNoSchedule})
+
+	// The taints are replaced as a whole, the patch only applies to the version of the node it was computed from.
+	patch, err := nodePatch(original, updated, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(patch), `"resourceVersion":"42"`) || !strings.Contains(string(patch), "iofog.org/policy") {
+		t.Errorf("unexpected patch %s", patch)
+	}
+}
@@ -14,17 +14,23 @@
 package vkubelet
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"sync"
 	"time"
 
+	"github.com/cpuguy83/strongerrors"
 	"github.com/cpuguy83/strongerrors/status/ocstatus"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/log"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
 	"github.com/eclipse-iofog/iofog-kubelet/v2/trace"
 	pkgerrors "github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/client-go/tools/record"
 )
 
@@ -42,13 +48,10 @@ func (s *Server) createOrUpdatePod(ctx context.Context, pod *corev1.Pod, recorde
 	ctx, span := trace.StartSpan(ctx, "createOrUpdatePod")
 	defer span.End()
 
-	if pp, _ := s.provider.GetPod(ctx, pod.Namespace, pod.Name); pp != nil {
-		err := s.provider.UpdatePod(ctx, pp)
-		return err
-	}
-
 	addPodAttributes(ctx, span, pod)
 
+	// The pod comes from the informer cache, its environment is resolved on a copy.
+	pod = pod.DeepCopy()
 	if err := populateEnvironmentVariables(ctx, pod, s.resourceManager, recorder); err != nil {
 		span.SetStatus(ocstatus.FromError(err))
 		return err
@@ -58,6 +61,18 @@ func (s *Server) createOrUpdatePod(ctx context.Context, pod *corev1.Pod, recorde
 		"pod":       pod.GetName(),
 		"namespace": pod.GetNamespace(),
 	})
+	ctx = providers.WithEventRecorder(ctx, recorder)
+
+	// Pods known to the provider are updated to the new spec.
+	if pp, _ := s.provider.GetPod(ctx, pod.Namespace, pod.Name); pp != nil {
+		if err := s.provider.UpdatePod(ctx, pod); err != nil {
+			recorder.Eventf(pod, corev1.EventTypeWarning, "ProviderUpdateFailed", "Failed to update the pod: %v", err)
+			span.SetStatus(ocstatus.FromError(err))
+			return err
+		}
+		log.G(ctx).Debug("Updated pod in provider")
+		return nil
+	}
 
 	if origErr := s.provider.CreatePod(ctx, pod); origErr != nil {
 		podPhase := corev1.PodPending
@@ -124,6 +139,96 @@ func (s *Server) deletePod(ctx context.Context, namespace, name string) error {
 	return nil
 }
 
+// terminatePod stops the containers of a pod marked for deletion, then deletes the pod once they stopped or its grace
+// period is over. It reports whether the pod was deleted, the pod must be synced again otherwise.
+func (s *Server) terminatePod(ctx context.Context, pod *corev1.Pod, recorder record.EventRecorder) (bool, error) {
+	ctx, span := trace.StartSpan(ctx, "terminatePod")
+	defer span.End()
+	ctx = addPodAttributes(ctx, span, pod)
+
+	key := pod.Namespace + "/" + pod.Name
+	stopper, ok := s.provider.(providers.PodStopper)
+	pp, _ := s.provider.GetPod(ctx, pod.Namespace, pod.Name)
+	// The deletion timestamp is when the grace period of the pod is over.
+	if !ok || pp == nil || !pod.DeletionTimestamp.After(time.Now()) {
+		return s.deleteTerminatedPod(ctx, span, key, pod)
+	}
+
+	if !s.podStopping(key) {
+		err := stopper.StopPod(ctx, pp)
+		if strongerrors.IsNotFound(err) {
+			// Nothing runs in the provider, there is nothing to wait for.
+			log.G(ctx).WithError(err).Debug("Pod has nothing to stop in provider")
+			return s.deleteTerminatedPod(ctx, span, key, pod)
+		}
+		if err != nil {
+			span.SetStatus(ocstatus.FromError(err))
+			return false, pkgerrors.Wrap(err, "error stopping pod")
+		}
+		s.setPodStopping(key, true)
+		recorder.Eventf(pod, corev1.EventTypeNormal, "Killing", "Stopping the containers, grace period ends at %s", pod.DeletionTimestamp.Format(time.RFC3339))
+		log.G(ctx).Info("Stopping pod in provider")
+	}
+
+	stopped, err := stopper.PodStopped(ctx, pp)
+	if strongerrors.IsNotFound(err) {
+		stopped, err = true, nil
+	}
+	if err != nil {
+		// The pod is deleted anyway once its grace period is over.
+		log.G(ctx).WithError(err).Warn("Failed to check whether the pod stopped")
+		return false, nil
+	}
+	if !stopped {
+		return false, nil
+	}
+
+	log.G(ctx).Debug("Pod stopped before the end of its grace period")
+	return s.deleteTerminatedPod(ctx, span, key, pod)
+}
+
+// deleteTerminatedPod deletes a pod whose containers stopped, or whose grace period is over, from the provider and Kubernetes.
+func (s *Server) deleteTerminatedPod(ctx context.Context, span trace.Span, key string, pod *corev1.Pod) (bool, error) {
+	if err := s.deletePod(ctx, pod.Namespace, pod.Name); err != nil {
+		span.SetStatus(ocstatus.FromError(err))
+		return false, err
+	}
+	s.setPodStopping(key, false)
+	return true, nil
+}
+
+func (s *Server) podStopping(key string) bool {
+	s.podMutex.Lock()
+	defer s.podMutex.Unlock()
+	return s.stoppingPods[key]
+}
+
+func (s *Server) setPodStopping(key string, stopping bool) {
+	s.podMutex.Lock()
+	defer s.podMutex.Unlock()
+	if stopping {
+		s.stoppingPods[key] = true
+	} else {
+		delete(s.stoppingPods, key)
+	}
+}
+
+// markPodTerminating reports the containers of a pod marked for deletion as no longer ready.
+func markPodTerminating(status *corev1.PodStatus) {
+	status.Reason = "Terminating"
+	status.Message = "The pod is terminating, its containers are being stopped"
+	for idx, condition := range status.Conditions {
+		if condition.Type == corev1.PodReady || condition.Type == corev1.ContainersReady {
+			status.Conditions[idx].Status = corev1.ConditionFalse
+			status.Conditions[idx].Reason = "PodTerminating"
+			status.Conditions[idx].Message = ""
+		}
+	}
+	for idx := range status.ContainerStatuses {
+		status.ContainerStatuses[idx].Ready = false
+	}
+}
+
 func (s *Server) forceDeletePodResource(ctx context.Context, namespace, name string) error {
 	ctx, span := trace.StartSpan(ctx, "forceDeletePodResource")
 	defer span.End()
@@ -144,6 +249,9 @@ func (s *Server) forceDeletePodResource(ctx context.Context, namespace, name str
 	return nil
 }
 
+// podStatusFunc returns the provider status of a pod, ok is false when the status is unknown and the pod is left unchanged.
+type podStatusFunc func(ctx context.Context, pod *corev1.Pod) (status *corev1.PodStatus, ok bool, err error)
+
 // updatePodStatuses syncs the providers pod status with the kubernetes pod status.
 func (s *Server) updatePodStatuses(ctx context.Context) {
 	ctx, span := trace.StartSpan(ctx, "updatePodStatuses")
@@ -154,6 +262,13 @@ func (s *Server) updatePodStatuses(ctx context.Context) {
 
 	ctx = span.WithField(ctx, "nPods", int64(len(pods)))
 
+	getStatus, err := s.podStatuses(ctx)
+	if err != nil {
+		span.SetStatus(ocstatus.FromError(err))
+		log.G(ctx).WithError(err).Error("Error retrieving the pod statuses")
+		return
+	}
+
 	sema := make(chan struct{}, s.podSyncWorkers)
 	var wg sync.WaitGroup
 	wg.Add(len(pods))
@@ -170,7 +285,7 @@ func (s *Server) updatePodStatuses(ctx context.Context) {
 			}
 			defer func() { <-sema }()
 
-			if err := s.updatePodStatus(ctx, pod); err != nil {
+			if err := s.updatePodStatus(ctx, pod, getStatus); err != nil {
 				log.G(ctx).WithFields(log.Fields{
 					"pod":       pod.GetName(),
 					"namespace": pod.GetNamespace(),
@@ -185,7 +300,31 @@ func (s *Server) updatePodStatuses(ctx context.Context) {
 	wg.Wait()
 }
 
-func (s *Server) updatePodStatus(ctx context.Context, pod *corev1.Pod) error {
+// podStatuses computes the status of every pod at once when the provider supports it, else pod by pod.
+func (s *Server) podStatuses(ctx context.Context) (podStatusFunc, error) {
+	p, ok := s.provider.(providers.PodStatusBatchProvider)
+	if !ok {
+		return func(ctx context.Context, pod *corev1.Pod) (*corev1.PodStatus, bool, error) {
+			status, err := s.provider.GetPodStatus(ctx, pod.Namespace, pod.Name)
+			// A pod which the provider has not deployed yet keeps its status, like in GetPodStatuses.
+			if strongerrors.IsNotFound(err) {
+				return nil, false, nil
+			}
+			return status, err == nil, err
+		}, nil
+	}
+
+	statuses, err := p.GetPodStatuses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, pod *corev1.Pod) (*corev1.PodStatus, bool, error) {
+		status, ok := statuses[types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}]
+		return status, ok, nil
+	}, nil
+}
+
+func (s *Server) updatePodStatus(ctx context.Context, pod *corev1.Pod, getStatus podStatusFunc) error {
 	ctx, span := trace.StartSpan(ctx, "updatePodStatus")
 	defer span.End()
 	ctx = addPodAttributes(ctx, span, pod)
@@ -196,46 +335,135 @@ func (s *Server) updatePodStatus(ctx context.Context, pod *corev1.Pod) error {
 		return nil
 	}
 
-	status, err := s.provider.GetPodStatus(ctx, pod.Namespace, pod.Name)
+	status, ok, err := getStatus(ctx, pod)
 	if err != nil {
 		span.SetStatus(ocstatus.FromError(err))
 		return pkgerrors.Wrap(err, "error retreiving pod status")
 	}
+	if !ok {
+		recordPodStatusUpdate(ctx, podStatusSkipped)
+		return nil
+	}
 
-	// Update the pod's status
+	// The pod comes from the informer cache, it must not be modified.
+	updated := pod.DeepCopy()
 	if status != nil {
-		pod.Status = *status
+		if pod.DeletionTimestamp != nil {
+			markPodTerminating(status)
+		}
+		status.Conditions = mergePodConditions(pod.Status.Conditions, status.Conditions)
+		keepPodStatusFields(&pod.Status, status)
+		updated.Status = *status
 	} else {
 		// Only change the status when the pod was already up
 		// Only doing so when the pod was successfully running makes sure we don't run into race conditions during pod creation.
 		if pod.Status.Phase == corev1.PodRunning || pod.ObjectMeta.CreationTimestamp.Add(time.Minute).Before(time.Now()) {
 			// Set the pod to failed, this makes sure if the underlying container implementation is gone that a new pod will be created.
-			pod.Status.Phase = corev1.PodFailed
-			pod.Status.Reason = "NotFound"
-			pod.Status.Message = "The pod status was not found and may have been deleted from the provider"
-			for i, c := range pod.Status.ContainerStatuses {
-				pod.Status.ContainerStatuses[i].State.Terminated = &corev1.ContainerStateTerminated{
+			updated.Status.Phase = corev1.PodFailed
+			updated.Status.Reason = "NotFound"
+			updated.Status.Message = "The pod status was not found and may have been deleted from the provider"
+			for i, c := range updated.Status.ContainerStatuses {
+				terminated := &corev1.ContainerStateTerminated{
 					ExitCode:    -137,
 					Reason:      "NotFound",
 					Message:     "Container was not found and was likely deleted",
 					FinishedAt:  metav1.NewTime(time.Now()),
-					StartedAt:   c.State.Running.StartedAt,
 					ContainerID: c.ContainerID,
 				}
-				pod.Status.ContainerStatuses[i].State.Running = nil
+				if c.State.Running != nil {
+					terminated.StartedAt = c.State.Running.StartedAt
+				}
+				updated.Status.ContainerStatuses[i].State.Terminated = terminated
+				updated.Status.ContainerStatuses[i].State.Running = nil
 			}
 		}
 	}
 
-	if _, err := s.Client.CoreV1().Pods(pod.Namespace).UpdateStatus(pod); err != nil {
+	if !podStatusChanged(&pod.Status, &updated.Status) {
+		recordPodStatusUpdate(ctx, podStatusSkipped)
+		return nil
+	}
+
+	patch, err := podStatusPatch(pod, updated)
+	if err != nil {
+		recordPodStatusUpdate(ctx, podStatusFailed)
+		span.SetStatus(ocstatus.FromError(err))
+		return pkgerrors.Wrap(err, "error creating the pod status patch")
+	}
+	if _, err := s.Client.CoreV1().Pods(pod.Namespace).Patch(pod.Name, types.StrategicMergePatchType, patch, "status"); err != nil {
+		recordPodStatusUpdate(ctx, podStatusFailed)
 		span.SetStatus(ocstatus.FromError(err))
 		return pkgerrors.Wrap(err, "error while updating pod status in kubernetes")
 	}
+	recordPodStatusUpdate(ctx, podStatusWritten)
 
 	log.G(ctx).WithFields(log.Fields{
-		"new phase":  string(pod.Status.Phase),
-		"new reason": pod.Status.Reason,
+		"new phase":  string(updated.Status.Phase),
+		"new reason": updated.Status.Reason,
 	}).Debug("Updated pod status in kubernetes")
 
 	return nil
 }
+
+// keepPodStatusFields carries over the fields the provider does not report, so they are not removed by the patch.
+func keepPodStatusFields(previous, status *corev1.PodStatus) {
+	if status.HostIP == "" {
+		status.HostIP = previous.HostIP
+	}
+	if status.PodIP == "" {
+		status.PodIP = previous.PodIP
+	}
+	if status.QOSClass == "" {
+		status.QOSClass = previous.QOSClass
+	}
+	if status.NominatedNodeName == "" {
+		status.NominatedNodeName = previous.NominatedNodeName
+	}
+}
+
+// podStatusChanged reports whether the status changed, ignoring the probe times of the conditions.
+func podStatusChanged(original, updated *corev1.PodStatus) bool {
+	withoutProbes := func(status *corev1.PodStatus) *corev1.PodStatus {
+		status = status.DeepCopy()
+		for idx := range status.Conditions {
+			status.Conditions[idx].LastProbeTime = metav1.Time{}
+		}
+		return status
+	}
+	originalJSON, err := json.Marshal(withoutProbes(original))
+	if err != nil {
+		return true
+	}
+	updatedJSON, err := json.Marshal(withoutProbes(updated))
+	if err != nil {
+		return true
+	}
+	return !bytes.Equal(originalJSON, updatedJSON)
+}
+
+// podStatusPatch creates the strategic merge patch of the status from the original to the updated pod.
+func podStatusPatch(original, updated *corev1.Pod) ([]byte, error) {
+	originalJSON, err := json.Marshal(corev1.Pod{Status: original.Status})
+	if err != nil {
+		return nil, err
+	}
+	updatedJSON, err := json.Marshal(corev1.Pod{Status: updated.Status})
+	if err != nil {
+		return nil, err
+	}
+	return strategicpatch.CreateTwoWayMergePatch(originalJSON, updatedJSON, corev1.Pod{})
+}
+
+// mergePodConditions keeps the transition time of the conditions whose status did not change since the previous status.
+func mergePodConditions(previous, conditions []corev1.PodCondition) []corev1.PodCondition {
+	merged := make([]corev1.PodCondition, 0, len(conditions))
+	for _, condition := range conditions {
+		for _, old := range previous {
+			if old.Type == condition.Type && old.Status == condition.Status && !old.LastTransitionTime.IsZero() {
+				condition.LastTransitionTime = old.LastTransitionTime
+			}
+		}
+		merged = append(merged, condition)
+	}
+	return merged
+}
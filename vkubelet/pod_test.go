@@ -0,0 +1,216 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package vkubelet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cpuguy83/strongerrors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestMergePodConditions(t *testing.T) {
+	before := metav1.NewTime(time.Unix(1000, 0))
+	now := metav1.NewTime(time.Unix(2000, 0))
+	previous := []corev1.PodCondition{
+		{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: before},
+		{Type: corev1.PodReady, Status: corev1.ConditionFalse, LastTransitionTime: before},
+	}
+
+	merged := mergePodConditions(previous, []corev1.PodCondition{
+		{Type: corev1.PodScheduled, Status: corev1.ConditionTrue, LastTransitionTime: now},
+		{Type: corev1.PodReady, Status: corev1.ConditionTrue, LastTransitionTime: now},
+		{Type: corev1.ContainersReady, Status: corev1.ConditionTrue, LastTransitionTime: now},
+	})
+
+	expected := []metav1.Time{before, now, now}
+	for idx, condition := range merged {
+		if !condition.LastTransitionTime.Equal(&expected[idx]) {
+			t.Errorf("%s: expected transition at %v, got %v", condition.Type, expected[idx], condition.LastTransitionTime)
+		}
+	}
+}
+
+func TestPodStatusPatch(t *testing.T) {
+	started := metav1.NewTime(time.Unix(1000, 0))
+	original := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", ResourceVersion: "1"},
+		Status: corev1.PodStatus{
+			Phase:  corev1.PodPending,
+			HostIP: "10.0.0.1",
+			Conditions: []corev1.PodCondition{
+				{Type: corev1.PodReady, Status: corev1.ConditionFalse, LastTransitionTime: started},
+			},
+		},
+	}
+
+	updated := original.DeepCopy()
+	updated.Status.Conditions[0].LastProbeTime = metav1.NewTime(time.Unix(2000, 0))
+	if podStatusChanged(&original.Status, &updated.Status) {
+		t.Fatal("expected probe times to be ignored")
+	}
+
+	status := corev1.PodStatus{
+		Phase: corev1.PodRunning,
+		Conditions: []corev1.PodCondition{
+			{Type: corev1.PodReady, Status: corev1.ConditionTrue, LastTransitionTime: started},
+		},
+	}
+	keepPodStatusFields(&original.Status, &status)
+	updated.Status = status
+	if !podStatusChanged(&original.Status, &updated.Status) {
+		t.Fatal("expected the status to change")
+	}
+
+	patch, err := podStatusPatch(original, updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(patch, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decoded["metadata"]; ok {
+		t.Errorf("expected the patch to only carry the status, got %s", patch)
+	}
+	patched := decoded["status"].(map[string]interface{})
+	if patched["phase"] != string(corev1.PodRunning) {
+		t.Errorf("expected the phase to be patched, got %s", patch)
+	}
+	if _, ok := patched["hostIP"]; ok {
+		t.Errorf("expected the host IP to be kept, got %s", patch)
+	}
+}
+
+func TestMarkPodTerminating(t *testing.T) {
+	status := &corev1.PodStatus{
+		Phase: corev1.PodRunning,
+		Conditions: []corev1.PodCondition{
+			{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+			{Type: corev1.PodReady, Status: corev1.ConditionTrue},
+			{Type: corev1.ContainersReady, Status: corev1.ConditionTrue},
+		},
+		ContainerStatuses: []corev1.ContainerStatus{{Name: "app", Ready: true}},
+	}
+
+	markPodTerminating(status)
+
+	if status.Phase != corev1.PodRunning || status.Reason != "Terminating" {
+		t.Errorf("expected a running pod terminating, got %s %s", status.Phase, status.Reason)
+	}
+	expected := []corev1.ConditionStatus{corev1.ConditionTrue, corev1.ConditionFalse, corev1.ConditionFalse}
+	for idx, condition := range status.Conditions {
+		if condition.Status != expected[idx] {
+			t.Errorf("%s: expected %s, got %s", condition.Type, expected[idx], condition.Status)
+		}
+	}
+	if status.ContainerStatuses[0].Ready {
+		t.Error("expected the container to no longer be ready")
+	}
+}
+
+// stoppingProvider is a mock provider whose pods stop when told so.
+type stoppingProvider struct {
+	*mockProvider
+	stops    int
+	stopped  bool
+	notFound bool
+}
+
+func (p *stoppingProvider) StopPod(ctx context.Context, pod *corev1.Pod) error {
+	if p.notFound {
+		return strongerrors.NotFound(fmt.Errorf("flow of pod %s not found", pod.Name))
+	}
+	p.stops++
+	return nil
+}
+
+func (p *stoppingProvider) PodStopped(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	return p.stopped, nil
+}
+
+func TestTerminatePod(t *testing.T) {
+	var deleted []string
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == "DELETE" {
+			deleted = append(deleted, req.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+	}))
+	defer apiServer.Close()
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: apiServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := &stoppingProvider{mockProvider: newMockProvider()}
+	s := &Server{Client: client, provider: provider, stoppingPods: make(map[string]bool)}
+	recorder := record.NewFakeRecorder(10)
+
+	deadline := metav1.NewTime(time.Now().Add(time.Minute))
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sensor", DeletionTimestamp: &deadline}}
+	provider.CreatePod(context.Background(), pod)
+
+	// The pod is stopped once and requeued until it stopped.
+	for i := 0; i < 2; i++ {
+		if done, err := s.terminatePod(context.Background(), pod, recorder); err != nil || done {
+			t.Fatalf("expected the pod to be stopping, got %v, %v", done, err)
+		}
+	}
+	if provider.stops != 1 || len(deleted) != 0 {
+		t.Fatalf("expected the pod to be stopped once and not deleted, got %d stops, deleted %v", provider.stops, deleted)
+	}
+
+	provider.stopped = true
+	if done, err := s.terminatePod(context.Background(), pod, recorder); err != nil || !done {
+		t.Fatalf("expected the stopped pod to be deleted, got %v, %v", done, err)
+	}
+	if len(deleted) != 1 || deleted[0] != "/api/v1/namespaces/default/pods/sensor" || len(provider.pods) != 0 || s.podStopping("default/sensor") {
+		t.Fatalf("expected the pod to be deleted, got %v", deleted)
+	}
+
+	// Once the grace period is over, the pod is deleted whether it stopped or not.
+	provider.stopped = false
+	expired := metav1.NewTime(time.Now().Add(-time.Second))
+	pod.DeletionTimestamp = &expired
+	provider.CreatePod(context.Background(), pod)
+	if done, err := s.terminatePod(context.Background(), pod, recorder); err != nil || !done {
+		t.Fatalf("expected the pod to be deleted at the deadline, got %v, %v", done, err)
+	}
+	if provider.stops != 1 || len(deleted) != 2 {
+		t.Fatalf("expected the pod to be deleted without stopping it, got %d stops, deleted %v", provider.stops, deleted)
+	}
+
+	// A pod without anything to stop in the provider is deleted at once.
+	provider.notFound = true
+	pod.DeletionTimestamp = &deadline
+	provider.CreatePod(context.Background(), pod)
+	if done, err := s.terminatePod(context.Background(), pod, recorder); err != nil || !done {
+		t.Fatalf("expected the pod to be deleted, got %v, %v", done, err)
+	}
+	if len(deleted) != 3 {
+		t.Fatalf("expected the pod to be deleted, got %v", deleted)
+	}
+}
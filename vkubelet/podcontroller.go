@@ -41,6 +41,8 @@ import (
 const (
 	// maxRetries is the number of times we try to process a given key before permanently forgetting it.
 	maxRetries = 20
+	// terminatingPodSyncPeriod is how often the pods marked for deletion are checked for their containers to be stopped.
+	terminatingPodSyncPeriod = 2 * time.Second
 )
 
 // PodController is the controller implementation for Pod resources.
@@ -250,6 +252,7 @@ func (pc *PodController) syncHandler(ctx context.Context, key string) error {
 			span.SetStatus(ocstatus.FromError(err))
 			return err
 		}
+		pc.server.setPodStopping(key, false)
 		return nil
 	}
 	// At this point we know the Pod resource has either been created or updated (which includes being marked for deletion).
@@ -265,13 +268,17 @@ func (pc *PodController) syncPodInProvider(ctx context.Context, pod *corev1.Pod)
 	ctx = addPodAttributes(ctx, span, pod)
 
 	// Check whether the pod has been marked for deletion.
-	// If it does, guarantee it is deleted in the provider and Kubernetes.
+	// If it does, stop it and guarantee it is deleted in the provider and Kubernetes once stopped or its grace period is over.
 	if pod.DeletionTimestamp != nil {
-		if err := pc.server.deletePod(ctx, pod.Namespace, pod.Name); err != nil {
+		deleted, err := pc.server.terminatePod(ctx, pod, pc.recorder)
+		if err != nil {
 			err := pkgerrors.Wrapf(err, "failed to delete pod %q in the provider", loggablePodName(pod))
 			span.SetStatus(ocstatus.FromError(err))
 			return err
 		}
+		if !deleted {
+			pc.requeueTerminatingPod(pod)
+		}
 		return nil
 	}
 
@@ -290,6 +297,20 @@ func (pc *PodController) syncPodInProvider(ctx context.Context, pod *corev1.Pod)
 	return nil
 }
 
+// requeueTerminatingPod syncs a terminating pod again after a while, or as soon as its grace period is over.
+func (pc *PodController) requeueTerminatingPod(pod *corev1.Pod) {
+	key, err := cache.MetaNamespaceKeyFunc(pod)
+	if err != nil {
+		log.L.Error(err)
+		return
+	}
+	delay := terminatingPodSyncPeriod
+	if remaining := time.Until(pod.DeletionTimestamp.Time); remaining < delay {
+		delay = remaining
+	}
+	pc.workqueue.AddAfter(key, delay)
+}
+
 // deleteDanglingPods checks whether the provider knows about any pods which Kubernetes doesn't know about, and deletes them.
 func (pc *PodController) deleteDanglingPods(ctx context.Context, threadiness int) {
 	ctx, span := trace.StartSpan(ctx, "deleteDanglingPods")
@@ -0,0 +1,89 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package vkubelet
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/cpuguy83/strongerrors"
+	"github.com/eclipse-iofog/iofog-kubelet/v2/providers"
+	"github.com/pkg/errors"
+)
+
+// ProviderRouter keeps track of the providers of the running nodes so that a single
+// kubelet API server can route requests to the node they are meant for.
+type ProviderRouter struct {
+	mutex     sync.RWMutex
+	providers map[string]providers.Provider
+}
+
+// NewProviderRouter creates an empty ProviderRouter.
+func NewProviderRouter() *ProviderRouter {
+	return &ProviderRouter{
+		providers: make(map[string]providers.Provider),
+	}
+}
+
+// Add registers the provider backing a node.
+func (r *ProviderRouter) Add(nodeName string, provider providers.Provider) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.providers[nodeName] = provider
+}
+
+// Remove unregisters the provider backing a node.
+func (r *ProviderRouter) Remove(nodeName string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.providers, nodeName)
+}
+
+// ProviderForNode resolves the provider backing the named node.
+// Every node advertises the address of this server, requests are told apart by the kubelet port of their node.
+func (r *ProviderRouter) ProviderForNode(req *http.Request, nodeName string) (providers.Provider, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if provider, ok := r.providers[nodeName]; ok {
+		return provider, nil
+	}
+	return nil, strongerrors.NotFound(errors.Errorf("node %q not found", nodeName))
+}
+
+// ProviderForPod resolves the node a pod is scheduled to.
+func (r *ProviderRouter) ProviderForPod(req *http.Request, namespace, name string) (providers.Provider, error) {
+	for nodeName, provider := range r.Providers() {
+		pod, err := provider.GetPod(req.Context(), namespace, name)
+		if err == nil && pod != nil && pod.Spec.NodeName == nodeName {
+			return provider, nil
+		}
+	}
+
+	return nil, strongerrors.NotFound(errors.Errorf("pod %s/%s not found", namespace, name))
+}
+
+// Providers returns the providers of every running node, indexed by node name.
+func (r *ProviderRouter) Providers() map[string]providers.Provider {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	nodes := make(map[string]providers.Provider, len(r.providers))
+	for nodeName, provider := range r.providers {
+		nodes[nodeName] = provider
+	}
+	return nodes
+}
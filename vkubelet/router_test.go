@@ -0,0 +1,89 @@
+/*
+ *  *******************************************************************************
+ *  * Copyright (c) 2019 Edgeworx, Inc.
+ *  *
+ *  * This program and the accompanying materials are made available under the
+ *  * terms of the Eclipse Public License v. 2.0 which is available at
+ *  * http://www.eclipse.org/legal/epl-2.0
+ *  *
+ *  * SPDX-License-Identifier: EPL-2.0
+ *  *******************************************************************************
+ *
+ */
+
+package vkubelet
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cpuguy83/strongerrors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProviderRouter(t *testing.T) {
+	first := newMockProvider("10.0.0.1")
+	second := newMockProvider("10.0.0.2")
+
+	router := NewProviderRouter()
+	router.Add("iofog-first", first)
+	router.Add("iofog-second", second)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "sensor"},
+		Spec:       corev1.PodSpec{NodeName: "iofog-second"},
+	}
+	// Both providers share a store, only the pod node name tells them apart.
+	first.CreatePod(context.Background(), pod)
+	second.CreatePod(context.Background(), pod)
+
+	// Every node advertises the address of the shared server.
+	req := httptest.NewRequest("GET", "https://10.0.0.1:10251/stats/summary", nil)
+	if p, err := router.ProviderForNode(req, "iofog-second"); err != nil || p != second {
+		t.Fatalf("expected the second provider for its name, got %v, %v", p, err)
+	}
+	if _, err := router.ProviderForNode(req, "iofog-third"); !strongerrors.IsNotFound(err) {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+
+	req = httptest.NewRequest("GET", "https://10.0.0.1:10250/containerLogs/default/sensor/relay", nil)
+	if p, err := router.ProviderForPod(req, "default", "sensor"); err != nil || p != second {
+		t.Fatalf("expected the provider of the pod node, got %v, %v", p, err)
+	}
+
+	router.Remove("iofog-second")
+	if _, err := router.ProviderForPod(req, "default", "sensor"); !strongerrors.IsNotFound(err) {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+	if _, err := router.ProviderForNode(req, "iofog-second"); !strongerrors.IsNotFound(err) {
+		t.Fatalf("expected not found error, got: %v", err)
+	}
+	if nodes := router.Providers(); len(nodes) != 1 || nodes["iofog-first"] != first {
+		t.Fatalf("expected the only provider left, got %v", nodes)
+	}
+}
+
+func TestNodeHandler(t *testing.T) {
+	router := NewProviderRouter()
+	router.Add("iofog-first", newMockProvider("10.0.0.1"))
+	handler := MetricsSummaryHandler(router)
+
+	// The summary is served on the kubelet port of a node, whose provider does not implement it here.
+	for _, tc := range []struct {
+		handler  http.Handler
+		expected int
+	}{
+		{NodeHandler("iofog-first", handler), http.StatusNotImplemented},
+		{NodeHandler("iofog-second", handler), http.StatusNotFound},
+		{handler, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		tc.handler.ServeHTTP(w, httptest.NewRequest("GET", "https://10.0.0.1:10251/stats/summary", nil))
+		if w.Code != tc.expected {
+			t.Errorf("expected status %d, got %d: %s", tc.expected, w.Code, w.Body.String())
+		}
+	}
+}
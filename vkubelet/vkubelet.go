@@ -15,10 +15,12 @@ package vkubelet
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"go.opencensus.io/trace"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
 	corev1informers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 
@@ -28,6 +30,11 @@ import (
 
 const (
 	podStatusReasonProviderFailed = "ProviderFailed"
+
+	// nodeStatusUpdateFrequency is how often the node status is checked for changes.
+	nodeStatusUpdateFrequency = 10 * time.Second
+	// DefaultNodeStatusReportFrequency is how often the node status is reported when it does not change.
+	DefaultNodeStatusReportFrequency = 1 * time.Minute
 )
 
 // Server masquarades itself as a kubelet and allows for the virtual node to be backed by non-vm/node providers.
@@ -40,6 +47,21 @@ type Server struct {
 	resourceManager *manager.ResourceManager
 	podSyncWorkers  int
 	podInformer     corev1informers.PodInformer
+	nodeChanged     chan struct{}
+
+	nodeStatusReportFrequency time.Duration
+	nodeLeaseDuration         time.Duration
+	podEvictionTimeout        time.Duration
+
+	nodeMutex      sync.Mutex
+	nodeUID        types.UID
+	statusReported time.Time
+	leaseOK        bool
+	unreadySince   time.Time
+
+	podMutex sync.Mutex
+	// stoppingPods are the pods marked for deletion whose containers are being stopped, by namespace/name.
+	stoppingPods map[string]bool
 }
 
 // Config is used to configure a new server.
@@ -52,6 +74,12 @@ type Config struct {
 	Taint           *corev1.Taint
 	PodSyncWorkers  int
 	PodInformer     corev1informers.PodInformer
+	// NodeStatusReportFrequency is how often the node status is reported when it does not change.
+	NodeStatusReportFrequency time.Duration
+	// NodeLeaseDuration is how long the node Lease is valid, it is renewed four times as often.
+	NodeLeaseDuration time.Duration
+	// PodEvictionTimeout is how long the node can be unready before its pods are evicted, a negative timeout disables evictions.
+	PodEvictionTimeout time.Duration
 }
 
 // New creates a new iofog-kubelet server.
@@ -60,7 +88,7 @@ type Config struct {
 // This creates but does not start the server.
 // You must call `Run` on the returned object to start the server.
 func New(cfg Config) *Server {
-	return &Server{
+	s := &Server{
 		namespace:       cfg.Namespace,
 		nodeName:        cfg.NodeName,
 		taint:           cfg.Taint,
@@ -69,6 +97,30 @@ func New(cfg Config) *Server {
 		provider:        cfg.Provider,
 		podSyncWorkers:  cfg.PodSyncWorkers,
 		podInformer:     cfg.PodInformer,
+		nodeChanged:     make(chan struct{}, 1),
+		stoppingPods:    make(map[string]bool),
+
+		nodeStatusReportFrequency: cfg.NodeStatusReportFrequency,
+		nodeLeaseDuration:         cfg.NodeLeaseDuration,
+		podEvictionTimeout:        cfg.PodEvictionTimeout,
+	}
+	if s.nodeStatusReportFrequency <= 0 {
+		s.nodeStatusReportFrequency = DefaultNodeStatusReportFrequency
+	}
+	if s.nodeLeaseDuration <= 0 {
+		s.nodeLeaseDuration = DefaultNodeLeaseDuration
+	}
+	if s.podEvictionTimeout == 0 {
+		s.podEvictionTimeout = DefaultPodEvictionTimeout
+	}
+	return s
+}
+
+// NotifyNodeChanged updates the node without waiting for the next sync, such as after its agent changed.
+func (s *Server) NotifyNodeChanged() {
+	select {
+	case s.nodeChanged <- struct{}{}:
+	default:
 	}
 }
 
@@ -82,6 +134,12 @@ func (s *Server) Run(ctx context.Context) error {
 		return err
 	}
 
+	// The loops stop with the pod controller, even when it fails.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go s.nodeLeaseLoop(ctx)
+	go s.nodeSyncLoop(ctx)
 	go s.providerSyncLoop(ctx)
 
 	return NewPodController(s).Run(ctx, s.podSyncWorkers)
@@ -102,7 +160,6 @@ func (s *Server) providerSyncLoop(ctx context.Context) {
 			t.Stop()
 
 			ctx, span := trace.StartSpan(ctx, "syncActualState")
-			s.updateNode(ctx)
 			s.updatePodStatuses(ctx)
 			span.End()
 
@@ -111,3 +168,72 @@ func (s *Server) providerSyncLoop(ctx context.Context) {
 		}
 	}
 }
+
+// nodeSyncLoop checks the node status for changes, and updates it right away when notified that it changed.
+func (s *Server) nodeSyncLoop(ctx context.Context) {
+	t := time.NewTicker(nodeStatusUpdateFrequency)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.nodeChanged:
+		case <-t.C:
+		}
+
+		ctx, span := trace.StartSpan(ctx, "syncNode")
+		s.updateNode(ctx)
+		s.evictPodsOfUnreadyNode(ctx)
+		span.End()
+	}
+}
+
+// nodeLeaseLoop renews the node Lease, the heartbeat of the node, four times per Lease duration.
+func (s *Server) nodeLeaseLoop(ctx context.Context) {
+	t := time.NewTicker(s.nodeLeaseDuration / 4)
+	defer t.Stop()
+
+	for {
+		renewed := s.renewNodeLease(ctx)
+		s.nodeMutex.Lock()
+		s.leaseOK = renewed
+		s.nodeMutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (s *Server) leaseRenewed() bool {
+	s.nodeMutex.Lock()
+	defer s.nodeMutex.Unlock()
+	return s.leaseOK
+}
+
+func (s *Server) getNodeUID() types.UID {
+	s.nodeMutex.Lock()
+	defer s.nodeMutex.Unlock()
+	return s.nodeUID
+}
+
+func (s *Server) setNodeUID(uid types.UID) {
+	s.nodeMutex.Lock()
+	defer s.nodeMutex.Unlock()
+	s.nodeUID = uid
+}
+
+func (s *Server) lastStatusReport() time.Time {
+	s.nodeMutex.Lock()
+	defer s.nodeMutex.Unlock()
+	return s.statusReported
+}
+
+func (s *Server) setLastStatusReport(reported time.Time) {
+	s.nodeMutex.Lock()
+	defer s.nodeMutex.Unlock()
+	s.statusReported = reported
+}